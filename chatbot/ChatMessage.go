@@ -12,6 +12,24 @@ type ChatMessage struct {
 	Content     string                 `yaml:"content"`
 	ToolCalls   []chattools.ToolCall   `yaml:"toolCalls,omitempty"`
 	ToolResults []chattools.ToolResult `yaml:"toolResults,omitempty"`
+	// The message starts with a summary of earlier turns.
+	Summary bool `yaml:"summary,omitempty"`
+	// Token usage as reported by the provider, if it does.
+	Usage      *Usage `yaml:"usage,omitempty"`
+	StopReason string `yaml:"stopReason,omitempty"`
+	// Fenced code blocks in Content
+	CodeBlocks []CodeBlock `yaml:"codeBlocks,omitempty"`
+}
+
+// A fenced code block. Lang is the first word of its info string.
+type CodeBlock struct {
+	Lang string `yaml:"lang,omitempty"`
+	Code string `yaml:"code"`
+}
+
+type Usage struct {
+	InputTokens  int `yaml:"inputTokens" json:"inputTokens"`
+	OutputTokens int `yaml:"outputTokens" json:"outputTokens"`
 }
 
 func (msg ChatMessage) Sprint() string {
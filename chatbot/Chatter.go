@@ -1,6 +1,9 @@
 package chatbot
 
-import "github.com/c00/botman-v2/chattools"
+import (
+	"github.com/c00/botman-v2/chattools"
+	"github.com/c00/botman-v2/jsonschema"
+)
 
 // Chatter is an interface to an LLM provider
 type Chatter interface {
@@ -19,3 +22,16 @@ type Chatter interface {
 	SetSystemPrompt(prompt string)
 	GetSystemPrompt() string
 }
+
+// SchemaResponder is a Chatter whose provider can make the model answer with JSON that matches a schema.
+// For other chatters, the schema is put in the prompt.
+type SchemaResponder interface {
+	// Responses are JSON that matches schema. nil goes back to text.
+	SetResponseSchema(schema *jsonschema.JsonSchema)
+}
+
+// ToolChooser is a Chatter whose provider can force or forbid tool calls.
+type ToolChooser interface {
+	// The choice for the next responses.
+	SetToolChoice(choice chattools.ToolChoice)
+}
@@ -0,0 +1,43 @@
+package chatbot
+
+import (
+	"encoding/json"
+
+	"github.com/c00/botman-v2/jsonschema"
+)
+
+// The property that holds a response that is not an object
+const wrappedProperty = "value"
+
+// WrapSchema returns an object schema for schema, as tool and response format APIs only take objects.
+// Other schemas become the single property of an object, and responses to them need UnwrapResponse.
+func WrapSchema(schema jsonschema.JsonSchema) (jsonschema.JsonSchema, bool) {
+	if schema.Type == jsonschema.TypeObject {
+		return schema, false
+	}
+
+	//References are to the root
+	defs := schema.Defs
+	schema.Defs = nil
+
+	wrapper := jsonschema.New()
+	wrapper.AddProperty(wrappedProperty, schema, true)
+	wrapper.AdditionalProperties = jsonschema.Bool(false)
+	wrapper.Defs = defs
+	return wrapper, true
+}
+
+// UnwrapResponse returns the value of a response to a schema that WrapSchema wrapped.
+func UnwrapResponse(content string) string {
+	wrapper := map[string]json.RawMessage{}
+	err := json.Unmarshal([]byte(content), &wrapper)
+	if err != nil {
+		return content
+	}
+
+	value, ok := wrapper[wrappedProperty]
+	if !ok {
+		return content
+	}
+	return string(value)
+}
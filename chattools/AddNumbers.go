@@ -0,0 +1,64 @@
+package chattools
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/c00/botman-v2/jsonschema"
+)
+
+func init() {
+	Register(ToolTypeAddNumbers, func(def ToolDefinition, env Env) (Tool, error) {
+		return AddNumbers{name: def.Name}, nil
+	})
+}
+
+// AddNumbers adds two numbers. Mostly useful for testing tool calls.
+type AddNumbers struct {
+	name string
+}
+
+func (t AddNumbers) Name() string {
+	return t.name
+}
+
+func (t AddNumbers) Schema() jsonschema.JsonSchema {
+	schema := jsonschema.New()
+	schema.AddNumber("a", "the first number", true)
+	schema.AddNumber("b", "the second number", true)
+	return schema
+}
+
+func (t AddNumbers) Run(ctx context.Context, call ToolCall) ToolResult {
+	a := getInt(call.Params, "a")
+	b := getInt(call.Params, "b")
+
+	result := a + b
+
+	return ToolResult{
+		Name:    call.Name,
+		ID:      call.ID,
+		Content: strconv.Itoa(result),
+		Success: true,
+		Value:   result,
+	}
+}
+
+func getInt(params map[string]any, key string) int {
+	switch val := params[key].(type) {
+	case nil:
+		return 0
+	case int:
+		return val
+	case int32:
+		return int(val)
+	case int64:
+		return int(val)
+	case float32:
+		return int(val)
+	case float64:
+		return int(val)
+	}
+
+	return 0
+}
@@ -0,0 +1,44 @@
+package chattools
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestAddNumbers_Run(t *testing.T) {
+	tests := []struct {
+		name string
+		call ToolCall
+		want ToolResult
+	}{
+		{
+			name: "happy path int",
+			call: ToolCall{Name: "Foo", Params: map[string]any{"a": 5, "b": 10}},
+			want: ToolResult{Name: "Foo", Content: "15", Value: 15, Success: true},
+		},
+		{
+			name: "happy path floats",
+			call: ToolCall{Name: "Foo", Params: map[string]any{"a": float64(5), "b": float64(10)}},
+			want: ToolResult{Name: "Foo", Content: "15", Value: 15, Success: true},
+		},
+		{
+			name: "missing fields",
+			call: ToolCall{Name: "Foo", Params: map[string]any{}},
+			want: ToolResult{Name: "Foo", Content: "0", Value: 0, Success: true},
+		},
+		{
+			name: "wrong type fields",
+			call: ToolCall{Name: "Foo", Params: map[string]any{"a": true, "b": "Potato"}},
+			want: ToolResult{Name: "Foo", Content: "0", Value: 0, Success: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (AddNumbers{}).Run(context.Background(), tt.call); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("AddNumbers.Run() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
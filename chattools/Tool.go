@@ -0,0 +1,89 @@
+package chattools
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/c00/botman-v2/jsonschema"
+)
+
+// Tool is something a model can call.
+type Tool interface {
+	// The name the model calls the tool by
+	Name() string
+	// The parameters of a call
+	Schema() jsonschema.JsonSchema
+	Run(ctx context.Context, call ToolCall) ToolResult
+}
+
+// Storage saves files that tools create, such as generated images.
+type Storage interface {
+	Save(name string, data []byte) (string, error)
+	Load(name string) ([]byte, error)
+}
+
+// Env holds what tools can use from the application that runs them.
+type Env struct {
+	Storage Storage
+}
+
+// Factory creates a tool from its definition. Tools decode their own settings with ToolDefinition.DecodeSettings.
+type Factory func(def ToolDefinition, env Env) (Tool, error)
+
+func NewRegistry() *Registry {
+	return &Registry{factories: map[string]Factory{}}
+}
+
+// Registry creates tools by their tool type.
+type Registry struct {
+	mu        sync.RWMutex
+	factories map[string]Factory
+}
+
+// DefaultRegistry holds the tools that come with botman. Tool packages register themselves here.
+var DefaultRegistry = NewRegistry()
+
+// Register a tool type in the DefaultRegistry.
+func Register(toolType string, factory Factory) {
+	DefaultRegistry.Register(toolType, factory)
+}
+
+// Register a tool type. Registering a type again replaces it.
+func (r *Registry) Register(toolType string, factory Factory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.factories[toolType] = factory
+}
+
+// New creates the tool for a definition.
+func (r *Registry) New(def ToolDefinition, env Env) (Tool, error) {
+	r.mu.RLock()
+	factory, ok := r.factories[def.ToolType]
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown tool type %v", def.ToolType)
+	}
+
+	return factory(def, env)
+}
+
+// Types returns the registered tool types in order.
+func (r *Registry) Types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return slices.Sorted(maps.Keys(r.factories))
+}
+
+// Clone returns a registry with the same tool types, that can be added to without changing r.
+func (r *Registry) Clone() *Registry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return &Registry{factories: maps.Clone(r.factories)}
+}
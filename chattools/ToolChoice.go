@@ -0,0 +1,60 @@
+package chattools
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// The model decides whether to call tools
+	ToolChoiceAuto = "auto"
+	// The model does not call tools
+	ToolChoiceNone = "none"
+	// The model calls at least one tool
+	ToolChoiceAny = "any"
+	// The model calls the tool named in ToolChoice.Name
+	ToolChoiceTool = "tool"
+)
+
+// ToolChoice controls whether the model calls tools in a response.
+type ToolChoice struct {
+	// ToolChoiceAuto (default), ToolChoiceNone, ToolChoiceAny or ToolChoiceTool
+	Type string
+	// The tool to call, for ToolChoiceTool
+	Name string
+	// At most one tool call per response
+	DisableParallel bool
+}
+
+// ParseToolChoice reads a choice as it is written in the config and flags: auto, none, any or tool:<name>.
+func ParseToolChoice(s string) (ToolChoice, error) {
+	s = strings.TrimSpace(s)
+	switch s {
+	case "", ToolChoiceAuto:
+		return ToolChoice{Type: ToolChoiceAuto}, nil
+	case ToolChoiceNone, ToolChoiceAny:
+		return ToolChoice{Type: s}, nil
+	}
+
+	name, ok := strings.CutPrefix(s, ToolChoiceTool+":")
+	if !ok || name == "" {
+		return ToolChoice{}, fmt.Errorf("unknown tool choice %v, use auto, none, any or tool:<name>", s)
+	}
+	return ToolChoice{Type: ToolChoiceTool, Name: name}, nil
+}
+
+// IsAuto is true when the choice leaves everything to the model.
+func (c ToolChoice) IsAuto() bool {
+	return (c.Type == "" || c.Type == ToolChoiceAuto) && !c.DisableParallel
+}
+
+func (c ToolChoice) String() string {
+	choice := c.Type
+	if choice == "" {
+		choice = ToolChoiceAuto
+	}
+	if c.Type == ToolChoiceTool {
+		choice = ToolChoiceTool + ":" + c.Name
+	}
+	return choice
+}
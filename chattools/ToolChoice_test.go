@@ -0,0 +1,30 @@
+package chattools
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseToolChoice(t *testing.T) {
+	tests := map[string]ToolChoice{
+		"":                 {Type: ToolChoiceAuto},
+		"auto":             {Type: ToolChoiceAuto},
+		"none":             {Type: ToolChoiceNone},
+		"any":              {Type: ToolChoiceAny},
+		"tool:get_weather": {Type: ToolChoiceTool, Name: "get_weather"},
+	}
+	for input, want := range tests {
+		choice, err := ParseToolChoice(input)
+		assert.Nil(t, err)
+		assert.Equal(t, want, choice)
+		if input != "" {
+			assert.Equal(t, input, choice.String())
+		}
+	}
+
+	_, err := ParseToolChoice("tool:")
+	assert.NotNil(t, err)
+	_, err = ParseToolChoice("always")
+	assert.NotNil(t, err)
+}
@@ -1,38 +1,161 @@
 package chattools
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/c00/botman-v2/internal/logger"
 	"github.com/c00/botman-v2/jsonschema"
+	"gopkg.in/yaml.v3"
+)
+
+var log = logger.New("ChatTools")
+
+const DefaultTimeout = 5 * time.Minute
+
+const (
+	// Run calls without asking
+	ApprovalAuto = "auto"
+	// Ask the user before running a call. Calls are denied when there is no user to ask.
+	ApprovalAsk = "ask"
+	// Never run calls
+	ApprovalDeny = "deny"
 )
 
 const (
 	ToolTypeAddNumbers = "add"
+	ToolTypeCommand    = "command"
 	ToolTypeDalle      = "dalle"
 	ToolTypeSdxl       = "sdxl"
+	ToolTypeLocalSd    = "localsd"
 )
 
 type ToolDefinition struct {
-	ToolType     string      `yaml:"toolType"`
-	Name         string      `yaml:"name"`
-	Description  string      `yaml:"description"`
-	SdxlSettings *SdxlConfig `yaml:"sdxl"`
-	// MockSettings *MockSettings
-	// DalleSettings *DalleSettings
+	ToolType    string `yaml:"toolType"`
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	// Settings of the tool type, decoded by the tool with DecodeSettings
+	Settings yaml.Node `yaml:"settings,omitempty"`
+	// How long a call may take, DefaultTimeout when not set
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Whether calls need approval of the user: ApprovalAuto (default), ApprovalAsk or ApprovalDeny
+	Approval string `yaml:"approval,omitempty"`
+	// Tool choice for the response to the results of this tool, e.g. none to make the model answer
+	// after this tool ran: auto (default), none, any or tool:<name>
+	ToolChoice string `yaml:"toolChoice,omitempty"`
+
+	//Set from the tool that was created for this definition
+	schema *jsonschema.JsonSchema
+}
+
+func (d *ToolDefinition) UnmarshalYAML(value *yaml.Node) error {
+	type plain ToolDefinition
+	legacy := struct {
+		plain `yaml:",inline"`
+		//Settings used to live under a key named after the tool type
+		Sdxl yaml.Node `yaml:"sdxl"`
+	}{}
+
+	err := value.Decode(&legacy)
+	if err != nil {
+		return err
+	}
+
+	*d = ToolDefinition(legacy.plain)
+	if d.Settings.IsZero() && !legacy.Sdxl.IsZero() {
+		d.Settings = legacySdxlSettings(legacy.Sdxl)
+	}
+	return nil
+}
+
+// Keys of the legacy sdxl settings, which were written without their capitals
+var legacySdxlKeys = map[string]string{
+	"positiveprompt": "positivePrompt",
+	"negativeprompt": "negativePrompt",
+	"apikey":         "apiKey",
+}
+
+// Returns the legacy sdxl settings with the keys the settings of the sdxl tool have now.
+func legacySdxlSettings(node yaml.Node) yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return node
+	}
+
+	content := make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		key, ok := legacySdxlKeys[child.Value]
+		if i%2 == 0 && ok {
+			renamed := *child
+			renamed.Value = key
+			child = &renamed
+		}
+		content[i] = child
+	}
+	node.Content = content
+	return node
 }
 
+// DecodeSettings decodes the settings of the definition into v. Leaves v as it is when there are no settings.
+func (d ToolDefinition) DecodeSettings(v any) error {
+	if d.Settings.IsZero() {
+		return nil
+	}
+
+	err := d.Settings.Decode(v)
+	if err != nil {
+		return fmt.Errorf("invalid settings for tool %v: %w", d.Name, err)
+	}
+	return nil
+}
+
+// SetSettings replaces the settings of the definition with v.
+func (d *ToolDefinition) SetSettings(v any) error {
+	node := yaml.Node{}
+	err := node.Encode(v)
+	if err != nil {
+		return err
+	}
+
+	d.Settings = node
+	return nil
+}
+
+// ExpandHome replaces a leading ~ in a path from the settings of a tool with the home directory of the user.
+func ExpandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// WithSchema returns the definition with the schema of its tool, as chatters send it to models.
+func (d ToolDefinition) WithSchema(schema jsonschema.JsonSchema) ToolDefinition {
+	d.schema = &schema
+	return d
+}
+
+// Schema returns the parameters of the tool. Definitions without a schema from WithSchema
+// create their tool from the DefaultRegistry to get it.
 func (d ToolDefinition) Schema() jsonschema.JsonSchema {
-	schema := jsonschema.New()
+	if d.schema != nil {
+		return *d.schema
+	}
 
-	switch d.ToolType {
-	case ToolTypeAddNumbers:
-		schema.AddNumber("a", "the first number", true)
-		schema.AddNumber("b", "the second number", true)
-		return schema
-	case ToolTypeSdxl:
-		schema.AddString("prompt", "The positive prompt for the image. Be descriptive. Describe at least the scene, the quality, the type of image.", true)
-		schema.AddString("negativePrompt", "The negative prompt for the image. Optionally add things you don't want in the prompt. This can be helpful to mitigate common problems with SDXL, such as hands with too many fingers.", false)
+	tool, err := DefaultRegistry.New(d, Env{})
+	if err != nil {
+		log.Warn("no schema for tool %v: %v", d.Name, err)
+		return jsonschema.New()
 	}
-	//Todo implement the rest
-	return schema
+
+	return tool.Schema()
 }
 
 // Chatters will return this when they require a tool to be called
@@ -49,10 +172,3 @@ type ToolResult struct {
 	Success bool
 	Value   any
 }
-
-type SdxlConfig struct {
-	NegativePrompt string `json:"negativePrompt"`
-	PositivePrompt string `json:"positivePrompt"`
-	ApiKey         string `json:"apiKey,omitempty"`
-	Model          string `json:"model,omitempty"`
-}
@@ -0,0 +1,86 @@
+package chattools
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+type testSettings struct {
+	Greeting string `yaml:"greeting"`
+}
+
+func TestToolDefinitionSettings(t *testing.T) {
+	defs := []ToolDefinition{}
+	err := yaml.Unmarshal([]byte(`
+- toolType: greet
+  name: greet
+  timeout: 10s
+  settings:
+    greeting: hello
+- toolType: sdxl
+  name: legacy
+  sdxl:
+    greeting: old
+- toolType: add
+  name: add
+`), &defs)
+	assert.Nil(t, err)
+	assert.Len(t, defs, 3)
+	assert.Equal(t, "greet", defs[0].Name)
+	assert.Equal(t, "10s", defs[0].Timeout.String())
+
+	settings := testSettings{}
+	assert.Nil(t, defs[0].DecodeSettings(&settings))
+	assert.Equal(t, "hello", settings.Greeting)
+
+	settings = testSettings{}
+	assert.Nil(t, defs[1].DecodeSettings(&settings))
+	assert.Equal(t, "old", settings.Greeting)
+
+	//No settings leaves defaults alone
+	settings = testSettings{Greeting: "default"}
+	assert.Nil(t, defs[2].DecodeSettings(&settings))
+	assert.Equal(t, "default", settings.Greeting)
+
+	assert.Nil(t, defs[2].SetSettings(testSettings{Greeting: "set"}))
+	assert.Nil(t, defs[2].DecodeSettings(&settings))
+	assert.Equal(t, "set", settings.Greeting)
+}
+
+func TestRegistry(t *testing.T) {
+	r := DefaultRegistry.Clone()
+	r.Register("other", func(def ToolDefinition, env Env) (Tool, error) {
+		return AddNumbers{name: "other " + def.Name}, nil
+	})
+
+	tool, err := r.New(ToolDefinition{ToolType: "other", Name: "tool"}, Env{})
+	assert.Nil(t, err)
+	assert.Equal(t, "other tool", tool.Name())
+
+	_, err = r.New(ToolDefinition{ToolType: "missing"}, Env{})
+	assert.NotNil(t, err)
+
+	//The clone does not change the default registry
+	assert.Contains(t, r.Types(), "other")
+	assert.NotContains(t, DefaultRegistry.Types(), "other")
+	assert.Contains(t, DefaultRegistry.Types(), ToolTypeAddNumbers)
+}
+
+func TestToolDefinitionSchema(t *testing.T) {
+	def := ToolDefinition{ToolType: ToolTypeAddNumbers, Name: "add"}
+	assert.Equal(t, []string{"a", "b"}, def.Schema().Required)
+
+	schema := def.Schema()
+	schema.Required = []string{"a"}
+	assert.Equal(t, []string{"a"}, def.WithSchema(schema).Schema().Required)
+}
+
+func TestExpandHome(t *testing.T) {
+	t.Setenv("HOME", "/home/botman")
+	assert.Equal(t, "/home/botman", ExpandHome("~"))
+	assert.Equal(t, "/home/botman/work", ExpandHome("~/work"))
+	assert.Equal(t, "~other/work", ExpandHome("~other/work"))
+	assert.Equal(t, "/tmp/work", ExpandHome("/tmp/work"))
+}
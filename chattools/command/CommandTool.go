@@ -0,0 +1,237 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/c00/botman-v2/chattools"
+	"github.com/c00/botman-v2/internal/logger"
+	"github.com/c00/botman-v2/jsonschema"
+)
+
+var log = logger.New("CommandTool")
+
+// DefaultMaxOutput is the output size cap when the settings have none.
+const DefaultMaxOutput = 1024 * 1024
+
+// Environment variables that are always passed to the command.
+var baseEnv = []string{"PATH", "HOME", "USER", "LANG", "TMPDIR", "TZ"}
+
+func init() {
+	chattools.Register(chattools.ToolTypeCommand, func(def chattools.ToolDefinition, env chattools.Env) (chattools.Tool, error) {
+		return New(def)
+	})
+}
+
+// Config holds the settings of a command tool definition.
+type Config struct {
+	// The executable to run, looked up in PATH
+	Command string   `yaml:"command"`
+	Args    []string `yaml:"args,omitempty"`
+	// The schema of the params that are sent to the command
+	Params jsonschema.JsonSchema `yaml:"params"`
+	// Working directory, the current directory when empty
+	Dir string `yaml:"dir,omitempty"`
+	// Environment variables to pass through by name, such as API_KEY or AWS_*. NAME=value sets a variable.
+	Env []string `yaml:"env,omitempty"`
+	// Pass through the whole environment instead
+	InheritEnv bool `yaml:"inheritEnv,omitempty"`
+	// Bytes of output the command may write, DefaultMaxOutput when 0
+	MaxOutput int `yaml:"maxOutput,omitempty"`
+}
+
+// Output is what the command writes to stdout.
+type Output struct {
+	Content string `json:"content"`
+	// Defaults to true
+	Success *bool `json:"success"`
+	Value   any   `json:"value"`
+}
+
+func New(def chattools.ToolDefinition) (*CommandTool, error) {
+	settings := Config{}
+	err := def.DecodeSettings(&settings)
+	if err != nil {
+		return nil, err
+	}
+
+	if settings.Command == "" {
+		return nil, fmt.Errorf("tool %v has no command", def.Name)
+	}
+
+	if settings.Params.Type == "" {
+		settings.Params.Type = "object"
+	}
+
+	if settings.MaxOutput <= 0 {
+		settings.MaxOutput = DefaultMaxOutput
+	}
+
+	return &CommandTool{Definition: def, Settings: settings}, nil
+}
+
+// CommandTool runs an executable. The params of a call are written to its stdin as JSON,
+// and it answers with an Output as JSON on stdout.
+type CommandTool struct {
+	Definition chattools.ToolDefinition
+	Settings   Config
+}
+
+func (t *CommandTool) Name() string {
+	return t.Definition.Name
+}
+
+func (t *CommandTool) Schema() jsonschema.JsonSchema {
+	return t.Settings.Params
+}
+
+func (t *CommandTool) Run(ctx context.Context, call chattools.ToolCall) chattools.ToolResult {
+	params := call.Params
+	if params == nil {
+		params = map[string]any{}
+	}
+	input, err := json.Marshal(params)
+	if err != nil {
+		return failed(fmt.Sprintf("could not encode params: %v", err))
+	}
+
+	stdout := &cappedBuffer{max: t.Settings.MaxOutput}
+	stderr := &cappedBuffer{max: t.Settings.MaxOutput}
+
+	cmd := exec.CommandContext(ctx, t.Settings.Command, t.Settings.Args...)
+	cmd.Dir = chattools.ExpandHome(t.Settings.Dir)
+	cmd.Env = t.environ()
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	//Don't wait forever for children that keep the pipes open
+	cmd.WaitDelay = time.Second
+
+	err = cmd.Run()
+	if ctx.Err() != nil {
+		return failed(fmt.Sprintf("command stopped: %v", ctx.Err()))
+	}
+
+	if stdout.overflow {
+		return failed(fmt.Sprintf("command wrote more than %v bytes of output", t.Settings.MaxOutput))
+	}
+
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			log.Error("could not run %v: %v", t.Settings.Command, err)
+			return failed(fmt.Sprintf("could not run command: %v", err))
+		}
+
+		content := strings.TrimSpace(stderr.String())
+		if content == "" {
+			content = strings.TrimSpace(stdout.String())
+		}
+		return failed(fmt.Sprintf("command failed with %v: %v", exitErr, content))
+	}
+
+	output, ok := parseOutput(stdout.Bytes())
+	if !ok {
+		//Plain text is fine too
+		return chattools.ToolResult{Success: true, Content: strings.TrimSpace(stdout.String())}
+	}
+
+	success := output.Success == nil || *output.Success
+	return chattools.ToolResult{Success: success, Content: output.Content, Value: output.Value}
+}
+
+// Parse data as an Output. Other JSON is not an Output, even when it is an object.
+func parseOutput(data []byte) (Output, bool) {
+	fields := map[string]json.RawMessage{}
+	err := json.Unmarshal(data, &fields)
+	if err != nil {
+		return Output{}, false
+	}
+
+	_, hasContent := fields["content"]
+	_, hasSuccess := fields["success"]
+	_, hasValue := fields["value"]
+	if !hasContent && !hasSuccess && !hasValue {
+		return Output{}, false
+	}
+
+	output := Output{}
+	err = json.Unmarshal(data, &output)
+	if err != nil {
+		return Output{}, false
+	}
+	return output, true
+}
+
+func (t *CommandTool) environ() []string {
+	if t.Settings.InheritEnv {
+		return append(os.Environ(), setEnv(t.Settings.Env)...)
+	}
+
+	env := []string{}
+	names := slices.Concat(baseEnv, t.Settings.Env)
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		for _, pattern := range names {
+			if strings.Contains(pattern, "=") {
+				continue
+			}
+			if ok, _ := filepath.Match(pattern, name); ok {
+				env = append(env, kv)
+				break
+			}
+		}
+	}
+
+	return append(env, setEnv(t.Settings.Env)...)
+}
+
+// The NAME=value entries of env.
+func setEnv(env []string) []string {
+	result := []string{}
+	for _, entry := range env {
+		if strings.Contains(entry, "=") {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+func failed(content string) chattools.ToolResult {
+	return chattools.ToolResult{Success: false, Content: content}
+}
+
+// Keeps up to max bytes and drops the rest.
+type cappedBuffer struct {
+	buf      bytes.Buffer
+	max      int
+	overflow bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	room := b.max - b.buf.Len()
+	if len(p) > room {
+		b.overflow = true
+		b.buf.Write(p[:max(room, 0)])
+		//Report everything as written, so the command does not get a broken pipe
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *cappedBuffer) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+func (b *cappedBuffer) String() string {
+	return b.buf.String()
+}
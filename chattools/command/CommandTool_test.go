@@ -0,0 +1,137 @@
+package command
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/c00/botman-v2/chattools"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func newTool(t *testing.T, script string, settings Config) *CommandTool {
+	settings.Command = "sh"
+	settings.Args = []string{"-c", script}
+
+	def := chattools.ToolDefinition{ToolType: chattools.ToolTypeCommand, Name: "script"}
+	assert.Nil(t, def.SetSettings(settings))
+
+	tool, err := New(def)
+	assert.Nil(t, err)
+	return tool
+}
+
+func TestCommandTool_Run(t *testing.T) {
+	call := chattools.ToolCall{Name: "script", Params: map[string]any{"name": "Bob"}}
+
+	tests := []struct {
+		name     string
+		script   string
+		settings Config
+		want     chattools.ToolResult
+	}{
+		{
+			name:   "json output",
+			script: `echo '{"content": "hello", "value": 5}'`,
+			want:   chattools.ToolResult{Success: true, Content: "hello", Value: float64(5)},
+		},
+		{
+			name:   "unsuccessful output",
+			script: `echo '{"content": "no such user", "success": false}'`,
+			want:   chattools.ToolResult{Success: false, Content: "no such user"},
+		},
+		{
+			name:   "params on stdin",
+			script: `cat`,
+			want:   chattools.ToolResult{Success: true, Content: `{"name":"Bob"}`},
+		},
+		{
+			name:   "plain text",
+			script: `echo hello there`,
+			want:   chattools.ToolResult{Success: true, Content: "hello there"},
+		},
+		{
+			name:   "exit code",
+			script: `echo oops >&2; exit 3`,
+			want:   chattools.ToolResult{Success: false, Content: "command failed with exit status 3: oops"},
+		},
+		{
+			name:     "output cap",
+			script:   `echo 12345678901234567890`,
+			settings: Config{MaxOutput: 10},
+			want:     chattools.ToolResult{Success: false, Content: "command wrote more than 10 bytes of output"},
+		},
+		{
+			name:     "working directory",
+			script:   `pwd`,
+			settings: Config{Dir: "/"},
+			want:     chattools.ToolResult{Success: true, Content: "/"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tool := newTool(t, tt.script, tt.settings)
+			got := tool.Run(context.Background(), call)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCommandTool_Env(t *testing.T) {
+	t.Setenv("BOTMAN_TEST_PASSED", "passed")
+	t.Setenv("BOTMAN_TEST_HIDDEN", "hidden")
+
+	script := `echo "$BOTMAN_TEST_PASSED $BOTMAN_TEST_HIDDEN $BOTMAN_TEST_SET"`
+	call := chattools.ToolCall{Name: "script"}
+
+	tool := newTool(t, script, Config{Env: []string{"BOTMAN_TEST_P*", "BOTMAN_TEST_SET=set"}})
+	assert.Equal(t, "passed  set", tool.Run(context.Background(), call).Content)
+
+	tool = newTool(t, script, Config{InheritEnv: true})
+	assert.Equal(t, "passed hidden", tool.Run(context.Background(), call).Content)
+}
+
+func TestCommandTool_Timeout(t *testing.T) {
+	tool := newTool(t, "sleep 5", Config{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	got := tool.Run(ctx, chattools.ToolCall{Name: "script"})
+	assert.False(t, got.Success)
+	assert.Contains(t, got.Content, "deadline exceeded")
+	assert.Less(t, time.Since(start), 3*time.Second)
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(chattools.ToolDefinition{ToolType: chattools.ToolTypeCommand, Name: "empty"})
+	assert.NotNil(t, err)
+}
+
+func TestNew_FromYaml(t *testing.T) {
+	defs := []chattools.ToolDefinition{}
+	err := yaml.Unmarshal([]byte(`
+- toolType: command
+  name: lookup_user
+  settings:
+    command: ./lookup-user.sh
+    args: ["--json"]
+    params:
+      type: object
+      properties:
+        name:
+          type: string
+          description: The name of the user
+      required: [name]
+`), &defs)
+	assert.Nil(t, err)
+
+	tool, err := New(defs[0])
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"--json"}, tool.Settings.Args)
+	assert.Equal(t, "string", tool.Schema().Properties["name"].Type)
+	assert.Equal(t, []string{"name"}, tool.Schema().Required)
+	assert.Equal(t, DefaultMaxOutput, tool.Settings.MaxOutput)
+}
@@ -0,0 +1,357 @@
+package dalle
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/c00/botman-v2/chattools"
+	"github.com/c00/botman-v2/chattools/imagetool"
+	"github.com/c00/botman-v2/internal/logger"
+	"github.com/c00/botman-v2/jsonschema"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+var log = logger.New("DalleTool")
+
+var _ imagetool.Generator = (*DalleTool)(nil)
+var _ imagetool.Result = DalleResult{}
+
+const defaultModel = openai.CreateImageModelDallE3
+
+// The most images a call can ask for, when the settings don't say
+const DefaultMaxImages = 4
+
+func init() {
+	chattools.Register(chattools.ToolTypeDalle, func(def chattools.ToolDefinition, env chattools.Env) (chattools.Tool, error) {
+		return New(def, env.Storage)
+	})
+}
+
+// Config holds the settings of a dalle tool definition.
+type Config struct {
+	ApiKey string `yaml:"apiKey,omitempty" json:"apiKey,omitempty"`
+	Model  string `yaml:"model,omitempty" json:"model,omitempty"`
+	// The OpenAI API, or another API that is compatible with it
+	BaseUrl string `yaml:"baseUrl,omitempty" json:"baseUrl,omitempty"`
+	// Added in front of the prompt of every call, e.g. a style
+	PositivePrompt string `yaml:"positivePrompt,omitempty" json:"positivePrompt,omitempty"`
+	// Used when a call does not choose
+	Size    string `yaml:"size,omitempty" json:"size,omitempty"`
+	Quality string `yaml:"quality,omitempty" json:"quality,omitempty"`
+	Style   string `yaml:"style,omitempty" json:"style,omitempty"`
+	// The most images a single call can ask for
+	MaxImages int `yaml:"maxImages,omitempty" json:"maxImages,omitempty"`
+}
+
+// What a model of the images API accepts.
+type modelOptions struct {
+	sizes     []string
+	qualities []string
+	styles    []string
+	// Images per request
+	maxN int
+}
+
+var models = map[string]modelOptions{
+	openai.CreateImageModelDallE2: {
+		sizes: []string{openai.CreateImageSize256x256, openai.CreateImageSize512x512, openai.CreateImageSize1024x1024},
+		maxN:  10,
+	},
+	openai.CreateImageModelDallE3: {
+		sizes:     []string{openai.CreateImageSize1024x1024, openai.CreateImageSize1792x1024, openai.CreateImageSize1024x1792},
+		qualities: []string{openai.CreateImageQualityStandard, openai.CreateImageQualityHD},
+		styles:    []string{openai.CreateImageStyleVivid, openai.CreateImageStyleNatural},
+		maxN:      1,
+	},
+	"gpt-image-1": {
+		sizes:     []string{"1024x1024", "1536x1024", "1024x1536", "auto"},
+		qualities: []string{"low", "medium", "high", "auto"},
+		maxN:      10,
+	},
+}
+
+func New(def chattools.ToolDefinition, store chattools.Storage) (*DalleTool, error) {
+	settings := Config{}
+	err := def.DecodeSettings(&settings)
+	if err != nil {
+		return nil, err
+	}
+
+	if settings.Model == "" {
+		settings.Model = defaultModel
+	}
+	if settings.MaxImages == 0 {
+		settings.MaxImages = DefaultMaxImages
+	}
+
+	clientConfig := openai.DefaultConfig(settings.ApiKey)
+	if settings.BaseUrl != "" {
+		clientConfig.BaseURL = strings.TrimSuffix(settings.BaseUrl, "/")
+	}
+
+	return &DalleTool{
+		Definition: def,
+		Settings:   settings,
+		Store:      store,
+		client:     openai.NewClientWithConfig(clientConfig),
+	}, nil
+}
+
+type DalleTool struct {
+	Definition chattools.ToolDefinition
+	Settings   Config
+	Store      chattools.Storage
+	client     *openai.Client
+}
+
+func (t *DalleTool) Name() string {
+	return t.Definition.Name
+}
+
+func (t *DalleTool) Schema() jsonschema.JsonSchema {
+	options, known := models[t.Settings.Model]
+
+	schema := jsonschema.New()
+	schema.AddString("prompt", "The prompt for the image. Be descriptive. Describe at least the scene, the style and the type of image.", true)
+	addOption(&schema, "size", "The size of the image in pixels, width x height.", options.sizes)
+	addOption(&schema, "quality", "The quality of the image. Higher quality takes longer.", options.qualities)
+	if len(options.styles) > 0 || !known {
+		addOption(&schema, "style", "The style of the image. Vivid is hyper-real and dramatic, natural looks more real.", options.styles)
+	}
+
+	one, most := 1.0, float64(t.Settings.MaxImages)
+	schema.AddInteger("n", "The number of images to generate.", false)
+	schema.Properties["n"].Minimum = &one
+	schema.Properties["n"].Maximum = &most
+	schema.Properties["n"].Default = 1
+	return schema
+}
+
+// Add a string that is one of values, or any string for models this tool does not know.
+func addOption(schema *jsonschema.JsonSchema, name string, description string, values []string) {
+	if len(values) == 0 {
+		schema.AddString(name, description, false)
+		return
+	}
+	schema.AddEnum(name, description, values, false)
+}
+
+// The params of a call
+type dalleParams struct {
+	Prompt  string `json:"prompt"`
+	Size    string `json:"size"`
+	Quality string `json:"quality"`
+	Style   string `json:"style"`
+	N       int    `json:"n"`
+}
+
+type DalleImage struct {
+	Data []byte `yaml:"-"`
+	Path string `yaml:"path"`
+	// The prompt as the model rewrote it
+	RevisedPrompt string `yaml:"revisedPrompt,omitempty"`
+}
+
+type DalleResult struct {
+	Images  []DalleImage `yaml:"images,omitempty"`
+	Model   string       `yaml:"model"`
+	Prompt  string       `yaml:"prompt"`
+	Size    string       `yaml:"size,omitempty"`
+	Quality string       `yaml:"quality,omitempty"`
+	Style   string       `yaml:"style,omitempty"`
+}
+
+// The metadata of an image. The prompt is the one the image was made from, the revised one if there is one.
+func (dr DalleResult) metadata(img DalleImage) imagetool.Metadata {
+	dr.Images = nil
+	prompt := dr.Prompt
+	if img.RevisedPrompt != "" {
+		prompt = img.RevisedPrompt
+	}
+	return imagetool.Metadata{
+		Tool:       chattools.ToolTypeDalle,
+		Model:      dr.Model,
+		Prompt:     prompt,
+		Parameters: dr,
+	}
+}
+
+func (dr DalleResult) Paths() []string {
+	paths := []string{}
+	for _, img := range dr.Images {
+		paths = append(paths, img.Path)
+	}
+	return paths
+}
+
+func (dr DalleResult) String() string {
+	return fmt.Sprintf("DalleResult{ Images: %v, Model: %v}", strings.Join(dr.Paths(), ", "), dr.Model)
+}
+
+func (t *DalleTool) Run(ctx context.Context, call chattools.ToolCall) chattools.ToolResult {
+	params := dalleParams{}
+	err := jsonschema.Decode(call.Params, &params)
+	if err != nil {
+		log.Error("invalid DALL-E call %+v: %v", call.Params, err)
+		return chattools.ToolResult{Success: false, Content: err.Error()}
+	}
+	if params.Prompt == "" {
+		log.Error("missing prompt in DALL-E call %+v", call.Params)
+		return chattools.ToolResult{
+			Success: false,
+			Content: "missing prompt",
+		}
+	}
+
+	return t.generate(ctx, params)
+}
+
+// Generate makes images without a model. DALL-E has no negative prompts or seeds.
+func (t *DalleTool) Generate(ctx context.Context, req imagetool.Request) chattools.ToolResult {
+	if req.Prompt == "" {
+		return chattools.ToolResult{Success: false, Content: "missing prompt"}
+	}
+	if req.NegativePrompt != "" || req.Seed != 0 {
+		log.Warn("%v does not support negative prompts or seeds, they are ignored", t.Settings.Model)
+	}
+	return t.generate(ctx, dalleParams{Prompt: req.Prompt, N: req.N})
+}
+
+func (t *DalleTool) generate(ctx context.Context, params dalleParams) chattools.ToolResult {
+	request := t.request(params)
+	images, err := t.getImages(ctx, request)
+	if err != nil {
+		log.Error("could not generate image: %v", err)
+		return chattools.ToolResult{
+			Success: false,
+			Content: fmt.Sprintf("error while generating image: %v", err),
+		}
+	}
+
+	result := DalleResult{Model: request.Model, Prompt: request.Prompt, Size: request.Size, Quality: request.Quality, Style: request.Style}
+	lines := []string{}
+	for _, img := range images {
+		path, err := imagetool.Save(t.Store, img.Data, result.metadata(img))
+		if err != nil {
+			log.Error("%v", err)
+			return chattools.ToolResult{Success: false, Content: err.Error()}
+		}
+
+		img.Path = path
+		result.Images = append(result.Images, img)
+		lines = append(lines, fmt.Sprintf("Image saved at: %v", path))
+		if img.RevisedPrompt != "" {
+			lines = append(lines, fmt.Sprintf("Revised prompt: %v", img.RevisedPrompt))
+		}
+	}
+
+	return chattools.ToolResult{Success: true, Content: strings.Join(lines, "\n"), Value: result}
+}
+
+// The request for a call, with the settings for what the call does not choose.
+func (t *DalleTool) request(params dalleParams) openai.ImageRequest {
+	request := openai.ImageRequest{
+		Prompt:  strings.TrimSpace(fmt.Sprintf("%v %v", t.Settings.PositivePrompt, params.Prompt)),
+		Model:   t.Settings.Model,
+		N:       1,
+		Size:    t.Settings.Size,
+		Quality: t.Settings.Quality,
+		Style:   t.Settings.Style,
+	}
+
+	if params.Size != "" {
+		request.Size = params.Size
+	}
+	if params.Quality != "" {
+		request.Quality = params.Quality
+	}
+	if params.Style != "" {
+		request.Style = params.Style
+	}
+	if params.N > 0 {
+		request.N = min(params.N, t.Settings.MaxImages)
+	}
+
+	//The images of DALL-E models are links by default, that expire
+	if strings.HasPrefix(request.Model, "dall-e") {
+		request.ResponseFormat = openai.CreateImageResponseFormatB64JSON
+	}
+
+	return request
+}
+
+// Generate the images of request. Models that make fewer images at a time get several requests.
+func (t *DalleTool) getImages(ctx context.Context, request openai.ImageRequest) ([]DalleImage, error) {
+	log.Debug("Image prompt: %v", request.Prompt)
+
+	perRequest := request.N
+	if options, ok := models[request.Model]; ok {
+		perRequest = min(perRequest, options.maxN)
+	}
+
+	images := []DalleImage{}
+	for remaining := request.N; remaining > 0; remaining -= perRequest {
+		req := request
+		req.N = min(remaining, perRequest)
+
+		resp, err := t.client.CreateImage(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, data := range resp.Data {
+			img, err := t.decode(ctx, data)
+			if err != nil {
+				return nil, err
+			}
+			images = append(images, img)
+		}
+	}
+
+	if len(images) == 0 {
+		return nil, fmt.Errorf("the images API returned no images")
+	}
+	return images, nil
+}
+
+func (t *DalleTool) decode(ctx context.Context, data openai.ImageResponseDataInner) (DalleImage, error) {
+	img := DalleImage{RevisedPrompt: data.RevisedPrompt}
+
+	if data.B64JSON != "" {
+		decoded, err := base64.StdEncoding.DecodeString(data.B64JSON)
+		if err != nil {
+			return DalleImage{}, fmt.Errorf("could not decode image: %w", err)
+		}
+		img.Data = decoded
+		return img, nil
+	}
+
+	if data.URL == "" {
+		return DalleImage{}, fmt.Errorf("the images API returned an image without data")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", data.URL, nil)
+	if err != nil {
+		return DalleImage{}, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return DalleImage{}, fmt.Errorf("could not download image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return DalleImage{}, fmt.Errorf("could not download image: status %v", resp.StatusCode)
+	}
+
+	img.Data, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return DalleImage{}, fmt.Errorf("could not download image: %w", err)
+	}
+	return img, nil
+}
@@ -0,0 +1,165 @@
+package dalle
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/c00/botman-v2/chattools"
+	"github.com/c00/botman-v2/internal/storageprovider"
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+var fakeImage = []byte("not really a png")
+
+// A stand-in for the images API, that keeps the requests it gets.
+type fakeApi struct {
+	mu       sync.Mutex
+	requests []openai.ImageRequest
+	// Answer with links to the images instead of the images
+	urls   bool
+	failed bool
+}
+
+func (f *fakeApi) handler(url func() string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/images/generations", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		req := openai.ImageRequest{}
+		json.NewDecoder(r.Body).Decode(&req)
+		f.mu.Lock()
+		f.requests = append(f.requests, req)
+		f.mu.Unlock()
+
+		if f.failed {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": {"message": "Your prompt is not allowed", "type": "invalid_request_error"}}`))
+			return
+		}
+
+		resp := openai.ImageResponse{}
+		for range req.N {
+			data := openai.ImageResponseDataInner{RevisedPrompt: "A revised " + req.Prompt}
+			if f.urls {
+				data.URL = url() + "/image.png"
+			} else {
+				data.B64JSON = base64.StdEncoding.EncodeToString(fakeImage)
+			}
+			resp.Data = append(resp.Data, data)
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+	mux.HandleFunc("GET /image.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(fakeImage)
+	})
+	return mux
+}
+
+func newTestTool(t *testing.T, api *fakeApi, settings Config) (*DalleTool, *storageprovider.MemoryStorage) {
+	var server *httptest.Server
+	server = httptest.NewServer(api.handler(func() string { return server.URL }))
+	t.Cleanup(server.Close)
+
+	settings.ApiKey = "test-key"
+	settings.BaseUrl = server.URL + "/v1"
+	def := chattools.ToolDefinition{ToolType: chattools.ToolTypeDalle, Name: "generate_image"}
+	assert.Nil(t, def.SetSettings(settings))
+
+	store := storageprovider.NewMemStore()
+	tool, err := New(def, store)
+	assert.Nil(t, err)
+	return tool, store
+}
+
+func TestDalleTool_Run(t *testing.T) {
+	api := &fakeApi{}
+	tool, store := newTestTool(t, api, Config{PositivePrompt: "Watercolor.", Quality: "hd"})
+
+	result := tool.Run(context.Background(), chattools.ToolCall{Params: map[string]any{"prompt": "a gopher", "size": "1792x1024", "style": "natural", "n": 2}})
+	assert.True(t, result.Success, result.Content)
+	assert.Contains(t, result.Content, "Revised prompt: A revised Watercolor. a gopher")
+
+	//DALL-E 3 makes one image per request
+	assert.Len(t, api.requests, 2)
+	assert.Equal(t, openai.ImageRequest{
+		Prompt:         "Watercolor. a gopher",
+		Model:          "dall-e-3",
+		N:              1,
+		Quality:        "hd",
+		Size:           "1792x1024",
+		Style:          "natural",
+		ResponseFormat: "b64_json",
+	}, api.requests[0])
+
+	val, ok := result.Value.(DalleResult)
+	assert.True(t, ok)
+	assert.Len(t, val.Images, 2)
+	assert.Equal(t, "1792x1024", val.Size)
+	for _, img := range val.Images {
+		assert.Equal(t, fakeImage, img.Data)
+		data, err := store.Load(img.Path[len("memory::"):])
+		assert.Nil(t, err)
+		assert.Equal(t, fakeImage, data)
+	}
+}
+
+func TestDalleTool_RunUrls(t *testing.T) {
+	api := &fakeApi{urls: true}
+	tool, _ := newTestTool(t, api, Config{Model: "dall-e-2", MaxImages: 2})
+
+	result := tool.Run(context.Background(), chattools.ToolCall{Params: map[string]any{"prompt": "a gopher", "n": 5}})
+	assert.True(t, result.Success, result.Content)
+
+	//At most MaxImages, in a single request
+	assert.Len(t, api.requests, 1)
+	assert.Equal(t, 2, api.requests[0].N)
+
+	val := result.Value.(DalleResult)
+	assert.Len(t, val.Images, 2)
+	assert.Equal(t, fakeImage, val.Images[0].Data)
+}
+
+func TestDalleTool_RunFailed(t *testing.T) {
+	tool, _ := newTestTool(t, &fakeApi{failed: true}, Config{})
+
+	result := tool.Run(context.Background(), chattools.ToolCall{Params: map[string]any{"prompt": "a gopher"}})
+	assert.False(t, result.Success)
+	assert.Contains(t, result.Content, "Your prompt is not allowed")
+
+	result = tool.Run(context.Background(), chattools.ToolCall{Params: map[string]any{}})
+	assert.False(t, result.Success)
+	assert.Equal(t, "missing prompt", result.Content)
+
+	//The model gets the actual problem
+	result = tool.Run(context.Background(), chattools.ToolCall{Params: map[string]any{"prompt": "a gopher", "n": "two"}})
+	assert.False(t, result.Success)
+	assert.Contains(t, result.Content, "could not decode params")
+}
+
+func TestDalleTool_Schema(t *testing.T) {
+	tool, _ := newTestTool(t, &fakeApi{}, Config{})
+	schema := tool.Schema()
+	assert.Equal(t, []string{"prompt"}, schema.Required)
+	assert.Equal(t, []any{"vivid", "natural"}, schema.Properties["style"].Enum)
+	assert.Equal(t, 4.0, *schema.Properties["n"].Maximum)
+
+	tool, _ = newTestTool(t, &fakeApi{}, Config{Model: "dall-e-2"})
+	schema = tool.Schema()
+	assert.Nil(t, schema.Properties["style"])
+	assert.Len(t, schema.Properties["size"].Enum, 3)
+
+	//Any value for models the tool does not know
+	tool, _ = newTestTool(t, &fakeApi{}, Config{Model: "image-model-9"})
+	schema = tool.Schema()
+	assert.Empty(t, schema.Properties["size"].Enum)
+	assert.NotNil(t, schema.Properties["style"])
+}
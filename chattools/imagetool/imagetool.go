@@ -0,0 +1,88 @@
+// Package imagetool has what the image generating tools share.
+package imagetool
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/c00/botman-v2/chattools"
+	"github.com/c00/botman-v2/internal/logger"
+)
+
+var log = logger.New("imagetool")
+
+// Request is a request for images that does not come from a model, e.g. from the command line.
+type Request struct {
+	Prompt         string
+	NegativePrompt string
+	// The number of images. 0 is the default of the tool.
+	N int
+	// 0 is a random seed
+	Seed uint32
+}
+
+// Generator is an image tool that can be called without a model.
+type Generator interface {
+	chattools.Tool
+	Generate(ctx context.Context, req Request) chattools.ToolResult
+}
+
+// Result is the value of the result of an image tool.
+type Result interface {
+	// Where the images were saved
+	Paths() []string
+}
+
+// Prompts are added in front of the prompts of every call of an image tool, e.g. a style.
+type Prompts struct {
+	PositivePrompt string `yaml:"positivePrompt" json:"positivePrompt"`
+	NegativePrompt string `yaml:"negativePrompt" json:"negativePrompt"`
+}
+
+// Apply returns the full prompts of a call.
+func (p Prompts) Apply(prompt string, negativePrompt string) (string, string) {
+	return join(p.PositivePrompt, prompt), join(p.NegativePrompt, negativePrompt)
+}
+
+func join(prefix string, prompt string) string {
+	return strings.TrimSpace(fmt.Sprintf("%v %v", prefix, prompt))
+}
+
+// Save stores a generated image with its metadata under a new name, and returns its path.
+// An image the metadata cannot be added to is saved without it.
+func Save(store chattools.Storage, data []byte, meta Metadata) (string, error) {
+	if store == nil {
+		return "", fmt.Errorf("no storage to save images to")
+	}
+
+	withMeta, err := Embed(data, meta)
+	if err != nil {
+		log.Warn("could not add metadata to image: %v", err)
+	} else {
+		data = withMeta
+	}
+
+	filename := fmt.Sprintf("image-%v-%v%v", time.Now().Format(time.RFC3339), rand.Intn(1000), Extension(data))
+	path, err := store.Save(filename, data)
+	if err != nil {
+		return path, fmt.Errorf("error while saving image to %v: %w", path, err)
+	}
+	return path, nil
+}
+
+// Extension returns the file extension of image data.
+func Extension(data []byte) string {
+	switch http.DetectContentType(data) {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/webp":
+		return ".webp"
+	case "image/gif":
+		return ".gif"
+	}
+	return ".png"
+}
@@ -0,0 +1,349 @@
+package imagetool
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Metadata records how an image was generated, so it can be made again.
+type Metadata struct {
+	Tool           string
+	Model          string
+	Prompt         string
+	NegativePrompt string
+	Seed           uint32
+	// All parameters of the generation. Written as YAML.
+	Parameters any
+}
+
+// Field is a text field in the metadata of an image.
+type Field struct {
+	Key   string
+	Value string
+}
+
+// Fields returns the fields that have a value.
+func (m Metadata) Fields() []Field {
+	fields := []Field{
+		{"Tool", m.Tool},
+		{"Model", m.Model},
+		{"Prompt", m.Prompt},
+		{"NegativePrompt", m.NegativePrompt},
+	}
+	if m.Seed != 0 {
+		fields = append(fields, Field{"Seed", strconv.FormatUint(uint64(m.Seed), 10)})
+	}
+	if m.Parameters != nil {
+		params, err := yaml.Marshal(m.Parameters)
+		if err == nil {
+			fields = append(fields, Field{"Parameters", strings.TrimSpace(string(params))})
+		}
+	}
+
+	result := []Field{}
+	for _, f := range fields {
+		if f.Value != "" {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// Embed returns image data with the metadata in it. PNG images get text chunks, JPEG images XMP.
+// Other images are returned as they are.
+func Embed(data []byte, meta Metadata) ([]byte, error) {
+	switch http.DetectContentType(data) {
+	case "image/png":
+		return embedPng(data, meta.Fields())
+	case "image/jpeg":
+		return embedJpeg(data, meta.Fields())
+	}
+	return data, nil
+}
+
+// ReadFields returns the text fields in the metadata of a PNG or JPEG image.
+// For PNG that includes the fields other programs wrote.
+func ReadFields(data []byte) ([]Field, error) {
+	contentType := http.DetectContentType(data)
+	switch contentType {
+	case "image/png":
+		return readPng(data)
+	case "image/jpeg":
+		return readJpeg(data)
+	}
+	return nil, fmt.Errorf("cannot read metadata of %v", contentType)
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+type pngChunk struct {
+	Type string
+	Data []byte
+	// Where the chunk ends in the file
+	End int
+}
+
+// Reads the chunk at offset.
+func readPngChunk(data []byte, offset int) (pngChunk, error) {
+	if offset+8 > len(data) {
+		return pngChunk{}, errors.New("png ends in a chunk header")
+	}
+	length := int(binary.BigEndian.Uint32(data[offset:]))
+	end := offset + 12 + length
+	if length < 0 || end > len(data) {
+		return pngChunk{}, errors.New("png ends in a chunk")
+	}
+	return pngChunk{Type: string(data[offset+4 : offset+8]), Data: data[offset+8 : offset+8+length], End: end}, nil
+}
+
+func writePngChunk(w *bytes.Buffer, chunkType string, data []byte) {
+	binary.Write(w, binary.BigEndian, uint32(len(data)))
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(chunkType))
+	crc.Write(data)
+	w.WriteString(chunkType)
+	w.Write(data)
+	binary.Write(w, binary.BigEndian, crc.Sum32())
+}
+
+// Adds the fields after the header chunk. Plain text goes in tEXt chunks, anything else in iTXt.
+func embedPng(data []byte, fields []Field) ([]byte, error) {
+	header, err := readPngChunk(data, len(pngSignature))
+	if err != nil {
+		return nil, err
+	}
+	if header.Type != "IHDR" {
+		return nil, errors.New("png does not start with a header chunk")
+	}
+
+	out := &bytes.Buffer{}
+	out.Write(data[:header.End])
+	for _, f := range fields {
+		if isAscii(f.Value) {
+			writePngChunk(out, "tEXt", []byte(f.Key+"\x00"+f.Value))
+		} else {
+			//Not compressed, no language, no translated keyword
+			writePngChunk(out, "iTXt", []byte(f.Key+"\x00\x00\x00\x00\x00"+f.Value))
+		}
+	}
+	out.Write(data[header.End:])
+	return out.Bytes(), nil
+}
+
+func readPng(data []byte) ([]Field, error) {
+	fields := []Field{}
+	for offset := len(pngSignature); offset < len(data); {
+		chunk, err := readPngChunk(data, offset)
+		if err != nil {
+			return nil, err
+		}
+		offset = chunk.End
+
+		var field Field
+		switch chunk.Type {
+		case "tEXt":
+			key, value, _ := bytes.Cut(chunk.Data, []byte{0})
+			field = Field{string(key), latin1(value)}
+		case "zTXt":
+			key, value, _ := bytes.Cut(chunk.Data, []byte{0})
+			if len(value) == 0 {
+				continue
+			}
+			text, err := inflate(value[1:])
+			if err != nil {
+				return nil, fmt.Errorf("could not read %v: %w", string(key), err)
+			}
+			field = Field{string(key), latin1(text)}
+		case "iTXt":
+			field, err = readITxt(chunk.Data)
+			if err != nil {
+				return nil, err
+			}
+		case "IEND":
+			return fields, nil
+		default:
+			continue
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+func readITxt(data []byte) (Field, error) {
+	key, rest, _ := bytes.Cut(data, []byte{0})
+	if len(rest) < 2 {
+		return Field{}, fmt.Errorf("invalid iTXt chunk %v", string(key))
+	}
+	compressed := rest[0] == 1
+	//Skip the compression flag and method, the language and the translated keyword
+	_, rest, _ = bytes.Cut(rest[2:], []byte{0})
+	_, text, _ := bytes.Cut(rest, []byte{0})
+
+	if compressed {
+		var err error
+		text, err = inflate(text)
+		if err != nil {
+			return Field{}, fmt.Errorf("could not read %v: %w", string(key), err)
+		}
+	}
+	return Field{string(key), string(text)}, nil
+}
+
+func inflate(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func isAscii(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+func latin1(data []byte) string {
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+const xmpHeader = "http://ns.adobe.com/xap/1.0/\x00"
+const xmpNamespace = "https://github.com/c00/botman-v2/"
+
+// Adds an XMP segment after the start of the image, and after the JFIF segment if there is one.
+func embedJpeg(data []byte, fields []Field) ([]byte, error) {
+	if len(data) < 4 {
+		return nil, errors.New("jpeg is too short")
+	}
+
+	offset := 2
+	if data[2] == 0xFF && data[3] == 0xE0 {
+		segment, err := readJpegSegment(data, offset)
+		if err != nil {
+			return nil, err
+		}
+		offset = segment.End
+	}
+
+	xmp := &bytes.Buffer{}
+	xmp.WriteString(`<?xpacket begin="` + "\uFEFF" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>`)
+	xmp.WriteString(`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">`)
+	xmp.WriteString(`<rdf:Description rdf:about="" xmlns:botman="` + xmpNamespace + `">`)
+	for _, f := range fields {
+		xmp.WriteString("<botman:" + f.Key + ">")
+		xml.EscapeText(xmp, []byte(f.Value))
+		xmp.WriteString("</botman:" + f.Key + ">")
+	}
+	xmp.WriteString(`</rdf:Description></rdf:RDF></x:xmpmeta><?xpacket end="w"?>`)
+
+	length := 2 + len(xmpHeader) + xmp.Len()
+	if length > 0xFFFF {
+		return nil, errors.New("metadata does not fit in a jpeg segment")
+	}
+
+	out := &bytes.Buffer{}
+	out.Write(data[:offset])
+	out.Write([]byte{0xFF, 0xE1})
+	binary.Write(out, binary.BigEndian, uint16(length))
+	out.WriteString(xmpHeader)
+	out.Write(xmp.Bytes())
+	out.Write(data[offset:])
+	return out.Bytes(), nil
+}
+
+type jpegSegment struct {
+	Marker byte
+	Data   []byte
+	End    int
+}
+
+func readJpegSegment(data []byte, offset int) (jpegSegment, error) {
+	if offset+4 > len(data) || data[offset] != 0xFF {
+		return jpegSegment{}, errors.New("invalid jpeg segment")
+	}
+	length := int(binary.BigEndian.Uint16(data[offset+2:]))
+	end := offset + 2 + length
+	if length < 2 || end > len(data) {
+		return jpegSegment{}, errors.New("jpeg ends in a segment")
+	}
+	return jpegSegment{Marker: data[offset+1], Data: data[offset+4 : end], End: end}, nil
+}
+
+// Reads the botman fields of the XMP segments, up to the image data.
+func readJpeg(data []byte) ([]Field, error) {
+	fields := []Field{}
+	for offset := 2; offset < len(data); {
+		//Start of scan, the rest is the image
+		if offset+1 < len(data) && data[offset+1] == 0xDA {
+			break
+		}
+
+		segment, err := readJpegSegment(data, offset)
+		if err != nil {
+			return nil, err
+		}
+		offset = segment.End
+
+		if segment.Marker != 0xE1 || !bytes.HasPrefix(segment.Data, []byte(xmpHeader)) {
+			continue
+		}
+		xmpFields, err := readXmp(segment.Data[len(xmpHeader):])
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, xmpFields...)
+	}
+	return fields, nil
+}
+
+func readXmp(data []byte) ([]Field, error) {
+	fields := []Field{}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var current *Field
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return fields, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read xmp: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			current = nil
+			if t.Name.Space == xmpNamespace {
+				current = &Field{Key: t.Name.Local}
+			}
+		case xml.CharData:
+			if current != nil {
+				current.Value += string(t)
+			}
+		case xml.EndElement:
+			if current != nil {
+				fields = append(fields, *current)
+				current = nil
+			}
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package imagetool
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/c00/botman-v2/internal/storageprovider"
+	"github.com/stretchr/testify/assert"
+)
+
+func testImage() image.Image {
+	return image.NewRGBA(image.Rect(0, 0, 4, 4))
+}
+
+func testMetadata() Metadata {
+	return Metadata{
+		Tool:           "sdxl",
+		Model:          "stable-diffusion-xl-1024-v1-0",
+		Prompt:         "a café <at night> & a gopher",
+		NegativePrompt: "blurry",
+		Seed:           42,
+		Parameters:     map[string]any{"steps": 30, "seed": 42},
+	}
+}
+
+func TestMetadata_Fields(t *testing.T) {
+	assert.Equal(t, []Field{
+		{"Tool", "sdxl"},
+		{"Model", "stable-diffusion-xl-1024-v1-0"},
+		{"Prompt", "a café <at night> & a gopher"},
+		{"NegativePrompt", "blurry"},
+		{"Seed", "42"},
+		{"Parameters", "seed: 42\nsteps: 30"},
+	}, testMetadata().Fields())
+
+	//Empty fields are left out
+	assert.Equal(t, []Field{{"Prompt", "a gopher"}}, Metadata{Prompt: "a gopher"}.Fields())
+}
+
+func TestEmbed_Png(t *testing.T) {
+	buf := &bytes.Buffer{}
+	assert.Nil(t, png.Encode(buf, testImage()))
+
+	data, err := Embed(buf.Bytes(), testMetadata())
+	assert.Nil(t, err)
+
+	//Still a valid image
+	_, err = png.Decode(bytes.NewReader(data))
+	assert.Nil(t, err)
+
+	fields, err := ReadFields(data)
+	assert.Nil(t, err)
+	assert.Equal(t, testMetadata().Fields(), fields)
+}
+
+func TestEmbed_Jpeg(t *testing.T) {
+	buf := &bytes.Buffer{}
+	assert.Nil(t, jpeg.Encode(buf, testImage(), nil))
+
+	data, err := Embed(buf.Bytes(), testMetadata())
+	assert.Nil(t, err)
+
+	_, err = jpeg.Decode(bytes.NewReader(data))
+	assert.Nil(t, err)
+
+	fields, err := ReadFields(data)
+	assert.Nil(t, err)
+	assert.Equal(t, testMetadata().Fields(), fields)
+}
+
+func TestEmbed_Other(t *testing.T) {
+	data := []byte("GIF89a not really a gif")
+	got, err := Embed(data, testMetadata())
+	assert.Nil(t, err)
+	assert.Equal(t, data, got)
+
+	_, err = ReadFields(data)
+	assert.ErrorContains(t, err, "cannot read metadata of image/gif")
+
+	//Broken images
+	_, err = Embed([]byte("\x89PNG\r\n\x1a\nnot really a png"), testMetadata())
+	assert.NotNil(t, err)
+}
+
+func TestReadFields_OtherPrograms(t *testing.T) {
+	buf := &bytes.Buffer{}
+	assert.Nil(t, png.Encode(buf, testImage()))
+	data := buf.Bytes()
+
+	//A tEXt chunk in Latin-1, like other tools write
+	header, err := readPngChunk(data, len(pngSignature))
+	assert.Nil(t, err)
+	out := &bytes.Buffer{}
+	out.Write(data[:header.End])
+	writePngChunk(out, "tEXt", []byte("parameters\x00caf\xe9, Steps: 20"))
+	out.Write(data[header.End:])
+
+	fields, err := ReadFields(out.Bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, []Field{{"parameters", "café, Steps: 20"}}, fields)
+}
+
+func TestSave(t *testing.T) {
+	buf := &bytes.Buffer{}
+	assert.Nil(t, png.Encode(buf, testImage()))
+
+	store := storageprovider.NewMemStore()
+	path, err := Save(store, buf.Bytes(), Metadata{Prompt: "a gopher"})
+	assert.Nil(t, err)
+	assert.Regexp(t, `image-.*\.png$`, path)
+
+	data, err := store.Load(path[len("memory::"):])
+	assert.Nil(t, err)
+	fields, err := ReadFields(data)
+	assert.Nil(t, err)
+	assert.Equal(t, []Field{{"Prompt", "a gopher"}}, fields)
+
+	//Images without room for metadata are saved as they are
+	path, err = Save(store, []byte("\x89PNG\r\n\x1a\nnot really a png"), Metadata{Prompt: "a gopher"})
+	assert.Nil(t, err)
+	data, _ = store.Load(path[len("memory::"):])
+	assert.Equal(t, []byte("\x89PNG\r\n\x1a\nnot really a png"), data)
+
+	_, err = Save(nil, buf.Bytes(), Metadata{})
+	assert.ErrorContains(t, err, "no storage")
+}
@@ -0,0 +1,21 @@
+package imagetool
+
+// Paths returns where the images of a tool result value were saved. Values loaded from history are
+// maps, with the images of the result under "images".
+func Paths(value any) []string {
+	switch v := value.(type) {
+	case Result:
+		return v.Paths()
+	case map[string]any:
+		images, _ := v["images"].([]any)
+		paths := []string{}
+		for _, img := range images {
+			fields, _ := img.(map[string]any)
+			if path, ok := fields["path"].(string); ok && path != "" {
+				paths = append(paths, path)
+			}
+		}
+		return paths
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package imagetool
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+type testResult struct {
+	Images []struct {
+		Path string `yaml:"path"`
+	} `yaml:"images"`
+}
+
+func (r testResult) Paths() []string {
+	paths := []string{}
+	for _, img := range r.Images {
+		paths = append(paths, img.Path)
+	}
+	return paths
+}
+
+func TestPaths(t *testing.T) {
+	result := testResult{}
+	assert.Nil(t, yaml.Unmarshal([]byte("images: [{path: a.png}, {path: b.png}]"), &result))
+	assert.Equal(t, []string{"a.png", "b.png"}, Paths(result))
+
+	//As it comes out of history
+	var value any
+	data, _ := yaml.Marshal(result)
+	assert.Nil(t, yaml.Unmarshal(data, &value))
+	assert.Equal(t, []string{"a.png", "b.png"}, Paths(value))
+
+	assert.Empty(t, Paths("Image saved at: a.png"))
+	assert.Empty(t, Paths(map[string]any{"images": "a.png"}))
+}
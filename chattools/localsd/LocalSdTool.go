@@ -0,0 +1,330 @@
+package localsd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/c00/botman-v2/chattools"
+	"github.com/c00/botman-v2/chattools/imagetool"
+	"github.com/c00/botman-v2/internal/logger"
+	"github.com/c00/botman-v2/jsonschema"
+)
+
+var log = logger.New("LocalSdTool")
+
+var _ imagetool.Generator = (*LocalSdTool)(nil)
+var _ imagetool.Result = Result{}
+
+const (
+	BackendAutomatic1111 = "automatic1111"
+	BackendComfyUi       = "comfyui"
+)
+
+const (
+	DefaultSize       = 1024
+	DefaultSteps      = 30
+	DefaultCfgScale   = 7
+	DefaultMaxSamples = 4
+)
+
+var defaultUrls = map[string]string{
+	BackendAutomatic1111: "http://127.0.0.1:7860",
+	BackendComfyUi:       "http://127.0.0.1:8188",
+}
+
+func init() {
+	chattools.Register(chattools.ToolTypeLocalSd, func(def chattools.ToolDefinition, env chattools.Env) (chattools.Tool, error) {
+		return New(def, env.Storage)
+	})
+}
+
+// Config holds the settings of a localsd tool definition. Most are defaults for calls that don't choose.
+type Config struct {
+	imagetool.Prompts `yaml:",inline"`
+	// BackendAutomatic1111 (default) or BackendComfyUi
+	Backend string `yaml:"backend,omitempty" json:"backend,omitempty"`
+	// The API of the server. Defaults to the port the backend listens on, on this machine.
+	Url string `yaml:"url,omitempty" json:"url,omitempty"`
+	// ComfyUI only: a workflow file in API format, with placeholders like {{prompt}}
+	Workflow string  `yaml:"workflow,omitempty" json:"workflow,omitempty"`
+	Width    int     `yaml:"width,omitempty" json:"width,omitempty"`
+	Height   int     `yaml:"height,omitempty" json:"height,omitempty"`
+	Steps    int     `yaml:"steps,omitempty" json:"steps,omitempty"`
+	CfgScale float64 `yaml:"cfgScale,omitempty" json:"cfgScale,omitempty"`
+	Sampler  string  `yaml:"sampler,omitempty" json:"sampler,omitempty"`
+	// 0 is a random seed for every call
+	Seed    uint32 `yaml:"seed,omitempty" json:"seed,omitempty"`
+	Samples int    `yaml:"samples,omitempty" json:"samples,omitempty"`
+	// The most samples a call can ask for
+	MaxSamples int `yaml:"maxSamples,omitempty" json:"maxSamples,omitempty"`
+}
+
+func New(def chattools.ToolDefinition, store chattools.Storage) (*LocalSdTool, error) {
+	settings := Config{}
+	err := def.DecodeSettings(&settings)
+	if err != nil {
+		return nil, err
+	}
+
+	if settings.Backend == "" {
+		settings.Backend = BackendAutomatic1111
+	}
+	if _, ok := defaultUrls[settings.Backend]; !ok {
+		return nil, fmt.Errorf("invalid settings for tool %v: unknown backend %v, use %v or %v", def.Name, settings.Backend, BackendAutomatic1111, BackendComfyUi)
+	}
+	if settings.Url == "" {
+		settings.Url = defaultUrls[settings.Backend]
+	}
+	settings.Url = strings.TrimSuffix(settings.Url, "/")
+	if settings.Width == 0 {
+		settings.Width = DefaultSize
+	}
+	if settings.Height == 0 {
+		settings.Height = DefaultSize
+	}
+	if settings.Steps == 0 {
+		settings.Steps = DefaultSteps
+	}
+	if settings.CfgScale == 0 {
+		settings.CfgScale = DefaultCfgScale
+	}
+	if settings.Samples == 0 {
+		settings.Samples = 1
+	}
+	if settings.MaxSamples == 0 {
+		settings.MaxSamples = max(DefaultMaxSamples, settings.Samples)
+	}
+
+	tool := &LocalSdTool{
+		Definition: def,
+		Settings:   settings,
+		Store:      store,
+	}
+
+	if settings.Backend == BackendComfyUi {
+		tool.workflow, err = loadWorkflow(settings.Workflow)
+		if err != nil {
+			return nil, fmt.Errorf("invalid settings for tool %v: %w", def.Name, err)
+		}
+	}
+
+	return tool, nil
+}
+
+type LocalSdTool struct {
+	Definition chattools.ToolDefinition
+	Settings   Config
+	Store      chattools.Storage
+	//The ComfyUI workflow
+	workflow map[string]any
+}
+
+func (t *LocalSdTool) Name() string {
+	return t.Definition.Name
+}
+
+// The params of a call
+type localSdParams struct {
+	Prompt         string `json:"prompt"`
+	NegativePrompt string `json:"negativePrompt"`
+	Seed           uint32 `json:"seed"`
+	Samples        int    `json:"samples"`
+}
+
+func (t *LocalSdTool) Schema() jsonschema.JsonSchema {
+	schema := jsonschema.New()
+	schema.AddString("prompt", "The positive prompt for the image. Be descriptive. Describe at least the scene, the quality, the type of image.", true)
+	schema.AddString("negativePrompt", "The negative prompt for the image. Optionally add things you don't want in the image.", false)
+
+	zero, maxSeed := 0.0, float64(^uint32(0))
+	schema.AddInteger("seed", "The seed of the image. Use the seed of an earlier image to make a variation of it. Leave it out for a random seed.", false)
+	schema.Properties["seed"].Minimum = &zero
+	schema.Properties["seed"].Maximum = &maxSeed
+
+	one, maxSamples := 1.0, float64(t.Settings.MaxSamples)
+	schema.AddInteger("samples", "The number of images to generate.", false)
+	schema.Properties["samples"].Minimum = &one
+	schema.Properties["samples"].Maximum = &maxSamples
+	return schema
+}
+
+// Params are all the parameters images were generated with, to generate them again.
+type Params struct {
+	Backend        string  `yaml:"backend"`
+	Workflow       string  `yaml:"workflow,omitempty"`
+	Prompt         string  `yaml:"prompt"`
+	NegativePrompt string  `yaml:"negativePrompt,omitempty"`
+	Width          int     `yaml:"width"`
+	Height         int     `yaml:"height"`
+	Steps          int     `yaml:"steps"`
+	CfgScale       float64 `yaml:"cfgScale"`
+	Sampler        string  `yaml:"sampler,omitempty"`
+	Seed           uint32  `yaml:"seed"`
+	Samples        int     `yaml:"samples"`
+	// The image of the batch, for ComfyUI
+	BatchIndex int `yaml:"batchIndex,omitempty"`
+}
+
+// The metadata of an image, with the params to make it again. Automatic1111 gives every image of a batch
+// a seed of its own, that makes just that image. ComfyUI seeds the batch, the image is the one at
+// BatchIndex of the batch.
+func (p Params) metadata(img Image) imagetool.Metadata {
+	if p.Backend == BackendComfyUi {
+		p.BatchIndex = img.BatchIndex
+	} else {
+		p.Seed = img.Seed
+		p.Samples = 1
+	}
+	model := p.Backend
+	if p.Workflow != "" {
+		model = fmt.Sprintf("%v %v", p.Backend, filepath.Base(p.Workflow))
+	}
+	return imagetool.Metadata{
+		Tool:           chattools.ToolTypeLocalSd,
+		Model:          model,
+		Prompt:         p.Prompt,
+		NegativePrompt: p.NegativePrompt,
+		Seed:           p.Seed,
+		Parameters:     p,
+	}
+}
+
+type Image struct {
+	Data []byte `yaml:"-"`
+	Path string `yaml:"path"`
+	Seed uint32 `yaml:"seed"`
+	// Where the image is in the batch of the seed, for backends that seed a batch
+	BatchIndex int `yaml:"batchIndex,omitempty"`
+}
+
+type Result struct {
+	Images []Image `yaml:"images"`
+	Params Params  `yaml:"params"`
+}
+
+func (r Result) Paths() []string {
+	paths := []string{}
+	for _, img := range r.Images {
+		paths = append(paths, img.Path)
+	}
+	return paths
+}
+
+func (r Result) String() string {
+	images := []string{}
+	for _, img := range r.Images {
+		images = append(images, fmt.Sprintf("%v (len(%v), seed %v)", img.Path, len(img.Data), img.Seed))
+	}
+	return fmt.Sprintf("LocalSdResult{ Images: %v, Backend: %v}", strings.Join(images, ", "), r.Params.Backend)
+}
+
+func (t *LocalSdTool) Run(ctx context.Context, call chattools.ToolCall) chattools.ToolResult {
+	callParams := localSdParams{}
+	err := jsonschema.Decode(call.Params, &callParams)
+	if err != nil {
+		log.Error("invalid call %+v: %v", call.Params, err)
+		return chattools.ToolResult{Success: false, Content: err.Error()}
+	}
+	if callParams.Prompt == "" {
+		log.Error("missing prompt in call %+v", call.Params)
+		return chattools.ToolResult{
+			Success: false,
+			Content: "missing prompt",
+		}
+	}
+
+	return t.generate(ctx, callParams)
+}
+
+// Generate makes images without a model.
+func (t *LocalSdTool) Generate(ctx context.Context, req imagetool.Request) chattools.ToolResult {
+	if req.Prompt == "" {
+		return chattools.ToolResult{Success: false, Content: "missing prompt"}
+	}
+	return t.generate(ctx, localSdParams{Prompt: req.Prompt, NegativePrompt: req.NegativePrompt, Seed: req.Seed, Samples: req.N})
+}
+
+func (t *LocalSdTool) generate(ctx context.Context, callParams localSdParams) chattools.ToolResult {
+	params := t.params(callParams)
+
+	var images []Image
+	var err error
+	if t.Settings.Backend == BackendComfyUi {
+		images, err = t.comfyUi(ctx, params)
+	} else {
+		images, err = t.automatic1111(ctx, params)
+	}
+	if err != nil {
+		log.Error("could not generate image: %v", err)
+		return chattools.ToolResult{
+			Success: false,
+			Content: fmt.Sprintf("error while generating image: %v", err),
+		}
+	}
+
+	lines := []string{}
+	for i, img := range images {
+		path, err := imagetool.Save(t.Store, img.Data, params.metadata(img))
+		if err != nil {
+			log.Error("%v", err)
+			return chattools.ToolResult{Success: false, Content: err.Error()}
+		}
+
+		images[i].Path = path
+		lines = append(lines, fmt.Sprintf("Image saved at: %v (seed %v)", path, img.Seed))
+	}
+
+	return chattools.ToolResult{Success: true, Content: strings.Join(lines, "\n"), Value: Result{Images: images, Params: params}}
+}
+
+// The parameters for a call, with the settings for what the call does not choose.
+func (t *LocalSdTool) params(call localSdParams) Params {
+	params := Params{
+		Backend:  t.Settings.Backend,
+		Workflow: t.Settings.Workflow,
+		Width:    t.Settings.Width,
+		Height:   t.Settings.Height,
+		Steps:    t.Settings.Steps,
+		CfgScale: t.Settings.CfgScale,
+		Sampler:  t.Settings.Sampler,
+		Seed:     t.Settings.Seed,
+		Samples:  t.Settings.Samples,
+	}
+	params.Prompt, params.NegativePrompt = t.Settings.Apply(call.Prompt, call.NegativePrompt)
+
+	if call.Samples > 0 {
+		params.Samples = min(call.Samples, t.Settings.MaxSamples)
+	}
+	if call.Seed > 0 {
+		params.Seed = call.Seed
+	}
+	//Choose the random seed here, so it can be recorded
+	if params.Seed == 0 {
+		params.Seed = uint32(rand.Int63n(int64(^uint32(0)))) + 1
+	}
+
+	return params
+}
+
+func loadWorkflow(path string) (map[string]any, error) {
+	if path == "" {
+		return nil, fmt.Errorf("the comfyui backend needs a workflow")
+	}
+
+	data, err := os.ReadFile(chattools.ExpandHome(path))
+	if err != nil {
+		return nil, fmt.Errorf("could not read workflow: %w", err)
+	}
+
+	workflow := map[string]any{}
+	err = json.Unmarshal(data, &workflow)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse workflow %v: %w", path, err)
+	}
+	return workflow, nil
+}
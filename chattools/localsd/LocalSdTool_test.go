@@ -0,0 +1,262 @@
+package localsd
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/c00/botman-v2/chattools"
+	"github.com/c00/botman-v2/chattools/imagetool"
+	"github.com/c00/botman-v2/internal/storageprovider"
+	"github.com/stretchr/testify/assert"
+)
+
+var fakePng = []byte("\x89PNG\r\n\x1a\nnot really a png")
+
+func newTestTool(t *testing.T, api http.Handler, settings Config) (*LocalSdTool, *storageprovider.MemoryStorage) {
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	settings.Url = server.URL + "/"
+	def := chattools.ToolDefinition{ToolType: chattools.ToolTypeLocalSd, Name: "generate_image"}
+	assert.Nil(t, def.SetSettings(settings))
+
+	store := storageprovider.NewMemStore()
+	tool, err := New(def, store)
+	assert.Nil(t, err)
+	return tool, store
+}
+
+func TestLocalSdTool_Automatic1111(t *testing.T) {
+	var got map[string]any
+	api := http.NewServeMux()
+	api.HandleFunc("POST /sdapi/v1/txt2img", func(w http.ResponseWriter, r *http.Request) {
+		got = map[string]any{}
+		json.NewDecoder(r.Body).Decode(&got)
+
+		img := base64.StdEncoding.EncodeToString(fakePng)
+		//Two images, and a grid of them
+		json.NewEncoder(w).Encode(txt2imgResponse{
+			Images: []string{img, img, img},
+			Info:   `{"all_seeds": [42, 43]}`,
+		})
+	})
+
+	tool, store := newTestTool(t, api, Config{Prompts: imagetool.Prompts{PositivePrompt: "Anime.", NegativePrompt: "blurry"}, Steps: 20, Sampler: "Euler a"})
+	result := tool.Run(context.Background(), chattools.ToolCall{Params: map[string]any{"prompt": "a gopher", "seed": 42, "samples": 2}})
+	assert.True(t, result.Success, result.Content)
+	assert.Contains(t, result.Content, "seed 43")
+
+	assert.Equal(t, map[string]any{
+		"prompt":          "Anime. a gopher",
+		"negative_prompt": "blurry",
+		"seed":            42.0,
+		"steps":           20.0,
+		"cfg_scale":       7.0,
+		"width":           1024.0,
+		"height":          1024.0,
+		"sampler_name":    "Euler a",
+		"batch_size":      2.0,
+	}, got)
+
+	val, ok := result.Value.(Result)
+	assert.True(t, ok)
+	assert.Equal(t, BackendAutomatic1111, val.Params.Backend)
+	//Not the grid
+	assert.Len(t, val.Images, 2)
+	for i, img := range val.Images {
+		assert.Equal(t, uint32(42+i), img.Seed)
+		data, err := store.Load(img.Path[len("memory::"):])
+		assert.Nil(t, err)
+		assert.Equal(t, fakePng, data)
+	}
+}
+
+func TestLocalSdTool_Generate(t *testing.T) {
+	var got map[string]any
+	tool, _ := newTestTool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = map[string]any{}
+		json.NewDecoder(r.Body).Decode(&got)
+		img := base64.StdEncoding.EncodeToString(fakePng)
+		json.NewEncoder(w).Encode(txt2imgResponse{Images: []string{img, img, img}})
+	}), Config{})
+
+	result := tool.Generate(context.Background(), imagetool.Request{Prompt: "a gopher", NegativePrompt: "blurry", N: 3, Seed: 42})
+	assert.True(t, result.Success, result.Content)
+	assert.Equal(t, "blurry", got["negative_prompt"])
+	assert.Equal(t, 3.0, got["batch_size"])
+	assert.Equal(t, 42.0, got["seed"])
+
+	//Without info, the seeds follow the first
+	val := result.Value.(Result)
+	assert.Len(t, val.Paths(), 3)
+	assert.Equal(t, uint32(44), val.Images[2].Seed)
+
+	result = tool.Generate(context.Background(), imagetool.Request{})
+	assert.False(t, result.Success)
+}
+
+func TestLocalSdTool_Automatic1111Failed(t *testing.T) {
+	tool, _ := newTestTool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error": "OutOfMemoryError"}`))
+	}), Config{})
+
+	result := tool.Run(context.Background(), chattools.ToolCall{Params: map[string]any{"prompt": "a gopher"}})
+	assert.False(t, result.Success)
+	assert.Contains(t, result.Content, `automatic1111 responded with 500: {"error": "OutOfMemoryError"}`)
+
+	result = tool.Run(context.Background(), chattools.ToolCall{Params: map[string]any{}})
+	assert.False(t, result.Success)
+	assert.Equal(t, "missing prompt", result.Content)
+
+	result = tool.Run(context.Background(), chattools.ToolCall{Params: map[string]any{"prompt": "a gopher", "seed": "random"}})
+	assert.False(t, result.Success)
+	assert.Contains(t, result.Content, "could not decode params")
+}
+
+const testWorkflow = `{
+	"3": {"class_type": "KSampler", "inputs": {"seed": "{{seed}}", "steps": "{{steps}}", "cfg": "{{cfg}}"}},
+	"5": {"class_type": "EmptyLatentImage", "inputs": {"width": "{{width}}", "height": "{{height}}", "batch_size": "{{batch_size}}"}},
+	"6": {"class_type": "CLIPTextEncode", "inputs": {"text": "{{prompt}}, masterpiece"}},
+	"7": {"class_type": "CLIPTextEncode", "inputs": {"text": "{{negative_prompt}}"}}
+}`
+
+func writeWorkflow(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "workflow.json")
+	assert.Nil(t, os.WriteFile(path, []byte(testWorkflow), 0644))
+	return path
+}
+
+func TestLocalSdTool_ComfyUi(t *testing.T) {
+	pollInterval = time.Millisecond
+
+	var got map[string]any
+	polls := 0
+	api := http.NewServeMux()
+	api.HandleFunc("POST /prompt", func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"prompt_id": "abc", "number": 1}`))
+	})
+	api.HandleFunc("GET /history/abc", func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		//Not done the first time
+		if polls == 1 {
+			w.Write([]byte(`{}`))
+			return
+		}
+		w.Write([]byte(`{"abc": {"status": {"status_str": "success", "completed": true}, "outputs": {
+			"10": {"images": [{"filename": "upscaled_0001.png", "subfolder": "", "type": "output"}]},
+			"9": {"images": [
+				{"filename": "preview.png", "subfolder": "", "type": "temp"},
+				{"filename": "botman_0001.png", "subfolder": "", "type": "output"},
+				{"filename": "botman_0002.png", "subfolder": "", "type": "output"}
+			]}
+		}}}`))
+	})
+	viewed := []string{}
+	api.HandleFunc("GET /view", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("type") != "output" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		viewed = append(viewed, r.URL.Query().Get("filename"))
+		w.Write(fakePng)
+	})
+
+	tool, store := newTestTool(t, api, Config{Backend: BackendComfyUi, Workflow: writeWorkflow(t), Prompts: imagetool.Prompts{PositivePrompt: "Anime."}})
+	result := tool.Run(context.Background(), chattools.ToolCall{Params: map[string]any{"prompt": "a gopher", "seed": 7}})
+	assert.True(t, result.Success, result.Content)
+	assert.Equal(t, 2, polls)
+
+	assert.Equal(t, "botman", got["client_id"])
+	assert.Equal(t, map[string]any{
+		"3": map[string]any{"class_type": "KSampler", "inputs": map[string]any{"seed": 7.0, "steps": 30.0, "cfg": 7.0}},
+		"5": map[string]any{"class_type": "EmptyLatentImage", "inputs": map[string]any{"width": 1024.0, "height": 1024.0, "batch_size": 1.0}},
+		"6": map[string]any{"class_type": "CLIPTextEncode", "inputs": map[string]any{"text": "Anime. a gopher, masterpiece"}},
+		"7": map[string]any{"class_type": "CLIPTextEncode", "inputs": map[string]any{"text": ""}},
+	}, got["prompt"])
+
+	//In the order of the node ids
+	assert.Equal(t, []string{"botman_0001.png", "botman_0002.png", "upscaled_0001.png"}, viewed)
+
+	val := result.Value.(Result)
+	if assert.Len(t, val.Images, 3) {
+		assert.Equal(t, uint32(7), val.Images[0].Seed)
+		assert.Equal(t, []int{0, 1, 0}, []int{val.Images[0].BatchIndex, val.Images[1].BatchIndex, val.Images[2].BatchIndex})
+		data, err := store.Load(val.Images[0].Path[len("memory::"):])
+		assert.Nil(t, err)
+		assert.Equal(t, fakePng, data)
+	}
+
+	//The workflow is not changed by calls
+	result = tool.Run(context.Background(), chattools.ToolCall{Params: map[string]any{"prompt": "a cat", "seed": 8}})
+	assert.True(t, result.Success, result.Content)
+	assert.Equal(t, "{{seed}}", tool.workflow["3"].(map[string]any)["inputs"].(map[string]any)["seed"])
+}
+
+func TestLocalSdTool_ComfyUiFailed(t *testing.T) {
+	pollInterval = time.Millisecond
+
+	api := http.NewServeMux()
+	api.HandleFunc("POST /prompt", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"prompt_id": "abc"}`))
+	})
+	api.HandleFunc("GET /history/abc", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"abc": {"status": {"status_str": "error", "completed": false}, "outputs": {}}}`))
+	})
+
+	tool, _ := newTestTool(t, api, Config{Backend: BackendComfyUi, Workflow: writeWorkflow(t)})
+	result := tool.Run(context.Background(), chattools.ToolCall{Params: map[string]any{"prompt": "a gopher"}})
+	assert.False(t, result.Success)
+	assert.Contains(t, result.Content, "comfyui failed to run the workflow")
+}
+
+func TestNew_InvalidSettings(t *testing.T) {
+	def := chattools.ToolDefinition{ToolType: chattools.ToolTypeLocalSd, Name: "generate_image"}
+	assert.Nil(t, def.SetSettings(Config{Backend: "invokeai"}))
+	_, err := New(def, nil)
+	assert.ErrorContains(t, err, "unknown backend invokeai")
+
+	assert.Nil(t, def.SetSettings(Config{Backend: BackendComfyUi}))
+	_, err = New(def, nil)
+	assert.ErrorContains(t, err, "the comfyui backend needs a workflow")
+
+	assert.Nil(t, def.SetSettings(Config{Backend: BackendComfyUi, Workflow: "/does/not/exist.json"}))
+	_, err = New(def, nil)
+	assert.ErrorContains(t, err, "could not read workflow")
+}
+
+func TestSubstitute(t *testing.T) {
+	values := map[string]any{"{{seed}}": uint32(5), "{{prompt}}": "a cat"}
+	got := substitute([]any{"{{seed}}", "seed {{seed}}: {{prompt}}", 3.0, map[string]any{"text": "{{prompt}}"}}, values)
+	assert.Equal(t, []any{uint32(5), "seed 5: a cat", 3.0, map[string]any{"text": "a cat"}}, got)
+}
+
+func TestParams_metadata(t *testing.T) {
+	params := Params{Backend: BackendAutomatic1111, Prompt: "a gopher", Seed: 42, Samples: 4}
+
+	//Every image has a seed of its own
+	meta := params.metadata(Image{Seed: 43})
+	assert.Equal(t, uint32(43), meta.Seed)
+	assert.Equal(t, Params{Backend: BackendAutomatic1111, Prompt: "a gopher", Seed: 43, Samples: 1}, meta.Parameters)
+
+	//The batch has a seed
+	params.Backend = BackendComfyUi
+	meta = params.metadata(Image{Seed: 42, BatchIndex: 2})
+	assert.Equal(t, uint32(42), meta.Seed)
+	assert.Equal(t, Params{Backend: BackendComfyUi, Prompt: "a gopher", Seed: 42, Samples: 4, BatchIndex: 2}, meta.Parameters)
+}
+
+func TestCompareNodeIds(t *testing.T) {
+	ids := []string{"10", "upscale", "9", "2"}
+	slices.SortFunc(ids, compareNodeIds)
+	assert.Equal(t, []string{"2", "9", "10", "upscale"}, ids)
+}
@@ -0,0 +1,106 @@
+package localsd
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+type txt2imgResponse struct {
+	Images []string `json:"images"`
+	// JSON in a string
+	Info string `json:"info"`
+}
+
+type txt2imgInfo struct {
+	AllSeeds []uint32 `json:"all_seeds"`
+}
+
+// Generate images with the txt2img endpoint of the Automatic1111 web UI API.
+func (t *LocalSdTool) automatic1111(ctx context.Context, params Params) ([]Image, error) {
+	payload := map[string]any{
+		"prompt":          params.Prompt,
+		"negative_prompt": params.NegativePrompt,
+		"seed":            params.Seed,
+		"steps":           params.Steps,
+		"cfg_scale":       params.CfgScale,
+		"width":           params.Width,
+		"height":          params.Height,
+		"batch_size":      params.Samples,
+	}
+	if params.Sampler != "" {
+		payload["sampler_name"] = params.Sampler
+	}
+
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.request(ctx, "POST", "/sdapi/v1/txt2img", bytes.NewBuffer(jsonPayload))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := txt2imgResponse{}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return nil, fmt.Errorf("could not read automatic1111 response: %w", err)
+	}
+
+	info := txt2imgInfo{}
+	if result.Info != "" {
+		//Without the info, images get the seeds they would have
+		json.Unmarshal([]byte(result.Info), &info)
+	}
+
+	images := []Image{}
+	//With a batch, the UI may add a grid of all images after them
+	for i, b64 := range result.Images[:min(len(result.Images), params.Samples)] {
+		data, err := base64.StdEncoding.DecodeString(b64)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode image: %w", err)
+		}
+
+		seed := params.Seed + uint32(i)
+		if i < len(info.AllSeeds) {
+			seed = info.AllSeeds[i]
+		}
+		images = append(images, Image{Data: data, Seed: seed})
+	}
+
+	if len(images) == 0 {
+		return nil, errors.New("automatic1111 returned no images")
+	}
+	return images, nil
+}
+
+// Do a request to the backend. Responses that are not OK are errors.
+func (t *LocalSdTool) request(ctx context.Context, method string, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, t.Settings.Url+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%v responded with %v: %s", t.Settings.Backend, resp.StatusCode, bytes.TrimSpace(message))
+	}
+	return resp, nil
+}
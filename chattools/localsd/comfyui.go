@@ -0,0 +1,202 @@
+package localsd
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// How often to ask ComfyUI if a prompt is done
+var pollInterval = time.Second
+
+type comfyHistory struct {
+	Status struct {
+		StatusStr string `json:"status_str"`
+		Completed bool   `json:"completed"`
+	} `json:"status"`
+	Outputs map[string]struct {
+		Images []comfyImage `json:"images"`
+	} `json:"outputs"`
+}
+
+type comfyImage struct {
+	Filename  string `json:"filename"`
+	Subfolder string `json:"subfolder"`
+	Type      string `json:"type"`
+}
+
+// Generate images by queueing the workflow in ComfyUI, with the params filled in.
+func (t *LocalSdTool) comfyUi(ctx context.Context, params Params) ([]Image, error) {
+	payload := map[string]any{
+		"prompt":    substitute(t.workflow, placeholders(params)),
+		"client_id": "botman",
+	}
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.request(ctx, "POST", "/prompt", bytes.NewBuffer(jsonPayload))
+	if err != nil {
+		return nil, err
+	}
+	queued := struct {
+		PromptId string `json:"prompt_id"`
+	}{}
+	err = json.NewDecoder(resp.Body).Decode(&queued)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("could not read comfyui response: %w", err)
+	}
+	if queued.PromptId == "" {
+		return nil, errors.New("comfyui did not queue the workflow")
+	}
+
+	log.Debug("Queued ComfyUI prompt %v", queued.PromptId)
+	history, err := t.waitFor(ctx, queued.PromptId)
+	if err != nil {
+		return nil, err
+	}
+
+	images := []Image{}
+	//Outputs are keyed by node id, in the order of the ids
+	for _, node := range slices.SortedFunc(maps.Keys(history.Outputs), compareNodeIds) {
+		batchIndex := 0
+		for _, img := range history.Outputs[node].Images {
+			//Previews are temp images
+			if img.Type != "output" {
+				continue
+			}
+
+			data, err := t.comfyImage(ctx, img)
+			if err != nil {
+				return nil, err
+			}
+			//The seed is the seed of the batch
+			images = append(images, Image{Data: data, Seed: params.Seed, BatchIndex: batchIndex})
+			batchIndex++
+		}
+	}
+
+	if len(images) == 0 {
+		return nil, errors.New("comfyui workflow has no output images")
+	}
+	return images, nil
+}
+
+// Node ids are numbers, compared as numbers. Other ids go after them.
+func compareNodeIds(a string, b string) int {
+	numA, errA := strconv.Atoi(a)
+	numB, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return cmp.Compare(numA, numB)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// Wait until ComfyUI has run a prompt.
+func (t *LocalSdTool) waitFor(ctx context.Context, promptId string) (comfyHistory, error) {
+	for {
+		resp, err := t.request(ctx, "GET", "/history/"+url.PathEscape(promptId), nil)
+		if err != nil {
+			return comfyHistory{}, err
+		}
+		histories := map[string]comfyHistory{}
+		err = json.NewDecoder(resp.Body).Decode(&histories)
+		resp.Body.Close()
+		if err != nil {
+			return comfyHistory{}, fmt.Errorf("could not read comfyui history: %w", err)
+		}
+
+		history, ok := histories[promptId]
+		if ok && history.Status.StatusStr == "error" {
+			return comfyHistory{}, errors.New("comfyui failed to run the workflow")
+		}
+		if ok && history.Status.Completed {
+			return history, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return comfyHistory{}, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func (t *LocalSdTool) comfyImage(ctx context.Context, img comfyImage) ([]byte, error) {
+	query := url.Values{}
+	query.Set("filename", img.Filename)
+	query.Set("subfolder", img.Subfolder)
+	query.Set("type", img.Type)
+
+	resp, err := t.request(ctx, "GET", "/view?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not download image %v: %w", img.Filename, err)
+	}
+	return data, nil
+}
+
+// The values of the placeholders a workflow can have.
+func placeholders(params Params) map[string]any {
+	return map[string]any{
+		"{{prompt}}":          params.Prompt,
+		"{{negative_prompt}}": params.NegativePrompt,
+		"{{seed}}":            params.Seed,
+		"{{steps}}":           params.Steps,
+		"{{cfg}}":             params.CfgScale,
+		"{{width}}":           params.Width,
+		"{{height}}":          params.Height,
+		"{{sampler}}":         params.Sampler,
+		"{{batch_size}}":      params.Samples,
+	}
+}
+
+// Returns a copy of a workflow value, with the placeholders filled in.
+// A string that is only a placeholder gets its value, so numbers stay numbers.
+func substitute(value any, values map[string]any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		result := map[string]any{}
+		for key, val := range v {
+			result[key] = substitute(val, values)
+		}
+		return result
+	case []any:
+		result := []any{}
+		for _, val := range v {
+			result = append(result, substitute(val, values))
+		}
+		return result
+	case string:
+		if val, ok := values[v]; ok {
+			return val
+		}
+		for placeholder, val := range values {
+			v = strings.ReplaceAll(v, placeholder, fmt.Sprint(val))
+		}
+		return v
+	}
+	return value
+}
@@ -0,0 +1,189 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	botman "github.com/c00/botman-v2/internal/cmd"
+	"github.com/c00/botman-v2/internal/logger"
+)
+
+var log = logger.New("MCP")
+
+// How long a server gets to start and list its tools
+const StartTimeout = 30 * time.Second
+
+// ServerConfig is an MCP server in the config. Servers with a command run over stdio, servers with a url over streamable HTTP.
+type ServerConfig struct {
+	Name string `yaml:"name"`
+
+	// The executable of a stdio server, looked up in PATH
+	Command string   `yaml:"command,omitempty"`
+	Args    []string `yaml:"args,omitempty"`
+	// Added to the environment of the server. Values can use ${VAR}.
+	Env map[string]string `yaml:"env,omitempty"`
+	Dir string            `yaml:"dir,omitempty"`
+
+	// The endpoint of a streamable HTTP server
+	Url string `yaml:"url,omitempty"`
+	// Sent with every request, such as Authorization. Values can use ${VAR}.
+	Headers map[string]string `yaml:"headers,omitempty"`
+
+	// Prefix of the tool names, the name of the server and an underscore when empty
+	Prefix string `yaml:"prefix,omitempty"`
+	// Only use these tools, by the name the server gives them. All tools when empty.
+	Tools []string `yaml:"tools,omitempty"`
+	// Timeout and approval mode of the tools, as in a tool definition
+	Timeout  time.Duration `yaml:"timeout,omitempty"`
+	Approval string        `yaml:"approval,omitempty"`
+}
+
+type transport interface {
+	// Send a request and wait for its response
+	roundTrip(ctx context.Context, request Message) (Message, error)
+	notify(ctx context.Context, msg Message) error
+	close() error
+}
+
+// Client talks to a single MCP server.
+type Client struct {
+	name      string
+	transport transport
+	nextID    atomic.Int64
+
+	// What the server told about itself when connecting
+	Info InitializeResult
+}
+
+// Connect starts or connects to the server and initializes the session.
+func Connect(ctx context.Context, conf ServerConfig) (*Client, error) {
+	var t transport
+	switch {
+	case conf.Url != "":
+		t = newHttpTransport(conf)
+	case conf.Command != "":
+		stdio, err := startStdio(conf)
+		if err != nil {
+			return nil, err
+		}
+		t = stdio
+	default:
+		return nil, errors.New("server needs a command or a url")
+	}
+
+	c := &Client{name: conf.Name, transport: t}
+	err := c.initialize(ctx)
+	if err != nil {
+		t.close()
+		return nil, fmt.Errorf("could not initialize: %w", err)
+	}
+
+	return c, nil
+}
+
+func (c *Client) initialize(ctx context.Context) error {
+	params := InitializeParams{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    map[string]any{},
+		ClientInfo:      Implementation{Name: "botman", Version: botman.Version},
+	}
+
+	err := c.call(ctx, "initialize", params, &c.Info)
+	if err != nil {
+		return err
+	}
+	log.Debug("connected to %v %v %v, protocol %v", c.name, c.Info.ServerInfo.Name, c.Info.ServerInfo.Version, c.Info.ProtocolVersion)
+
+	if t, ok := c.transport.(*httpTransport); ok {
+		t.setProtocolVersion(c.Info.ProtocolVersion)
+	}
+
+	return c.notify(ctx, "notifications/initialized", nil)
+}
+
+// ListTools returns all tools of the server.
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	tools := []Tool{}
+	cursor := ""
+	for {
+		result := ListToolsResult{}
+		err := c.call(ctx, "tools/list", ListToolsParams{Cursor: cursor}, &result)
+		if err != nil {
+			return nil, err
+		}
+
+		tools = append(tools, result.Tools...)
+		if result.NextCursor == "" {
+			return tools, nil
+		}
+		cursor = result.NextCursor
+	}
+}
+
+// CallTool calls a tool of the server. A tool that fails returns a result with IsError, not an error.
+func (c *Client) CallTool(ctx context.Context, name string, arguments map[string]any) (CallToolResult, error) {
+	if arguments == nil {
+		arguments = map[string]any{}
+	}
+
+	result := CallToolResult{}
+	err := c.call(ctx, "tools/call", CallToolParams{Name: name, Arguments: arguments}, &result)
+	return result, err
+}
+
+// Close ends the session, and stops the server when it runs over stdio.
+func (c *Client) Close() error {
+	return c.transport.close()
+}
+
+func (c *Client) call(ctx context.Context, method string, params any, result any) error {
+	request, err := newRequest(c.nextID.Add(1), method, params)
+	if err != nil {
+		return err
+	}
+
+	response, err := c.transport.roundTrip(ctx, request)
+	if err != nil {
+		if ctx.Err() != nil {
+			c.cancel(request, ctx.Err())
+		}
+		return fmt.Errorf("%v: %w", method, err)
+	}
+
+	if response.Error != nil {
+		return fmt.Errorf("%v: %w", method, response.Error)
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	err = json.Unmarshal(response.Result, result)
+	if err != nil {
+		return fmt.Errorf("invalid result of %v: %w", method, err)
+	}
+	return nil
+}
+
+func (c *Client) notify(ctx context.Context, method string, params any) error {
+	msg, err := newNotification(method, params)
+	if err != nil {
+		return err
+	}
+	return c.transport.notify(ctx, msg)
+}
+
+// Let the server know a request is no longer needed.
+func (c *Client) cancel(request Message, reason error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err := c.notify(ctx, "notifications/cancelled", CancelledParams{RequestID: request.ID, Reason: reason.Error()})
+	if err != nil {
+		log.Debug("could not cancel %v: %v", request.Method, err)
+	}
+}
@@ -0,0 +1,155 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/c00/botman-v2/chattools"
+	"github.com/c00/botman-v2/jsonschema"
+)
+
+const ToolTypeMcp = "mcp"
+
+// Providers only take tool names of these characters, up to 64 long.
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+const maxNameLength = 64
+
+// Server is a connected MCP server and the tools it offers.
+type Server struct {
+	Config ServerConfig
+	Client *Client
+	Tools  []*RemoteTool
+}
+
+// Start connects to the server and creates a tool for each tool it lists.
+func Start(ctx context.Context, conf ServerConfig) (*Server, error) {
+	ctx, cancel := context.WithTimeout(ctx, StartTimeout)
+	defer cancel()
+
+	client, err := Connect(ctx, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	tools, err := client.ListTools(ctx)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	prefix := conf.Prefix
+	if prefix == "" {
+		prefix = conf.Name + "_"
+	}
+
+	s := &Server{Config: conf, Client: client}
+	for _, tool := range tools {
+		if len(conf.Tools) > 0 && !slices.Contains(conf.Tools, tool.Name) {
+			continue
+		}
+
+		remote, err := newRemoteTool(client, tool, conf, prefix)
+		if err != nil {
+			log.Warn("skipped tool %v of %v: %v", tool.Name, conf.Name, err)
+			continue
+		}
+		s.Tools = append(s.Tools, remote)
+	}
+
+	return s, nil
+}
+
+func (s *Server) Close() error {
+	return s.Client.Close()
+}
+
+// RemoteTool runs a tool of an MCP server.
+type RemoteTool struct {
+	client     *Client
+	remoteName string
+	definition chattools.ToolDefinition
+	schema     jsonschema.JsonSchema
+}
+
+func newRemoteTool(client *Client, tool Tool, conf ServerConfig, prefix string) (*RemoteTool, error) {
+	schema := jsonschema.New()
+	if len(tool.InputSchema) > 0 {
+		err := json.Unmarshal(tool.InputSchema, &schema)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input schema: %w", err)
+		}
+	}
+	if schema.Type == "" {
+		schema.Type = "object"
+	}
+
+	name := invalidNameChars.ReplaceAllString(prefix+tool.Name, "_")
+	if len(name) > maxNameLength {
+		name = name[:maxNameLength]
+	}
+
+	return &RemoteTool{
+		client:     client,
+		remoteName: tool.Name,
+		definition: chattools.ToolDefinition{
+			ToolType:    ToolTypeMcp,
+			Name:        name,
+			Description: tool.Description,
+			Timeout:     conf.Timeout,
+			Approval:    conf.Approval,
+		},
+		schema: schema,
+	}, nil
+}
+
+func (t *RemoteTool) Name() string {
+	return t.definition.Name
+}
+
+func (t *RemoteTool) Schema() jsonschema.JsonSchema {
+	return t.schema
+}
+
+// Definition is the tool definition to give the chatter.
+func (t *RemoteTool) Definition() chattools.ToolDefinition {
+	return t.definition.WithSchema(t.schema)
+}
+
+func (t *RemoteTool) Run(ctx context.Context, call chattools.ToolCall) chattools.ToolResult {
+	result, err := t.client.CallTool(ctx, t.remoteName, call.Params)
+	if err != nil {
+		log.Error("call to %v failed: %v", t.definition.Name, err)
+		return chattools.ToolResult{Success: false, Content: fmt.Sprintf("tool call failed: %v", err)}
+	}
+
+	return chattools.ToolResult{
+		Success: !result.IsError,
+		Content: contentText(result.Content),
+		Value:   result.StructuredContent,
+	}
+}
+
+// The text of the content, with a placeholder for content that is not text.
+func contentText(content []Content) string {
+	parts := []string{}
+	for _, c := range content {
+		switch {
+		case c.Type == "text":
+			parts = append(parts, c.Text)
+		case c.Type == "resource" && c.Resource != nil && c.Resource.Text != "":
+			parts = append(parts, c.Resource.Text)
+		case c.Type == "resource" && c.Resource != nil:
+			parts = append(parts, fmt.Sprintf("[resource %v]", c.Resource.Uri))
+		case c.Type == "resource_link":
+			parts = append(parts, fmt.Sprintf("[resource %v]", c.Uri))
+		default:
+			parts = append(parts, fmt.Sprintf("[%v %v]", c.Type, c.MimeType))
+		}
+	}
+	return strings.Join(parts, "\n")
+}
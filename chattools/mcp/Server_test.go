@@ -0,0 +1,143 @@
+package mcp
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/c00/botman-v2/chattools"
+	"github.com/c00/botman-v2/internal/mcptest"
+	"github.com/stretchr/testify/assert"
+)
+
+// The test binary is the stdio server when this is set.
+const serverEnv = "BOTMAN_MCPTEST_SERVER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(serverEnv) == "1" {
+		err := mcptest.New().ServeStdio(os.Stdin, os.Stdout)
+		if err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+func stdioConfig() ServerConfig {
+	return ServerConfig{Name: "test", Command: os.Args[0], Env: map[string]string{serverEnv: "1"}}
+}
+
+func httpConfig(t *testing.T) (ServerConfig, *mcptest.Server) {
+	server := mcptest.New()
+	ts := httptest.NewServer(server.Handler())
+	t.Cleanup(ts.Close)
+
+	return ServerConfig{Name: "test", Url: ts.URL}, server
+}
+
+func TestStart(t *testing.T) {
+	httpConf, _ := httpConfig(t)
+
+	for name, conf := range map[string]ServerConfig{"stdio": stdioConfig(), "http": httpConf} {
+		t.Run(name, func(t *testing.T) {
+			server, err := Start(context.Background(), conf)
+			assert.Nil(t, err)
+			defer server.Close()
+
+			assert.Equal(t, "mcptest", server.Client.Info.ServerInfo.Name)
+
+			names := []string{}
+			for _, tool := range server.Tools {
+				names = append(names, tool.Name())
+			}
+			assert.Equal(t, []string{"test_echo", "test_add", "test_fail", "test_slow", "test_bad_name"}, names)
+
+			echo := server.Tools[0]
+			assert.Equal(t, []string{"text"}, echo.Schema().Required)
+			assert.Equal(t, "string", echo.Schema().Properties["text"].Type)
+			assert.Equal(t, ToolTypeMcp, echo.Definition().ToolType)
+
+			result := echo.Run(context.Background(), chattools.ToolCall{Params: map[string]any{"text": "hello"}})
+			assert.Equal(t, chattools.ToolResult{Success: true, Content: "hello"}, result)
+
+			result = server.Tools[1].Run(context.Background(), chattools.ToolCall{Params: map[string]any{"a": 2, "b": 3}})
+			assert.Equal(t, chattools.ToolResult{Success: true, Content: "5", Value: map[string]any{"sum": float64(5)}}, result)
+
+			result = server.Tools[2].Run(context.Background(), chattools.ToolCall{})
+			assert.Equal(t, chattools.ToolResult{Success: false, Content: "it failed"}, result)
+		})
+	}
+}
+
+func TestStart_Options(t *testing.T) {
+	conf := stdioConfig()
+	conf.Prefix = "my-"
+	conf.Tools = []string{"add", "echo"}
+	conf.Timeout = time.Minute
+	conf.Approval = chattools.ApprovalAsk
+
+	server, err := Start(context.Background(), conf)
+	assert.Nil(t, err)
+	defer server.Close()
+
+	assert.Len(t, server.Tools, 2)
+	def := server.Tools[0].Definition()
+	assert.Equal(t, "my-echo", def.Name)
+	assert.Equal(t, time.Minute, def.Timeout)
+	assert.Equal(t, chattools.ApprovalAsk, def.Approval)
+}
+
+func TestRemoteTool_Cancel(t *testing.T) {
+	httpConf, _ := httpConfig(t)
+
+	for name, conf := range map[string]ServerConfig{"stdio": stdioConfig(), "http": httpConf} {
+		t.Run(name, func(t *testing.T) {
+			server, err := Start(context.Background(), conf)
+			assert.Nil(t, err)
+			defer server.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			result := server.Tools[3].Run(ctx, chattools.ToolCall{})
+			assert.False(t, result.Success)
+			assert.Contains(t, result.Content, "deadline exceeded")
+
+			//The server is still usable
+			result = server.Tools[0].Run(context.Background(), chattools.ToolCall{Params: map[string]any{"text": "still here"}})
+			assert.Equal(t, "still here", result.Content)
+		})
+	}
+}
+
+func TestClose(t *testing.T) {
+	conf, fixture := httpConfig(t)
+
+	server, err := Start(context.Background(), conf)
+	assert.Nil(t, err)
+	assert.Nil(t, server.Close())
+	assert.True(t, fixture.Closed())
+
+	server, err = Start(context.Background(), stdioConfig())
+	assert.Nil(t, err)
+	assert.Nil(t, server.Close())
+
+	result := server.Tools[0].Run(context.Background(), chattools.ToolCall{Params: map[string]any{"text": "gone"}})
+	assert.False(t, result.Success)
+}
+
+func TestConnect_Errors(t *testing.T) {
+	_, err := Connect(context.Background(), ServerConfig{Name: "empty"})
+	assert.NotNil(t, err)
+
+	_, err = Connect(context.Background(), ServerConfig{Name: "missing", Command: "botman-no-such-command"})
+	assert.NotNil(t, err)
+
+	//Exits without answering
+	_, err = Connect(context.Background(), ServerConfig{Name: "true", Command: "true"})
+	assert.NotNil(t, err)
+}
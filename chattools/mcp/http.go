@@ -0,0 +1,183 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Talks to a server over streamable HTTP. Every message is a POST, the server answers
+// with JSON or with a stream of server sent events.
+type httpTransport struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+
+	mu              sync.Mutex
+	sessionID       string
+	protocolVersion string
+}
+
+func newHttpTransport(conf ServerConfig) *httpTransport {
+	headers := map[string]string{}
+	for key, val := range conf.Headers {
+		headers[key] = os.ExpandEnv(val)
+	}
+
+	return &httpTransport{url: conf.Url, headers: headers, client: &http.Client{}}
+}
+
+func (t *httpTransport) roundTrip(ctx context.Context, request Message) (Message, error) {
+	resp, err := t.post(ctx, request)
+	if err != nil {
+		return Message{}, err
+	}
+	defer resp.Body.Close()
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		response := Message{}
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		if err != nil {
+			return Message{}, fmt.Errorf("invalid response: %w", err)
+		}
+		return response, nil
+	case "text/event-stream":
+		return t.readEvents(resp.Body, request)
+	}
+
+	return Message{}, fmt.Errorf("unexpected response of type %q", mediaType)
+}
+
+func (t *httpTransport) notify(ctx context.Context, msg Message) error {
+	resp, err := t.post(ctx, msg)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (t *httpTransport) close() error {
+	t.mu.Lock()
+	sessionID := t.sessionID
+	t.mu.Unlock()
+
+	if sessionID == "" {
+		return nil
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, t.url, nil)
+	if err != nil {
+		return err
+	}
+	t.setHeaders(req)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (t *httpTransport) setProtocolVersion(version string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.protocolVersion = version
+}
+
+func (t *httpTransport) post(ctx context.Context, msg Message) (*http.Response, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	t.setHeaders(req)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("server responded with %v: %v", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	if sessionID := resp.Header.Get("Mcp-Session-Id"); sessionID != "" {
+		t.mu.Lock()
+		t.sessionID = sessionID
+		t.mu.Unlock()
+	}
+
+	return resp, nil
+}
+
+func (t *httpTransport) setHeaders(req *http.Request) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", t.sessionID)
+	}
+	if t.protocolVersion != "" {
+		req.Header.Set("MCP-Protocol-Version", t.protocolVersion)
+	}
+	for key, val := range t.headers {
+		req.Header.Set(key, val)
+	}
+}
+
+// Read server sent events until the response to request.
+func (t *httpTransport) readEvents(body io.Reader, request Message) (Message, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	data := []string{}
+	for scanner.Scan() {
+		line := scanner.Text()
+		if value, ok := strings.CutPrefix(line, "data:"); ok {
+			data = append(data, strings.TrimPrefix(value, " "))
+			continue
+		}
+		if line != "" || len(data) == 0 {
+			//Other fields, such as event and id, are not used
+			continue
+		}
+
+		msg := Message{}
+		err := json.Unmarshal([]byte(strings.Join(data, "\n")), &msg)
+		data = data[:0]
+		if err != nil {
+			log.Warn("invalid event: %v", err)
+			continue
+		}
+
+		if msg.IsResponse() && string(msg.ID) == string(request.ID) {
+			return msg, nil
+		}
+		log.Debug("skipped event %v", msg.Method)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return Message{}, err
+	}
+	return Message{}, fmt.Errorf("stream ended without a response to %v", request.Method)
+}
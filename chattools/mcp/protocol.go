@@ -0,0 +1,152 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// The MCP version botman asks for. Servers answer with the version they use.
+const ProtocolVersion = "2025-06-18"
+
+const jsonRpcVersion = "2.0"
+
+// JSON-RPC error codes
+const (
+	CodeParseError     = -32700
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// Message is a JSON-RPC request, notification or response.
+type Message struct {
+	JsonRpc string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RpcError       `json:"error,omitempty"`
+}
+
+func (m Message) IsRequest() bool {
+	return m.Method != "" && len(m.ID) > 0
+}
+
+func (m Message) IsNotification() bool {
+	return m.Method != "" && len(m.ID) == 0
+}
+
+func (m Message) IsResponse() bool {
+	return m.Method == "" && len(m.ID) > 0
+}
+
+type RpcError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RpcError) Error() string {
+	return fmt.Sprintf("mcp error %v: %v", e.Code, e.Message)
+}
+
+func newRequest(id int64, method string, params any) (Message, error) {
+	msg := Message{JsonRpc: jsonRpcVersion, ID: json.RawMessage(fmt.Sprint(id)), Method: method}
+	return msg, msg.setParams(params)
+}
+
+func newNotification(method string, params any) (Message, error) {
+	msg := Message{JsonRpc: jsonRpcVersion, Method: method}
+	return msg, msg.setParams(params)
+}
+
+// NewResult creates the response to request with result.
+func NewResult(request Message, result any) Message {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return NewError(request, CodeInternalError, err.Error())
+	}
+	return Message{JsonRpc: jsonRpcVersion, ID: request.ID, Result: data}
+}
+
+// NewError creates an error response to request.
+func NewError(request Message, code int, message string) Message {
+	return Message{JsonRpc: jsonRpcVersion, ID: request.ID, Error: &RpcError{Code: code, Message: message}}
+}
+
+func (m *Message) setParams(params any) error {
+	if params == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("could not encode params of %v: %w", m.Method, err)
+	}
+	m.Params = data
+	return nil
+}
+
+type Implementation struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type InitializeParams struct {
+	ProtocolVersion string         `json:"protocolVersion"`
+	Capabilities    map[string]any `json:"capabilities"`
+	ClientInfo      Implementation `json:"clientInfo"`
+}
+
+type InitializeResult struct {
+	ProtocolVersion string         `json:"protocolVersion"`
+	Capabilities    map[string]any `json:"capabilities"`
+	ServerInfo      Implementation `json:"serverInfo"`
+	Instructions    string         `json:"instructions,omitempty"`
+}
+
+// Tool is a tool as a server lists it.
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"inputSchema"`
+}
+
+type ListToolsParams struct {
+	Cursor string `json:"cursor,omitempty"`
+}
+
+type ListToolsResult struct {
+	Tools      []Tool `json:"tools"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+type CallToolParams struct {
+	Name      string         `json:"name"`
+	Arguments map[string]any `json:"arguments"`
+}
+
+type CallToolResult struct {
+	Content           []Content `json:"content"`
+	IsError           bool      `json:"isError,omitempty"`
+	StructuredContent any       `json:"structuredContent,omitempty"`
+}
+
+// Content is a part of a tool result: text, an image, audio or a resource.
+type Content struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	Data     string `json:"data,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+	Uri      string `json:"uri,omitempty"`
+	Resource *struct {
+		Uri      string `json:"uri"`
+		MimeType string `json:"mimeType,omitempty"`
+		Text     string `json:"text,omitempty"`
+	} `json:"resource,omitempty"`
+}
+
+type CancelledParams struct {
+	RequestID json.RawMessage `json:"requestId"`
+	Reason    string          `json:"reason,omitempty"`
+}
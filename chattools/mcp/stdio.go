@@ -0,0 +1,198 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// How long a server gets to exit after its stdin is closed
+const stopTimeout = 2 * time.Second
+
+// Runs a server as a child process, talking JSON-RPC over its stdin and stdout.
+type stdioTransport struct {
+	name  string
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	pending map[string]chan Message
+
+	done chan struct{}
+	err  error
+}
+
+func startStdio(conf ServerConfig) (*stdioTransport, error) {
+	cmd := exec.Command(conf.Command, conf.Args...)
+	cmd.Dir = conf.Dir
+	cmd.Env = os.Environ()
+	for key, val := range conf.Env {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%v=%v", key, os.ExpandEnv(val)))
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("could not start %v: %w", conf.Command, err)
+	}
+
+	t := &stdioTransport{
+		name:    conf.Name,
+		cmd:     cmd,
+		stdin:   stdin,
+		pending: map[string]chan Message{},
+		done:    make(chan struct{}),
+	}
+
+	go t.logStderr(stderr)
+	go t.read(stdout)
+
+	return t, nil
+}
+
+func (t *stdioTransport) roundTrip(ctx context.Context, request Message) (Message, error) {
+	id := string(request.ID)
+	ch := make(chan Message, 1)
+
+	t.mu.Lock()
+	t.pending[id] = ch
+	t.mu.Unlock()
+
+	defer func() {
+		t.mu.Lock()
+		delete(t.pending, id)
+		t.mu.Unlock()
+	}()
+
+	err := t.write(request)
+	if err != nil {
+		return Message{}, err
+	}
+
+	select {
+	case response := <-ch:
+		return response, nil
+	case <-ctx.Done():
+		return Message{}, ctx.Err()
+	case <-t.done:
+		return Message{}, t.err
+	}
+}
+
+func (t *stdioTransport) notify(ctx context.Context, msg Message) error {
+	return t.write(msg)
+}
+
+func (t *stdioTransport) close() error {
+	t.stdin.Close()
+
+	select {
+	case <-t.done:
+	case <-time.After(stopTimeout):
+		t.cmd.Process.Kill()
+		<-t.done
+	}
+
+	return nil
+}
+
+func (t *stdioTransport) write(msg Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+
+	select {
+	case <-t.done:
+		return t.err
+	default:
+	}
+
+	_, err = t.stdin.Write(append(data, '\n'))
+	if err != nil {
+		return fmt.Errorf("could not write to server %v: %w", t.name, err)
+	}
+	return nil
+}
+
+func (t *stdioTransport) read(stdout io.Reader) {
+	reader := bufio.NewReader(stdout)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			t.handle(line)
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	err := t.cmd.Wait()
+	if err == nil {
+		err = errors.New("exited")
+	}
+	t.err = fmt.Errorf("server %v stopped: %w", t.name, err)
+	close(t.done)
+}
+
+func (t *stdioTransport) handle(line []byte) {
+	msg := Message{}
+	err := json.Unmarshal(line, &msg)
+	if err != nil {
+		log.Warn("invalid message from %v: %v", t.name, err)
+		return
+	}
+
+	switch {
+	case msg.IsResponse():
+		t.mu.Lock()
+		ch, ok := t.pending[string(msg.ID)]
+		t.mu.Unlock()
+		if ok {
+			ch <- msg
+		}
+	case msg.IsRequest():
+		go t.write(answer(msg))
+	default:
+		log.Debug("%v: %v", t.name, msg.Method)
+	}
+}
+
+func (t *stdioTransport) logStderr(stderr io.Reader) {
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		log.Debug("%v: %v", t.name, scanner.Text())
+	}
+}
+
+// Answer a request of a server. botman has no client features other than ping.
+func answer(request Message) Message {
+	if request.Method == "ping" {
+		return NewResult(request, map[string]any{})
+	}
+	return NewError(request, CodeMethodNotFound, fmt.Sprintf("method %v not supported", request.Method))
+}
@@ -2,57 +2,253 @@ package sdxl
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"math/rand"
+	"mime/multipart"
 	"net/http"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/c00/botman-v2/chattools"
+	"github.com/c00/botman-v2/chattools/imagetool"
 	"github.com/c00/botman-v2/internal/logger"
-	"github.com/c00/botman-v2/internal/storageprovider"
+	"github.com/c00/botman-v2/jsonschema"
 )
 
 var log = logger.New("SdxlTool")
 
+var _ imagetool.Generator = (*SdxlTool)(nil)
+var _ imagetool.Result = SdxlResult{}
+
 const defaultModel = "stable-diffusion-xl-1024-v1-0"
+const defaultBaseUrl = "https://api.fireworks.ai/inference/v1/image_generation/accounts/fireworks/models"
+
+const (
+	DefaultAspectRatio   = "1:1"
+	DefaultSteps         = 30
+	DefaultCfgScale      = 7
+	DefaultMaxSamples    = 4
+	DefaultImageStrength = 0.35
+)
+
+// The sizes SDXL is trained on, by aspect ratio
+var dimensions = map[string][2]int{
+	"1:1":   {1024, 1024},
+	"9:7":   {1152, 896},
+	"7:9":   {896, 1152},
+	"19:13": {1216, 832},
+	"13:19": {832, 1216},
+	"7:4":   {1344, 768},
+	"4:7":   {768, 1344},
+	"12:5":  {1536, 640},
+	"5:12":  {640, 1536},
+}
+
+var aspectRatios = []string{"1:1", "9:7", "7:9", "19:13", "13:19", "7:4", "4:7", "12:5", "5:12"}
+
+var stylePresets = []string{
+	"3d-model", "analog-film", "anime", "cinematic", "comic-book", "digital-art", "enhance", "fantasy-art", "isometric",
+	"line-art", "low-poly", "modeling-compound", "neon-punk", "origami", "photographic", "pixel-art", "tile-texture",
+}
 
-func New(def chattools.ToolDefinition, store storageprovider.StorageProvider) (*SdxlTool, error) {
-	if def.SdxlSettings == nil {
-		return nil, fmt.Errorf("missing sdxl settings in tool definition")
+func init() {
+	chattools.Register(chattools.ToolTypeSdxl, func(def chattools.ToolDefinition, env chattools.Env) (chattools.Tool, error) {
+		return New(def, env.Storage)
+	})
+}
+
+// Config holds the settings of an sdxl tool definition. Most are defaults for calls that don't choose.
+type Config struct {
+	imagetool.Prompts `yaml:",inline"`
+	ApiKey            string `yaml:"apiKey,omitempty" json:"apiKey,omitempty"`
+	Model             string `yaml:"model,omitempty" json:"model,omitempty"`
+	// The image generation API of Fireworks, or one that works the same
+	BaseUrl string `yaml:"baseUrl,omitempty" json:"baseUrl,omitempty"`
+	// Width:height, like 7:4. See the schema for the options.
+	AspectRatio string  `yaml:"aspectRatio,omitempty" json:"aspectRatio,omitempty"`
+	Steps       int     `yaml:"steps,omitempty" json:"steps,omitempty"`
+	CfgScale    float64 `yaml:"cfgScale,omitempty" json:"cfgScale,omitempty"`
+	// 0 is a random seed for every call
+	Seed        uint32 `yaml:"seed,omitempty" json:"seed,omitempty"`
+	Samples     int    `yaml:"samples,omitempty" json:"samples,omitempty"`
+	StylePreset string `yaml:"stylePreset,omitempty" json:"stylePreset,omitempty"`
+	Sampler     string `yaml:"sampler,omitempty" json:"sampler,omitempty"`
+	// The most samples a call can ask for
+	MaxSamples int `yaml:"maxSamples,omitempty" json:"maxSamples,omitempty"`
+	// How much the input image of image to image shows in the result, from 0 to 1
+	ImageStrength float64 `yaml:"imageStrength,omitempty" json:"imageStrength,omitempty"`
+}
+
+func New(def chattools.ToolDefinition, store chattools.Storage) (*SdxlTool, error) {
+	settings := Config{}
+	err := def.DecodeSettings(&settings)
+	if err != nil {
+		return nil, err
 	}
 
-	if def.SdxlSettings.Model == "" {
-		def.SdxlSettings.Model = defaultModel
+	if settings.Model == "" {
+		settings.Model = defaultModel
+	}
+	if settings.BaseUrl == "" {
+		settings.BaseUrl = defaultBaseUrl
+	}
+	if settings.AspectRatio == "" {
+		settings.AspectRatio = DefaultAspectRatio
+	}
+	if _, ok := dimensions[settings.AspectRatio]; !ok {
+		return nil, fmt.Errorf("invalid settings for tool %v: unknown aspect ratio %v", def.Name, settings.AspectRatio)
+	}
+	if settings.Steps == 0 {
+		settings.Steps = DefaultSteps
+	}
+	if settings.CfgScale == 0 {
+		settings.CfgScale = DefaultCfgScale
+	}
+	if settings.Samples == 0 {
+		settings.Samples = 1
+	}
+	if settings.MaxSamples == 0 {
+		settings.MaxSamples = max(DefaultMaxSamples, settings.Samples)
+	}
+	if settings.ImageStrength == 0 {
+		settings.ImageStrength = DefaultImageStrength
 	}
 
 	return &SdxlTool{
 		Definition: def,
+		Settings:   settings,
 		Store:      store,
 	}, nil
 }
 
 type SdxlTool struct {
 	Definition chattools.ToolDefinition
-	Store      storageprovider.StorageProvider
+	Settings   Config
+	Store      chattools.Storage
 }
 
-type SdxlResult struct {
+func (t *SdxlTool) Name() string {
+	return t.Definition.Name
+}
+
+// The params of a call
+type sdxlParams struct {
+	Prompt         string   `json:"prompt"`
+	NegativePrompt string   `json:"negativePrompt"`
+	AspectRatio    string   `json:"aspectRatio"`
+	Seed           uint32   `json:"seed"`
+	Steps          int      `json:"steps"`
+	StylePreset    string   `json:"stylePreset"`
+	Samples        int      `json:"samples"`
+	Image          string   `json:"image"`
+	ImageStrength  *float64 `json:"imageStrength"`
+}
+
+func (t *SdxlTool) Schema() jsonschema.JsonSchema {
+	schema := jsonschema.New()
+	schema.AddString("prompt", "The positive prompt for the image. Be descriptive. Describe at least the scene, the quality, the type of image.", true)
+	schema.AddString("negativePrompt", "The negative prompt for the image. Optionally add things you don't want in the prompt. This can be helpful to mitigate common problems with SDXL, such as hands with too many fingers.", false)
+	schema.AddEnum("aspectRatio", fmt.Sprintf("The aspect ratio of the image, width:height. Default %v.", t.Settings.AspectRatio), aspectRatios, false)
+	schema.AddEnum("stylePreset", "Guide the image towards a style.", stylePresets, false)
+
+	zero, maxSeed := 0.0, float64(^uint32(0))
+	schema.AddInteger("seed", "The seed of the image. Use the seed of an earlier image to make a variation of it. Leave it out for a random seed.", false)
+	schema.Properties["seed"].Minimum = &zero
+	schema.Properties["seed"].Maximum = &maxSeed
+
+	minSteps, maxSteps := 10.0, 50.0
+	schema.AddInteger("steps", fmt.Sprintf("Diffusion steps. More steps have more detail and take longer. Default %v.", t.Settings.Steps), false)
+	schema.Properties["steps"].Minimum = &minSteps
+	schema.Properties["steps"].Maximum = &maxSteps
+
+	one, maxSamples := 1.0, float64(t.Settings.MaxSamples)
+	schema.AddInteger("samples", "The number of images to generate.", false)
+	schema.Properties["samples"].Minimum = &one
+	schema.Properties["samples"].Maximum = &maxSamples
+
+	schema.AddString("image", "The path of an image that was generated before, to generate a new image from. The aspect ratio is that of the image.", false)
+	schema.AddNumber("imageStrength", fmt.Sprintf("How much of the image shows in the new image, from 0 to 1. Default %v.", t.Settings.ImageStrength), false)
+	schema.Properties["imageStrength"].Minimum = &zero
+	schema.Properties["imageStrength"].Maximum = &one
+	return schema
+}
+
+// SdxlParams are all the parameters images were generated with, to generate them again.
+type SdxlParams struct {
+	Model          string  `yaml:"model"`
+	Prompt         string  `yaml:"prompt"`
+	NegativePrompt string  `yaml:"negativePrompt,omitempty"`
+	Width          int     `yaml:"width,omitempty"`
+	Height         int     `yaml:"height,omitempty"`
+	Steps          int     `yaml:"steps"`
+	CfgScale       float64 `yaml:"cfgScale"`
+	Seed           uint32  `yaml:"seed"`
+	Samples        int     `yaml:"samples"`
+	Sampler        string  `yaml:"sampler,omitempty"`
+	StylePreset    string  `yaml:"stylePreset,omitempty"`
+	// The image of image to image
+	InitImage     string  `yaml:"initImage,omitempty"`
+	ImageStrength float64 `yaml:"imageStrength,omitempty"`
+}
+
+// The metadata of an image with seed, with the params to make just that image again.
+func (p SdxlParams) metadata(seed uint32) imagetool.Metadata {
+	p.Seed = seed
+	p.Samples = 1
+	return imagetool.Metadata{
+		Tool:           chattools.ToolTypeSdxl,
+		Model:          p.Model,
+		Prompt:         p.Prompt,
+		NegativePrompt: p.NegativePrompt,
+		Seed:           seed,
+		Parameters:     p,
+	}
+}
+
+type SdxlImage struct {
 	Data []byte `yaml:"-"`
 	Path string `yaml:"path"`
+	// The seed of this image, to make it again with Samples 1
+	Seed uint32 `yaml:"seed"`
+}
+
+type SdxlResult struct {
+	Images []SdxlImage `yaml:"images"`
+	Params SdxlParams  `yaml:"params"`
+}
+
+func (sr SdxlResult) Paths() []string {
+	paths := []string{}
+	for _, img := range sr.Images {
+		paths = append(paths, img.Path)
+	}
+	return paths
 }
 
 func (sr SdxlResult) String() string {
-	return fmt.Sprintf("SdxlResult{ Data: len(%v), Path: %v}", len(sr.Data), sr.Path)
+	images := []string{}
+	for _, img := range sr.Images {
+		images = append(images, fmt.Sprintf("%v (len(%v), seed %v)", img.Path, len(img.Data), img.Seed))
+	}
+	return fmt.Sprintf("SdxlResult{ Images: %v, Seed: %v}", strings.Join(images, ", "), sr.Params.Seed)
 }
 
-func (t *SdxlTool) Run(call chattools.ToolCall) chattools.ToolResult {
-	prompt, ok := call.Params["prompt"].(string)
-	if !ok {
+func (t *SdxlTool) Run(ctx context.Context, call chattools.ToolCall) chattools.ToolResult {
+	callParams := sdxlParams{}
+	err := jsonschema.Decode(call.Params, &callParams)
+	if err != nil {
+		log.Error("invalid SDXL call %+v: %v", call.Params, err)
+		return chattools.ToolResult{Success: false, Content: err.Error()}
+	}
+	if callParams.Prompt == "" {
 		log.Error("missing prompt in SDXL call %+v", call.Params)
 		return chattools.ToolResult{
 			Success: false,
@@ -60,9 +256,36 @@ func (t *SdxlTool) Run(call chattools.ToolCall) chattools.ToolResult {
 		}
 	}
 
-	negPrompt, _ := call.Params["negativePrompt"].(string)
+	return t.generate(ctx, callParams)
+}
+
+// Generate makes images without a model.
+func (t *SdxlTool) Generate(ctx context.Context, req imagetool.Request) chattools.ToolResult {
+	if req.Prompt == "" {
+		return chattools.ToolResult{Success: false, Content: "missing prompt"}
+	}
+	return t.generate(ctx, sdxlParams{Prompt: req.Prompt, NegativePrompt: req.NegativePrompt, Seed: req.Seed, Samples: req.N})
+}
+
+func (t *SdxlTool) generate(ctx context.Context, callParams sdxlParams) chattools.ToolResult {
+	params, err := t.params(callParams)
+	if err != nil {
+		return chattools.ToolResult{Success: false, Content: err.Error()}
+	}
+
+	var initImage []byte
+	if params.InitImage != "" {
+		initImage, err = t.Store.Load(filepath.Base(params.InitImage))
+		if err != nil {
+			log.Error("could not load image %v: %v", params.InitImage, err)
+			return chattools.ToolResult{
+				Success: false,
+				Content: fmt.Sprintf("could not load image %v: %v", params.InitImage, err),
+			}
+		}
+	}
 
-	data, err := t.getImage(prompt, negPrompt)
+	images, err := t.getImages(ctx, params, initImage)
 	if err != nil {
 		log.Error("could not generate image: %v", err)
 		return chattools.ToolResult{
@@ -71,61 +294,137 @@ func (t *SdxlTool) Run(call chattools.ToolCall) chattools.ToolResult {
 		}
 	}
 
-	filename := fmt.Sprintf("image-%v-%v.png", time.Now().Format(time.RFC3339), rand.Intn(1000))
-
-	path, err := t.Store.Save(filename, data)
-	if err != nil {
-		log.Error("error while saving image to %v: %v", path, err)
-		return chattools.ToolResult{
-			Success: false,
-			Content: fmt.Sprintf("error while saving image to %v: %v", path, err),
+	lines := []string{}
+	for i, img := range images {
+		path, err := imagetool.Save(t.Store, img.Data, params.metadata(img.Seed))
+		if err != nil {
+			log.Error("%v", err)
+			return chattools.ToolResult{Success: false, Content: err.Error()}
 		}
+
+		images[i].Path = path
+		lines = append(lines, fmt.Sprintf("Image saved at: %v (seed %v)", path, img.Seed))
 	}
 
 	val := SdxlResult{
-		Data: data,
-		Path: path,
+		Images: images,
+		Params: params,
 	}
 
-	return chattools.ToolResult{Success: true, Content: fmt.Sprintf("Image saved at: %v", path), Value: val}
+	return chattools.ToolResult{Success: true, Content: strings.Join(lines, "\n"), Value: val}
 }
 
-func (t *SdxlTool) getImage(prompt, negativePrompt string) ([]byte, error) {
-	url := fmt.Sprintf("https://api.fireworks.ai/inference/v1/image_generation/accounts/fireworks/models/%s", t.Definition.SdxlSettings.Model)
+// The parameters for a call, with the settings for what the call does not choose.
+func (t *SdxlTool) params(call sdxlParams) (SdxlParams, error) {
+	params := SdxlParams{
+		Model:       t.Settings.Model,
+		Steps:       t.Settings.Steps,
+		CfgScale:    t.Settings.CfgScale,
+		Seed:        t.Settings.Seed,
+		Samples:     t.Settings.Samples,
+		Sampler:     t.Settings.Sampler,
+		StylePreset: t.Settings.StylePreset,
+	}
 
-	//Full prompts
-	prompt = strings.TrimSpace(fmt.Sprintf("%v %v", t.Definition.SdxlSettings.PositivePrompt, prompt))
-	negativePrompt = strings.TrimSpace(fmt.Sprintf("%v %v", t.Definition.SdxlSettings.NegativePrompt, negativePrompt))
+	params.Prompt, params.NegativePrompt = t.Settings.Apply(call.Prompt, call.NegativePrompt)
 
-	log.Debug("Image prompt: %v", prompt)
-	if negativePrompt != "" {
-		log.Debug("Image negative prompt: %v", prompt)
+	aspectRatio := t.Settings.AspectRatio
+	if call.AspectRatio != "" {
+		aspectRatio = call.AspectRatio
+	}
+	size, ok := dimensions[aspectRatio]
+	if !ok {
+		return SdxlParams{}, fmt.Errorf("unknown aspect ratio %v, use one of %v", aspectRatio, strings.Join(aspectRatios, ", "))
 	}
 
-	payload := map[string]interface{}{
-		"cfg_scale":       7,
-		"height":          1024,
-		"width":           1024,
-		"sampler":         nil,
-		"samples":         1,
-		"steps":           30,
-		"seed":            0,
-		"style_preset":    nil,
-		"safety_check":    false,
-		"prompt":          prompt,
-		"negative_prompt": negativePrompt,
+	if call.StylePreset != "" {
+		if !slices.Contains(stylePresets, call.StylePreset) {
+			return SdxlParams{}, fmt.Errorf("unknown style preset %v, use one of %v", call.StylePreset, strings.Join(stylePresets, ", "))
+		}
+		params.StylePreset = call.StylePreset
 	}
-	jsonPayload, err := json.Marshal(payload)
-	if err != nil {
-		return nil, err
+	if call.Steps > 0 {
+		params.Steps = call.Steps
+	}
+	if call.Samples > 0 {
+		params.Samples = min(call.Samples, t.Settings.MaxSamples)
+	}
+	if call.Seed > 0 {
+		params.Seed = call.Seed
+	}
+	//Choose the random seed here, so it can be recorded
+	if params.Seed == 0 {
+		params.Seed = uint32(rand.Int63n(int64(^uint32(0)))) + 1
 	}
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonPayload))
+
+	if call.Image != "" {
+		params.InitImage = call.Image
+		params.ImageStrength = t.Settings.ImageStrength
+		if call.ImageStrength != nil {
+			params.ImageStrength = *call.ImageStrength
+		}
+	} else {
+		params.Width = size[0]
+		params.Height = size[1]
+	}
+
+	return params, nil
+}
+
+// An image in the response of the API
+type artifact struct {
+	Base64       string `json:"base64"`
+	FinishReason string `json:"finishReason"`
+	Seed         uint32 `json:"seed"`
+}
+
+// Generate the images of params. With an initImage, they are generated from that image.
+func (t *SdxlTool) getImages(ctx context.Context, params SdxlParams, initImage []byte) ([]SdxlImage, error) {
+	url := fmt.Sprintf("%v/%v", strings.TrimSuffix(t.Settings.BaseUrl, "/"), params.Model)
+
+	log.Debug("Image prompt: %v", params.Prompt)
+	if params.NegativePrompt != "" {
+		log.Debug("Image negative prompt: %v", params.NegativePrompt)
+	}
+
+	var body io.Reader
+	contentType := "application/json"
+	if initImage == nil {
+		payload := map[string]any{
+			"cfg_scale":       params.CfgScale,
+			"height":          params.Height,
+			"width":           params.Width,
+			"sampler":         nilIfEmpty(params.Sampler),
+			"samples":         params.Samples,
+			"steps":           params.Steps,
+			"seed":            params.Seed,
+			"style_preset":    nilIfEmpty(params.StylePreset),
+			"safety_check":    false,
+			"prompt":          params.Prompt,
+			"negative_prompt": params.NegativePrompt,
+		}
+		jsonPayload, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewBuffer(jsonPayload)
+	} else {
+		url += "/image_to_image"
+		form, formType, err := imageToImageForm(params, initImage)
+		if err != nil {
+			return nil, err
+		}
+		body = form
+		contentType = formType
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, body)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "image/jpeg")
-	req.Header.Set("Authorization", "Bearer "+t.Definition.SdxlSettings.ApiKey)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+t.Settings.ApiKey)
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
@@ -135,13 +434,89 @@ func (t *SdxlTool) getImage(prompt, negativePrompt string) ([]byte, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New("sdxl api responded with " + strconv.Itoa(resp.StatusCode))
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("sdxl api responded with %v: %s", strconv.Itoa(resp.StatusCode), bytes.TrimSpace(message))
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	artifacts := []artifact{}
+	err = json.NewDecoder(resp.Body).Decode(&artifacts)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("could not read sdxl response: %w", err)
+	}
+
+	images := []SdxlImage{}
+	filtered := 0
+	for _, a := range artifacts {
+		if a.FinishReason == "CONTENT_FILTERED" {
+			filtered++
+			continue
+		}
+
+		data, err := base64.StdEncoding.DecodeString(a.Base64)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode image: %w", err)
+		}
+
+		seed := a.Seed
+		if seed == 0 {
+			seed = params.Seed
+		}
+		images = append(images, SdxlImage{Data: data, Seed: seed})
+	}
+
+	if len(images) == 0 {
+		if filtered > 0 {
+			return nil, errors.New("all images were filtered by the safety check")
+		}
+		return nil, errors.New("sdxl api returned no images")
+	}
+	return images, nil
+}
+
+// The multipart form of an image to image request.
+func imageToImageForm(params SdxlParams, initImage []byte) (io.Reader, string, error) {
+	buf := &bytes.Buffer{}
+	w := multipart.NewWriter(buf)
+
+	file, err := w.CreateFormFile("init_image", "init_image"+imagetool.Extension(initImage))
+	if err != nil {
+		return nil, "", err
+	}
+	file.Write(initImage)
+
+	fields := map[string]string{
+		"prompt":          params.Prompt,
+		"negative_prompt": params.NegativePrompt,
+		"init_image_mode": "IMAGE_STRENGTH",
+		"image_strength":  strconv.FormatFloat(params.ImageStrength, 'f', -1, 64),
+		"cfg_scale":       strconv.FormatFloat(params.CfgScale, 'f', -1, 64),
+		"seed":            strconv.FormatUint(uint64(params.Seed), 10),
+		"steps":           strconv.Itoa(params.Steps),
+		"samples":         strconv.Itoa(params.Samples),
+		"sampler":         params.Sampler,
+		"style_preset":    params.StylePreset,
+		"safety_check":    "false",
+	}
+	for _, key := range slices.Sorted(maps.Keys(fields)) {
+		if fields[key] == "" {
+			continue
+		}
+		err = w.WriteField(key, fields[key])
+		if err != nil {
+			return nil, "", err
+		}
 	}
 
-	return body, nil
+	err = w.Close()
+	if err != nil {
+		return nil, "", err
+	}
+	return buf, w.FormDataContentType(), nil
+}
+
+func nilIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
 }
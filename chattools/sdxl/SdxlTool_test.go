@@ -1,53 +1,290 @@
 package sdxl
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strconv"
 	"testing"
 
 	"github.com/c00/botman-v2/chattools"
+	"github.com/c00/botman-v2/chattools/imagetool"
 	"github.com/c00/botman-v2/internal/storageprovider"
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
 )
 
-func TestSdxlTool_getImage(t *testing.T) {
-	tool, err := New(chattools.ToolDefinition{
-		ToolType: chattools.ToolTypeSdxl,
-		SdxlSettings: &chattools.SdxlConfig{
-			ApiKey:         os.Getenv("FIREWORKS_API_KEY"),
-			PositivePrompt: "Dragonball z anime style.",
-		},
-	}, nil)
+func TestSdxlTool_getImages(t *testing.T) {
+	tool, err := New(newDefinition(t), nil)
 	assert.Nil(t, err)
 
-	data, err := tool.getImage("an image of a cat with too much fur", "")
+	params, err := tool.params(sdxlParams{Prompt: "an image of a cat with too much fur"})
 	assert.Nil(t, err)
-	assert.NotNil(t, data)
+	images, err := tool.getImages(context.Background(), params, nil)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, images)
 }
 
 func TestSdxlTool_Run(t *testing.T) {
 	store, err := storageprovider.NewLocalStore(os.TempDir())
 	assert.Nil(t, err)
 
-	tool, err := New(
-		chattools.ToolDefinition{
-			ToolType: chattools.ToolTypeSdxl,
-			SdxlSettings: &chattools.SdxlConfig{
-				ApiKey:         os.Getenv("FIREWORKS_API_KEY"),
-				PositivePrompt: "Dragonball z anime style.",
-			},
-		},
-		store,
-	)
+	tool, err := New(newDefinition(t), store)
 	assert.Nil(t, err)
 
 	call := chattools.ToolCall{
 		Params: map[string]any{"prompt": "a really fluffy kitten"},
 	}
-	msg := tool.Run(call)
+	msg := tool.Run(context.Background(), call)
 	assert.True(t, msg.Success)
 
 	val, ok := msg.Value.(SdxlResult)
 	assert.True(t, ok)
 	//Check the path to see the test image. if you feel like it.
-	assert.NotEqual(t, "", val.Path)
+	if assert.NotEmpty(t, val.Images) {
+		assert.NotEqual(t, "", val.Images[0].Path)
+	}
+}
+
+func newDefinition(t *testing.T) chattools.ToolDefinition {
+	def := chattools.ToolDefinition{ToolType: chattools.ToolTypeSdxl}
+	err := def.SetSettings(Config{
+		ApiKey:  os.Getenv("FIREWORKS_API_KEY"),
+		Prompts: imagetool.Prompts{PositivePrompt: "Dragonball z anime style."},
+	})
+	assert.Nil(t, err)
+	return def
+}
+
+var fakePng = encodePng()
+
+func encodePng() []byte {
+	buf := &bytes.Buffer{}
+	png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 2, 2)))
+	return buf.Bytes()
+}
+
+// A stand-in for the image generation API. Keeps the last request.
+type fakeApi struct {
+	path   string
+	json   map[string]any
+	form   map[string]string
+	upload []byte
+}
+
+func (f *fakeApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.path = r.URL.Path
+	if r.Header.Get("Authorization") != "Bearer test-key" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error": "unauthorized"}`))
+		return
+	}
+
+	samples := 1
+	if r.Header.Get("Content-Type") == "application/json" {
+		f.json = map[string]any{}
+		json.NewDecoder(r.Body).Decode(&f.json)
+		samples = int(f.json["samples"].(float64))
+	} else {
+		r.ParseMultipartForm(1 << 20)
+		f.form = map[string]string{}
+		for key, values := range r.MultipartForm.Value {
+			f.form[key] = values[0]
+		}
+		file, _, _ := r.FormFile("init_image")
+		f.upload, _ = io.ReadAll(file)
+	}
+
+	artifacts := []artifact{}
+	for i := range samples {
+		artifacts = append(artifacts, artifact{Base64: base64.StdEncoding.EncodeToString(fakePng), FinishReason: "SUCCESS", Seed: uint32(100 + i)})
+	}
+	json.NewEncoder(w).Encode(artifacts)
+}
+
+func newFakeTool(t *testing.T, api http.Handler, settings Config) (*SdxlTool, *storageprovider.MemoryStorage) {
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	settings.ApiKey = "test-key"
+	settings.BaseUrl = server.URL + "/models"
+	def := chattools.ToolDefinition{ToolType: chattools.ToolTypeSdxl, Name: "generate_image"}
+	assert.Nil(t, def.SetSettings(settings))
+
+	store := storageprovider.NewMemStore()
+	tool, err := New(def, store)
+	assert.Nil(t, err)
+	return tool, store
+}
+
+func TestSdxlTool_RunSettings(t *testing.T) {
+	api := &fakeApi{}
+	tool, store := newFakeTool(t, api, Config{Prompts: imagetool.Prompts{PositivePrompt: "Anime.", NegativePrompt: "blurry"}, Steps: 20, Seed: 42, StylePreset: "anime"})
+
+	call := chattools.ToolCall{Params: map[string]any{"prompt": "a gopher", "aspectRatio": "7:4", "samples": 2, "steps": 40, "stylePreset": "pixel-art"}}
+	result := tool.Run(context.Background(), call)
+	assert.True(t, result.Success, result.Content)
+	assert.Contains(t, result.Content, "seed 101")
+
+	assert.Equal(t, "/models/stable-diffusion-xl-1024-v1-0", api.path)
+	assert.Equal(t, map[string]any{
+		"cfg_scale":       7.0,
+		"width":           1344.0,
+		"height":          768.0,
+		"sampler":         nil,
+		"samples":         2.0,
+		"steps":           40.0,
+		"seed":            42.0,
+		"style_preset":    "pixel-art",
+		"safety_check":    false,
+		"prompt":          "Anime. a gopher",
+		"negative_prompt": "blurry",
+	}, api.json)
+
+	val, ok := result.Value.(SdxlResult)
+	assert.True(t, ok)
+	assert.Equal(t, SdxlParams{
+		Model:          "stable-diffusion-xl-1024-v1-0",
+		Prompt:         "Anime. a gopher",
+		NegativePrompt: "blurry",
+		Width:          1344,
+		Height:         768,
+		Steps:          40,
+		CfgScale:       7,
+		Seed:           42,
+		Samples:        2,
+		StylePreset:    "pixel-art",
+	}, val.Params)
+
+	//Every sample is saved
+	assert.Len(t, val.Images, 2)
+	for i, img := range val.Images {
+		assert.Equal(t, uint32(100+i), img.Seed)
+		assert.Contains(t, img.Path, ".png")
+		data, err := store.Load(img.Path[len("memory::"):])
+		assert.Nil(t, err)
+
+		//Saved with how it was made
+		fields, err := imagetool.ReadFields(data)
+		assert.Nil(t, err)
+		assert.Contains(t, fields, imagetool.Field{Key: "Prompt", Value: "Anime. a gopher"})
+		assert.Contains(t, fields, imagetool.Field{Key: "Seed", Value: strconv.Itoa(100 + i)})
+		decoded, err := png.Decode(bytes.NewReader(data))
+		assert.Nil(t, err)
+		assert.Equal(t, 2, decoded.Bounds().Dx())
+	}
+}
+
+func TestSdxlTool_RunRandomSeed(t *testing.T) {
+	tool, _ := newFakeTool(t, &fakeApi{}, Config{})
+
+	params, err := tool.params(sdxlParams{Prompt: "a gopher"})
+	assert.Nil(t, err)
+	assert.NotZero(t, params.Seed)
+	assert.Equal(t, 1024, params.Width)
+	assert.Equal(t, 30, params.Steps)
+	assert.Equal(t, 1, params.Samples)
+
+	_, err = tool.params(sdxlParams{Prompt: "a gopher", AspectRatio: "2:1"})
+	assert.ErrorContains(t, err, "unknown aspect ratio 2:1")
+}
+
+func TestSdxlParams_metadata(t *testing.T) {
+	params := SdxlParams{Model: "stable-diffusion-xl-1024-v1-0", Prompt: "a gopher", Seed: 42, Samples: 4, Steps: 30}
+	meta := params.metadata(43)
+	assert.Equal(t, chattools.ToolTypeSdxl, meta.Tool)
+	assert.Equal(t, uint32(43), meta.Seed)
+
+	//The params of just this image
+	params.Seed, params.Samples = 43, 1
+	assert.Equal(t, params, meta.Parameters)
+}
+
+func TestSdxlTool_RunImageToImage(t *testing.T) {
+	api := &fakeApi{}
+	tool, store := newFakeTool(t, api, Config{})
+
+	path, err := store.Save("image-earlier.png", []byte("earlier image"))
+	assert.Nil(t, err)
+
+	call := chattools.ToolCall{Params: map[string]any{"prompt": "make it blue", "image": path, "imageStrength": 0.5, "seed": 7}}
+	result := tool.Run(context.Background(), call)
+	assert.True(t, result.Success, result.Content)
+
+	assert.Equal(t, "/models/stable-diffusion-xl-1024-v1-0/image_to_image", api.path)
+	assert.Equal(t, []byte("earlier image"), api.upload)
+	assert.Equal(t, "make it blue", api.form["prompt"])
+	assert.Equal(t, "0.5", api.form["image_strength"])
+	assert.Equal(t, "7", api.form["seed"])
+	assert.Equal(t, "IMAGE_STRENGTH", api.form["init_image_mode"])
+
+	val := result.Value.(SdxlResult)
+	assert.Equal(t, path, val.Params.InitImage)
+	assert.Equal(t, 0.5, val.Params.ImageStrength)
+	assert.Zero(t, val.Params.Width)
+
+	//Images that are not in the store
+	call.Params["image"] = "nope.png"
+	result = tool.Run(context.Background(), call)
+	assert.False(t, result.Success)
+	assert.Contains(t, result.Content, "could not load image nope.png")
+}
+
+func TestSdxlTool_RunFailed(t *testing.T) {
+	tool, _ := newFakeTool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"base64": "", "finishReason": "CONTENT_FILTERED", "seed": 1}]`))
+	}), Config{})
+
+	result := tool.Run(context.Background(), chattools.ToolCall{Params: map[string]any{"prompt": "a gopher"}})
+	assert.False(t, result.Success)
+	assert.Contains(t, result.Content, "filtered by the safety check")
+
+	tool, _ = newFakeTool(t, &fakeApi{}, Config{})
+	tool.Settings.ApiKey = "wrong"
+	result = tool.Run(context.Background(), chattools.ToolCall{Params: map[string]any{"prompt": "a gopher"}})
+	assert.False(t, result.Success)
+	assert.Contains(t, result.Content, `sdxl api responded with 401: {"error": "unauthorized"}`)
+
+	result = tool.Run(context.Background(), chattools.ToolCall{Params: map[string]any{}})
+	assert.False(t, result.Success)
+	assert.Equal(t, "missing prompt", result.Content)
+
+	//The model gets the actual problem
+	result = tool.Run(context.Background(), chattools.ToolCall{Params: map[string]any{"prompt": "a gopher", "seed": -1}})
+	assert.False(t, result.Success)
+	assert.Contains(t, result.Content, "seed")
+	assert.NotContains(t, result.Content, "missing prompt")
+}
+
+func TestNew_LegacyConfig(t *testing.T) {
+	//The settings as they used to be written to the config
+	defs := []chattools.ToolDefinition{}
+	err := yaml.Unmarshal([]byte(`
+- toolType: sdxl
+  name: sdxl
+  description: generate images
+  sdxl:
+    negativeprompt: blurry
+    positiveprompt: Anime.
+    apikey: old-key
+    model: other-model
+`), &defs)
+	assert.Nil(t, err)
+	if !assert.Len(t, defs, 1) {
+		return
+	}
+
+	tool, err := New(defs[0], nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "Anime.", tool.Settings.PositivePrompt)
+	assert.Equal(t, "blurry", tool.Settings.NegativePrompt)
+	assert.Equal(t, "old-key", tool.Settings.ApiKey)
+	assert.Equal(t, "other-model", tool.Settings.Model)
 }
@@ -0,0 +1,95 @@
+package clitools
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+const scissors = "# ------------------------ >8 ------------------------"
+
+// EditText opens the user's editor on a temporary file with initial as content. The comment is
+// shown below a scissors line, everything from that line down is ignored.
+// Returns the trimmed content of the file after the editor exits.
+func EditText(initial string, comment string) (string, error) {
+	f, err := os.CreateTemp("", "botman-*.md")
+	if err != nil {
+		return "", fmt.Errorf("cannot create temp file: %w", err)
+	}
+	path := f.Name()
+	defer os.Remove(path)
+
+	content := initial
+	if !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	content += fmt.Sprintf("\n%v\n# Everything below is ignored. Save an empty prompt to cancel.\n", scissors)
+	comment = strings.TrimSpace(comment)
+	if comment != "" {
+		for _, line := range strings.Split(comment, "\n") {
+			content += strings.TrimSpace(fmt.Sprintf("# %v", line)) + "\n"
+		}
+	}
+
+	_, err = f.WriteString(content)
+	f.Close()
+	if err != nil {
+		return "", fmt.Errorf("cannot write temp file: %w", err)
+	}
+
+	err = runEditor(path)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("cannot read temp file: %w", err)
+	}
+
+	text, _, _ := strings.Cut(string(data), scissors)
+	return strings.TrimSpace(text), nil
+}
+
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	//Run through the shell so editors with arguments work, e.g. "code --wait"
+	cmd := exec.Command("sh", "-c", editor+` "$@"`, editor, path)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	//Stdin may be a pipe that has been read already, the editor needs the terminal.
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		if tty, err := os.Open("/dev/tty"); err == nil {
+			defer tty.Close()
+			cmd.Stdin = tty
+		}
+	}
+
+	//Stdout may be a pipe or file that only the prompt's response should go to.
+	if !term.IsTerminal(int(os.Stdout.Fd())) {
+		if tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0); err == nil {
+			defer tty.Close()
+			cmd.Stdout = tty
+			cmd.Stderr = tty
+		}
+	}
+
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("editor %v failed: %w", editor, err)
+	}
+
+	return nil
+}
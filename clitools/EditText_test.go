@@ -0,0 +1,30 @@
+package clitools
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEditText(t *testing.T) {
+	t.Setenv("VISUAL", "")
+
+	t.Setenv("EDITOR", "true")
+	got, err := EditText("piped content", "You: hey\n\nsome answer")
+	assert.Nil(t, err)
+	assert.Equal(t, "piped content", got)
+
+	t.Setenv("EDITOR", `printf 'new prompt\n# not a comment\n' >`)
+	got, err = EditText("piped content", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "new prompt\n# not a comment", got)
+
+	t.Setenv("EDITOR", ": >")
+	got, err = EditText("piped content", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "", got)
+
+	t.Setenv("EDITOR", "false")
+	_, err = EditText("", "")
+	assert.NotNil(t, err)
+}
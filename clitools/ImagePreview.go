@@ -0,0 +1,118 @@
+package clitools
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	_ "image/gif"
+	_ "image/jpeg"
+
+	"golang.org/x/term"
+)
+
+// Protocols that terminals show images with. Terminals are recognized by their environment, as asking them
+// would mean reading their answer from stdin.
+const (
+	ImageProtocolNone  = ""
+	ImageProtocolKitty = "kitty"
+	ImageProtocolIterm = "iterm"
+	ImageProtocolSixel = "sixel"
+)
+
+// The most bytes of base64 in one kitty escape sequence
+const kittyChunkSize = 4096
+
+// DetectImageProtocol returns the protocol the terminal of f shows images with, or ImageProtocolNone if it is
+// not a terminal or shows no images.
+func DetectImageProtocol(f *os.File) string {
+	if !term.IsTerminal(int(f.Fd())) {
+		return ImageProtocolNone
+	}
+	return imageProtocol(os.Getenv)
+}
+
+func imageProtocol(getenv func(string) string) string {
+	switch {
+	case getenv("KITTY_WINDOW_ID") != "", getenv("TERM") == "xterm-kitty", getenv("TERM") == "xterm-ghostty":
+		return ImageProtocolKitty
+	case getenv("TERM_PROGRAM") == "iTerm.app", getenv("TERM_PROGRAM") == "WezTerm", getenv("LC_TERMINAL") == "iTerm2":
+		return ImageProtocolIterm
+	case strings.HasPrefix(getenv("TERM"), "foot"), getenv("TERM") == "mlterm", getenv("TERM") == "contour",
+		getenv("KONSOLE_VERSION") != "", getenv("WT_SESSION") != "":
+		return ImageProtocolSixel
+	}
+	return ImageProtocolNone
+}
+
+// WriteImage writes an image to the terminal with protocol, columns wide. 0 columns is the size of the image.
+func WriteImage(w io.Writer, protocol string, data []byte, columns int) error {
+	switch protocol {
+	case ImageProtocolKitty:
+		return writeKitty(w, data, columns)
+	case ImageProtocolIterm:
+		return writeIterm(w, data, columns)
+	case ImageProtocolSixel:
+		return writeSixel(w, data, columns)
+	}
+	return fmt.Errorf("unknown image protocol %v", protocol)
+}
+
+// Kitty only takes PNG, other images are converted. The image is sent in chunks.
+func writeKitty(w io.Writer, data []byte, columns int) error {
+	if http.DetectContentType(data) != "image/png" {
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("could not decode image: %w", err)
+		}
+		buf := &bytes.Buffer{}
+		err = png.Encode(buf, img)
+		if err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(data)
+	first := true
+	for len(encoded) > 0 {
+		chunk := encoded[:min(len(encoded), kittyChunkSize)]
+		encoded = encoded[len(chunk):]
+
+		more := 0
+		if len(encoded) > 0 {
+			more = 1
+		}
+
+		control := fmt.Sprintf("m=%v", more)
+		if first {
+			control = fmt.Sprintf("a=T,f=100,q=2,%v", control)
+			if columns > 0 {
+				control += fmt.Sprintf(",c=%v", columns)
+			}
+			first = false
+		}
+
+		_, err := fmt.Fprintf(w, "\x1b_G%v;%v\x1b\\", control, chunk)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprint(w, "\n")
+	return err
+}
+
+func writeIterm(w io.Writer, data []byte, columns int) error {
+	width := "auto"
+	if columns > 0 {
+		width = fmt.Sprint(columns)
+	}
+	_, err := fmt.Fprintf(w, "\x1b]1337;File=inline=1;size=%v;width=%v;preserveAspectRatio=1:%v\a\n", len(data), width, base64.StdEncoding.EncodeToString(data))
+	return err
+}
@@ -0,0 +1,111 @@
+package clitools
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageProtocol(t *testing.T) {
+	tests := []struct {
+		env  map[string]string
+		want string
+	}{
+		{map[string]string{"TERM": "xterm-kitty"}, ImageProtocolKitty},
+		{map[string]string{"TERM": "xterm-256color", "KITTY_WINDOW_ID": "1"}, ImageProtocolKitty},
+		{map[string]string{"TERM_PROGRAM": "iTerm.app"}, ImageProtocolIterm},
+		{map[string]string{"TERM_PROGRAM": "tmux", "LC_TERMINAL": "iTerm2"}, ImageProtocolIterm},
+		{map[string]string{"TERM": "foot"}, ImageProtocolSixel},
+		{map[string]string{"TERM": "xterm-256color", "WT_SESSION": "abc"}, ImageProtocolSixel},
+		{map[string]string{"TERM": "xterm-256color", "TERM_PROGRAM": "Apple_Terminal"}, ImageProtocolNone},
+	}
+
+	for _, tt := range tests {
+		got := imageProtocol(func(key string) string { return tt.env[key] })
+		assert.Equal(t, tt.want, got, tt.env)
+	}
+}
+
+func testPng(t *testing.T, size int) []byte {
+	buf := &bytes.Buffer{}
+	assert.Nil(t, png.Encode(buf, image.NewRGBA(image.Rect(0, 0, size, size))))
+	return buf.Bytes()
+}
+
+func TestWriteImage_Kitty(t *testing.T) {
+	data := testPng(t, 2)
+	out := &bytes.Buffer{}
+	assert.Nil(t, WriteImage(out, ImageProtocolKitty, data, 40))
+	assert.Equal(t, "\x1b_Ga=T,f=100,q=2,m=0,c=40;"+base64.StdEncoding.EncodeToString(data)+"\x1b\\\n", out.String())
+
+	//Big images are sent in chunks
+	out.Reset()
+	noise := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	rand.New(rand.NewSource(1)).Read(noise.Pix)
+	buf := &bytes.Buffer{}
+	assert.Nil(t, png.Encode(buf, noise))
+	assert.Nil(t, WriteImage(out, ImageProtocolKitty, buf.Bytes(), 0))
+
+	chunks := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\x1b\\")
+	assert.Greater(t, len(chunks), 2)
+	assert.True(t, strings.HasPrefix(chunks[0], "\x1b_Ga=T,f=100,q=2,m=1;"))
+	assert.True(t, strings.HasPrefix(chunks[1], "\x1b_Gm=1;"))
+	assert.True(t, strings.HasPrefix(chunks[len(chunks)-2], "\x1b_Gm=0;"))
+
+	//Other images become PNG
+	out.Reset()
+	buf.Reset()
+	assert.Nil(t, jpeg.Encode(buf, noise, nil))
+	assert.Nil(t, WriteImage(out, ImageProtocolKitty, buf.Bytes(), 0))
+	encoded := strings.TrimPrefix(strings.Split(out.String(), "\x1b\\")[0], "\x1b_Ga=T,f=100,q=2,m=1;")
+	first, err := base64.StdEncoding.DecodeString(encoded)
+	assert.Nil(t, err)
+	assert.True(t, bytes.HasPrefix(first, []byte("\x89PNG")))
+
+	assert.NotNil(t, WriteImage(out, ImageProtocolKitty, []byte("not an image"), 0))
+}
+
+func TestWriteImage_Iterm(t *testing.T) {
+	data := testPng(t, 2)
+	out := &bytes.Buffer{}
+	assert.Nil(t, WriteImage(out, ImageProtocolIterm, data, 0))
+	assert.Equal(t, "\x1b]1337;File=inline=1;size="+strconv.Itoa(len(data))+";width=auto;preserveAspectRatio=1:"+base64.StdEncoding.EncodeToString(data)+"\a\n", out.String())
+
+	assert.ErrorContains(t, WriteImage(out, "braille", data, 0), "unknown image protocol braille")
+}
+
+func TestWriteImage_Sixel(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 8))
+	for x := range 40 {
+		for y := range 8 {
+			if x >= 20 {
+				img.Set(x, y, color.White)
+			} else {
+				img.Set(x, y, color.Black)
+			}
+		}
+	}
+	buf := &bytes.Buffer{}
+	assert.Nil(t, png.Encode(buf, img))
+
+	out := &bytes.Buffer{}
+	assert.Nil(t, WriteImage(out, ImageProtocolSixel, buf.Bytes(), 2))
+
+	//Scaled to 2 columns of 10 pixels, a band of 4 rows with black on the left and white on the right
+	assert.Equal(t, "\x1bP0;1;0q\"1;1;20;4#0;2;0;0;0#255;2;100;100;100#0!10N$#255!10?!10N-\x1b\\\n", out.String())
+}
+
+func TestWriteSixelRow(t *testing.T) {
+	sb := &strings.Builder{}
+	writeSixelRow(sb, []byte("~~~@@@@@A"))
+	assert.Equal(t, "~~~!5@A", sb.String())
+}
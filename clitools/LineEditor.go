@@ -0,0 +1,151 @@
+package clitools
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/term"
+)
+
+const (
+	bracketedPasteOn  = "\x1b[?2004h"
+	bracketedPasteOff = "\x1b[?2004l"
+)
+
+// LineReader reads a line of input from the user. Returns an empty string when there is no more input.
+type LineReader interface {
+	ReadLine(label string) string
+}
+
+// AnswerReader is a LineReader that can read answers to questions, which are not prompts.
+type AnswerReader interface {
+	// Reads a line like ReadLine, without keeping it in the history.
+	ReadAnswer(label string) string
+}
+
+// BasicReader reads lines without any editing.
+type BasicReader struct {
+	In  io.Reader
+	Out io.Writer
+}
+
+func (r BasicReader) ReadLine(label string) string {
+	return GetInput(label, r.In, r.Out)
+}
+
+// NewLineEditor creates a line editor that keeps its history in historyFile.
+// An empty historyFile keeps history in memory only.
+func NewLineEditor(in *os.File, out io.Writer, historyFile string) *LineEditor {
+	return &LineEditor{
+		in:      in,
+		out:     out,
+		reader:  bufio.NewReader(in),
+		history: loadPromptHistory(historyFile),
+	}
+}
+
+// LineEditor reads lines from a terminal with cursor movement, history, reverse search (ctrl-r)
+// and multi-line input through pasting or alt-enter. When input is not a terminal it behaves like GetInput.
+type LineEditor struct {
+	in      *os.File
+	out     io.Writer
+	reader  *bufio.Reader
+	history *promptHistory
+}
+
+func (e *LineEditor) ReadLine(label string) string {
+	return e.readLine(label, true)
+}
+
+func (e *LineEditor) ReadAnswer(label string) string {
+	return e.readLine(label, false)
+}
+
+func (e *LineEditor) readLine(label string, keep bool) string {
+	fd := int(e.in.Fd())
+	if !term.IsTerminal(fd) {
+		return GetInput(label, e.in, e.out)
+	}
+
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return GetInput(label, e.in, e.out)
+	}
+
+	width := 80
+	if f, ok := e.out.(*os.File); ok {
+		if w := TerminalWidth(f); w > 0 {
+			width = w
+		}
+	}
+
+	fmt.Fprint(e.out, bracketedPasteOn)
+	text, err := e.edit(label, width)
+	fmt.Fprint(e.out, bracketedPasteOff)
+	term.Restore(fd, oldState)
+
+	if err != nil || text == "" {
+		return ""
+	}
+
+	if keep {
+		e.history.add(text)
+	}
+	fmt.Fprintln(e.out, "")
+
+	return text
+}
+
+// Edit a line until enter is pressed. Expects the terminal to be in raw mode.
+func (e *LineEditor) edit(label string, width int) (string, error) {
+	prompt := ""
+	if label != "" {
+		prompt = fmt.Sprintf("%v: ", label)
+	}
+
+	state := newLineState(e.out, prompt, width, e.history)
+	state.render()
+
+	for {
+		k, err := readKey(e.reader)
+		if errors.Is(err, io.EOF) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+
+		done, eof := state.handle(k)
+		if eof {
+			fmt.Fprint(e.out, "\r\n")
+			return "", nil
+		}
+
+		if done {
+			//Draw the final state with the cursor at the end, so output continues below it.
+			state.pos = len(state.buf)
+			state.render()
+			fmt.Fprint(e.out, "\r\n")
+			return string(state.buf), nil
+		}
+
+		state.render()
+	}
+}
+
+// TerminalWidth returns the width of the terminal f is connected to, or 0 if f is not a terminal.
+func TerminalWidth(f *os.File) int {
+	fd := int(f.Fd())
+	if !term.IsTerminal(fd) {
+		return 0
+	}
+
+	w, _, err := term.GetSize(fd)
+	if err != nil {
+		return 0
+	}
+	return w
+}
@@ -0,0 +1,97 @@
+package clitools
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestEditor(input string, history ...string) *LineEditor {
+	h := loadPromptHistory("")
+	h.entries = history
+
+	return &LineEditor{
+		out:     &stringWriter{},
+		reader:  bufio.NewReader(bytes.NewReader([]byte(input))),
+		history: h,
+	}
+}
+
+func TestLineEditor_edit(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		history []string
+		want    string
+	}{
+		{name: "plain line", input: "hello\r", want: "hello"},
+		{name: "backspace", input: "helloo\x7f\r", want: "hello"},
+		{name: "cursor left and insert", input: "hllo\x1b[D\x1b[D\x1b[De\r", want: "hello"},
+		{name: "home and end", input: "ello\x01h\x05!\r", want: "hello!"},
+		{name: "kill to end", input: "hello world\x1b[D\x1b[D\x1b[D\x1b[D\x1b[D\x1b[D\x0b\r", want: "hello"},
+		{name: "kill word", input: "hello world\x17\r", want: "hello "},
+		{name: "delete key", input: "helllo\x01\x1b[3~\r", want: "elllo"},
+		{name: "utf8", input: "héllo wörld\r", want: "héllo wörld"},
+		{name: "alt-enter newline", input: "one\x1b\rtwo\r", want: "one\ntwo"},
+		{name: "bracketed paste", input: "\x1b[200~line 1\r\nline 2\x1b[201~\r", want: "line 1\nline 2"},
+		{name: "history up", input: "\x1b[A\r", history: []string{"first", "second"}, want: "second"},
+		{name: "history up up down", input: "\x1b[A\x1b[A\x1b[B\r", history: []string{"first", "second"}, want: "second"},
+		{name: "history back to new line", input: "new\x1b[A\x1b[B\r", history: []string{"first"}, want: "new"},
+		{name: "reverse search", input: "\x12fir\r", history: []string{"first", "second"}, want: "first"},
+		{name: "reverse search again", input: "\x12o\x12\r", history: []string{"one", "two", "three"}, want: "one"},
+		{name: "reverse search cancel", input: "keep\x12se\x07\r", history: []string{"second"}, want: "keep"},
+		{name: "reverse search then edit", input: "\x12sec\x05!\r", history: []string{"second"}, want: "second!"},
+		{name: "ctrl-c clears line", input: "nope\x03yes\r", want: "yes"},
+		{name: "ctrl-d on empty line", input: "\x04", want: ""},
+		{name: "eof", input: "unfinished", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEditor(tt.input, tt.history...)
+			got, err := e.edit("You", 80)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLineState_position(t *testing.T) {
+	s := newLineState(&stringWriter{}, "", 10, loadPromptHistory(""))
+	content := []rune("0123456789abc\ndef")
+
+	row, col, wrap := s.position(content, 5)
+	assert.Equal(t, []any{0, 5, false}, []any{row, col, wrap})
+
+	row, col, wrap = s.position(content, 10)
+	assert.Equal(t, []any{1, 0, true}, []any{row, col, wrap})
+
+	row, col, _ = s.position(content, 13)
+	assert.Equal(t, []any{1, 3}, []any{row, col})
+
+	row, col, _ = s.position(content, len(content))
+	assert.Equal(t, []any{2, 3}, []any{row, col})
+}
+
+func TestPromptHistory(t *testing.T) {
+	path := filepath.Join(os.TempDir(), "botman-prompt-history")
+	os.Remove(path)
+
+	h := loadPromptHistory(path)
+	h.add("one")
+	h.add("one")
+	h.add("two\nlines")
+	h.add("  ")
+
+	loaded := loadPromptHistory(path)
+	assert.Equal(t, []string{"one", "two\nlines"}, loaded.entries)
+}
+
+func TestBasicReader(t *testing.T) {
+	r := BasicReader{In: bytes.NewReader([]byte("some input\n")), Out: &stringWriter{}}
+	assert.Equal(t, "some input", r.ReadLine("label"))
+}
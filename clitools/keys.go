@@ -0,0 +1,207 @@
+package clitools
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"unicode/utf8"
+)
+
+type keyKind int
+
+const (
+	keyUnknown keyKind = iota
+	keyRune
+	keyEnter
+	keyNewline
+	keyBackspace
+	keyDelete
+	keyLeft
+	keyRight
+	keyUp
+	keyDown
+	keyHome
+	keyEnd
+	keyWordLeft
+	keyWordRight
+	keyKillEnd
+	keyKillStart
+	keyKillWord
+	keyEOF
+	keyInterrupt
+	keySearch
+	keyCancel
+	keyClear
+	keyPaste
+)
+
+type key struct {
+	kind keyKind
+	r    rune
+	// Pasted text for keyPaste
+	text string
+}
+
+const pasteEnd = "\x1b[201~"
+
+// Read a single key press from a terminal in raw mode.
+func readKey(r *bufio.Reader) (key, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return key{}, err
+	}
+
+	switch b {
+	case '\r', '\n':
+		return key{kind: keyEnter}, nil
+	case 1:
+		return key{kind: keyHome}, nil
+	case 2:
+		return key{kind: keyLeft}, nil
+	case 3:
+		return key{kind: keyInterrupt}, nil
+	case 4:
+		return key{kind: keyEOF}, nil
+	case 5:
+		return key{kind: keyEnd}, nil
+	case 6:
+		return key{kind: keyRight}, nil
+	case 7:
+		return key{kind: keyCancel}, nil
+	case 8, 127:
+		return key{kind: keyBackspace}, nil
+	case 11:
+		return key{kind: keyKillEnd}, nil
+	case 12:
+		return key{kind: keyClear}, nil
+	case 14:
+		return key{kind: keyDown}, nil
+	case 16:
+		return key{kind: keyUp}, nil
+	case 18:
+		return key{kind: keySearch}, nil
+	case 21:
+		return key{kind: keyKillStart}, nil
+	case 23:
+		return key{kind: keyKillWord}, nil
+	case '\t':
+		return key{kind: keyRune, r: '\t'}, nil
+	case 27:
+		return readEscape(r)
+	}
+
+	if b < 32 {
+		return key{kind: keyUnknown}, nil
+	}
+
+	if b < utf8.RuneSelf {
+		return key{kind: keyRune, r: rune(b)}, nil
+	}
+
+	//Multi-byte rune
+	buf := []byte{b}
+	for !utf8.FullRune(buf) && len(buf) < utf8.UTFMax {
+		next, err := r.ReadByte()
+		if err != nil {
+			return key{}, err
+		}
+		buf = append(buf, next)
+	}
+	rn, _ := utf8.DecodeRune(buf)
+	return key{kind: keyRune, r: rn}, nil
+}
+
+func readEscape(r *bufio.Reader) (key, error) {
+	//A lone escape key
+	if r.Buffered() == 0 {
+		return key{kind: keyCancel}, nil
+	}
+
+	b, err := r.ReadByte()
+	if err != nil {
+		return key{}, err
+	}
+
+	switch b {
+	case '\r', '\n':
+		//Alt-Enter
+		return key{kind: keyNewline}, nil
+	case 'b':
+		return key{kind: keyWordLeft}, nil
+	case 'f':
+		return key{kind: keyWordRight}, nil
+	case '[', 'O':
+	default:
+		return key{kind: keyUnknown}, nil
+	}
+
+	//Control sequence: parameters followed by a final byte
+	params := []byte{}
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return key{}, err
+		}
+		if c >= 0x40 && c <= 0x7e {
+			return csiKey(r, string(params), c)
+		}
+		params = append(params, c)
+	}
+}
+
+func csiKey(r *bufio.Reader, params string, final byte) (key, error) {
+	modified := strings.HasSuffix(params, ";5") || strings.HasSuffix(params, ";3")
+
+	switch final {
+	case 'A':
+		return key{kind: keyUp}, nil
+	case 'B':
+		return key{kind: keyDown}, nil
+	case 'C':
+		if modified {
+			return key{kind: keyWordRight}, nil
+		}
+		return key{kind: keyRight}, nil
+	case 'D':
+		if modified {
+			return key{kind: keyWordLeft}, nil
+		}
+		return key{kind: keyLeft}, nil
+	case 'H':
+		return key{kind: keyHome}, nil
+	case 'F':
+		return key{kind: keyEnd}, nil
+	case '~':
+		switch params {
+		case "1", "7":
+			return key{kind: keyHome}, nil
+		case "4", "8":
+			return key{kind: keyEnd}, nil
+		case "3":
+			return key{kind: keyDelete}, nil
+		case "200":
+			text, err := readPaste(r)
+			return key{kind: keyPaste, text: text}, err
+		}
+	}
+
+	return key{kind: keyUnknown}, nil
+}
+
+// Read bracketed paste content up to the end marker.
+func readPaste(r *bufio.Reader) (string, error) {
+	buf := []byte{}
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return string(buf), err
+		}
+		buf = append(buf, b)
+
+		if bytes.HasSuffix(buf, []byte(pasteEnd)) {
+			text := string(buf[:len(buf)-len(pasteEnd)])
+			text = strings.ReplaceAll(text, "\r\n", "\n")
+			return strings.ReplaceAll(text, "\r", "\n"), nil
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package clitools
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+const tabWidth = 4
+
+// The state of the line being edited and how it was last drawn.
+type lineState struct {
+	out     io.Writer
+	prompt  string
+	width   int
+	buf     []rune
+	pos     int
+	history *promptHistory
+	// Index in history, len(entries) when editing a new line
+	histIdx int
+	// The new line, while browsing history
+	saved []rune
+
+	searching bool
+	query     []rune
+	// Index of the current search match, -1 if there is none
+	match int
+
+	// Row of the cursor relative to the first drawn row
+	cursorRow int
+}
+
+func newLineState(out io.Writer, prompt string, width int, history *promptHistory) *lineState {
+	if width < 1 {
+		width = 80
+	}
+
+	return &lineState{
+		out:     out,
+		prompt:  prompt,
+		width:   width,
+		history: history,
+		histIdx: len(history.entries),
+		match:   -1,
+	}
+}
+
+// Handle a key. Returns true when the line is done.
+func (s *lineState) handle(k key) (done bool, eof bool) {
+	if s.searching && s.handleSearch(k) {
+		return false, false
+	}
+
+	switch k.kind {
+	case keyRune:
+		s.insert([]rune{k.r})
+	case keyPaste:
+		s.insert([]rune(k.text))
+	case keyNewline:
+		s.insert([]rune{'\n'})
+	case keyEnter:
+		return true, false
+	case keyBackspace:
+		if s.pos > 0 {
+			s.buf = append(s.buf[:s.pos-1], s.buf[s.pos:]...)
+			s.pos--
+		}
+	case keyDelete:
+		if s.pos < len(s.buf) {
+			s.buf = append(s.buf[:s.pos], s.buf[s.pos+1:]...)
+		}
+	case keyLeft:
+		if s.pos > 0 {
+			s.pos--
+		}
+	case keyRight:
+		if s.pos < len(s.buf) {
+			s.pos++
+		}
+	case keyHome:
+		s.pos = s.lineStart()
+	case keyEnd:
+		s.pos = s.lineEnd()
+	case keyWordLeft:
+		s.pos = s.wordLeft()
+	case keyWordRight:
+		s.pos = s.wordRight()
+	case keyKillEnd:
+		s.buf = append(s.buf[:s.pos], s.buf[s.lineEnd():]...)
+	case keyKillStart:
+		start := s.lineStart()
+		s.buf = append(s.buf[:start], s.buf[s.pos:]...)
+		s.pos = start
+	case keyKillWord:
+		start := s.wordLeft()
+		s.buf = append(s.buf[:start], s.buf[s.pos:]...)
+		s.pos = start
+	case keyUp:
+		s.historyPrev()
+	case keyDown:
+		s.historyNext()
+	case keySearch:
+		s.searching = true
+		s.query = []rune{}
+		s.match = -1
+	case keyEOF:
+		if len(s.buf) == 0 {
+			return true, true
+		}
+		if s.pos < len(s.buf) {
+			s.buf = append(s.buf[:s.pos], s.buf[s.pos+1:]...)
+		}
+	case keyInterrupt:
+		if len(s.buf) == 0 {
+			return true, true
+		}
+		s.buf = []rune{}
+		s.pos = 0
+	case keyClear:
+		fmt.Fprint(s.out, "\x1b[H\x1b[2J")
+		s.cursorRow = 0
+	}
+
+	return false, false
+}
+
+// Handle a key in search mode. Returns false if the key should also be handled as a normal key.
+func (s *lineState) handleSearch(k key) bool {
+	switch k.kind {
+	case keyRune:
+		s.query = append(s.query, k.r)
+		from := s.match
+		if from == -1 {
+			from = len(s.history.entries) - 1
+		}
+		s.search(from)
+		return true
+	case keyBackspace:
+		if len(s.query) > 0 {
+			s.query = s.query[:len(s.query)-1]
+		}
+		s.search(len(s.history.entries) - 1)
+		return true
+	case keySearch:
+		if s.match > 0 {
+			s.search(s.match - 1)
+		}
+		return true
+	case keyCancel, keyInterrupt:
+		s.searching = false
+		return true
+	}
+
+	//Accept the match and continue with normal editing
+	s.searching = false
+	if s.match != -1 {
+		s.buf = []rune(s.history.entries[s.match])
+		s.pos = len(s.buf)
+	}
+	return false
+}
+
+// Find the most recent history entry at or before index from that contains the query.
+func (s *lineState) search(from int) {
+	q := string(s.query)
+	for i := from; i >= 0; i-- {
+		if strings.Contains(s.history.entries[i], q) {
+			s.match = i
+			return
+		}
+	}
+	s.match = -1
+}
+
+func (s *lineState) insert(runes []rune) {
+	tail := append(runes, s.buf[s.pos:]...)
+	s.buf = append(s.buf[:s.pos], tail...)
+	s.pos += len(runes)
+}
+
+func (s *lineState) historyPrev() {
+	if s.histIdx == 0 {
+		return
+	}
+	if s.histIdx == len(s.history.entries) {
+		s.saved = s.buf
+	}
+	s.histIdx--
+	s.buf = []rune(s.history.entries[s.histIdx])
+	s.pos = len(s.buf)
+}
+
+func (s *lineState) historyNext() {
+	if s.histIdx >= len(s.history.entries) {
+		return
+	}
+	s.histIdx++
+	if s.histIdx == len(s.history.entries) {
+		s.buf = s.saved
+	} else {
+		s.buf = []rune(s.history.entries[s.histIdx])
+	}
+	s.pos = len(s.buf)
+}
+
+// Start of the current line within a multi-line buffer
+func (s *lineState) lineStart() int {
+	for i := s.pos - 1; i >= 0; i-- {
+		if s.buf[i] == '\n' {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// End of the current line within a multi-line buffer
+func (s *lineState) lineEnd() int {
+	for i := s.pos; i < len(s.buf); i++ {
+		if s.buf[i] == '\n' {
+			return i
+		}
+	}
+	return len(s.buf)
+}
+
+func (s *lineState) wordLeft() int {
+	i := s.pos
+	for i > 0 && !isWordRune(s.buf[i-1]) {
+		i--
+	}
+	for i > 0 && isWordRune(s.buf[i-1]) {
+		i--
+	}
+	return i
+}
+
+func (s *lineState) wordRight() int {
+	i := s.pos
+	for i < len(s.buf) && !isWordRune(s.buf[i]) {
+		i++
+	}
+	for i < len(s.buf) && isWordRune(s.buf[i]) {
+		i++
+	}
+	return i
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// Redraw the prompt and buffer, and place the cursor.
+func (s *lineState) render() {
+	prefix := []rune(s.prompt)
+	text := s.buf
+	cursor := len(prefix) + s.pos
+
+	if s.searching {
+		label := "reverse-i-search"
+		if s.match == -1 && len(s.query) > 0 {
+			label = "failing reverse-i-search"
+		}
+		prefix = []rune(fmt.Sprintf("(%v)`%v': ", label, string(s.query)))
+		text = []rune{}
+		if s.match != -1 {
+			text = []rune(s.history.entries[s.match])
+		}
+		cursor = len(prefix) + len(text)
+	}
+
+	content, cursor := expandTabs(append(append([]rune{}, prefix...), text...), cursor)
+
+	sb := strings.Builder{}
+	//Back to the first row and clear everything below
+	if s.cursorRow > 0 {
+		sb.WriteString(fmt.Sprintf("\x1b[%dA", s.cursorRow))
+	}
+	sb.WriteString("\r\x1b[J")
+
+	for _, r := range content {
+		if r == '\n' {
+			sb.WriteString("\r\n")
+		} else {
+			sb.WriteRune(r)
+		}
+	}
+
+	endRow, _, pendingWrap := s.position(content, len(content))
+	if pendingWrap {
+		//The terminal waits at the last column, move it to the next row ourselves.
+		sb.WriteString("\r\n")
+	}
+
+	row, col, _ := s.position(content, cursor)
+	if endRow > row {
+		sb.WriteString(fmt.Sprintf("\x1b[%dA", endRow-row))
+	}
+	sb.WriteString("\r")
+	if col > 0 {
+		sb.WriteString(fmt.Sprintf("\x1b[%dC", col))
+	}
+
+	s.cursorRow = row
+	fmt.Fprint(s.out, sb.String())
+}
+
+// Row and column on screen of the rune at index n of content. Wrapping at the last column moves to the next row.
+func (s *lineState) position(content []rune, n int) (row int, col int, pendingWrap bool) {
+	for _, r := range content[:n] {
+		if r == '\n' {
+			row++
+			col = 0
+			continue
+		}
+
+		if col == s.width {
+			row++
+			col = 0
+		}
+		col++
+	}
+
+	if col >= s.width {
+		return row + 1, 0, true
+	}
+
+	return row, col, false
+}
+
+// Replace tabs with spaces and move the cursor index along.
+func expandTabs(content []rune, cursor int) ([]rune, int) {
+	result := make([]rune, 0, len(content))
+	newCursor := cursor
+	for i, r := range content {
+		if r != '\t' {
+			result = append(result, r)
+			continue
+		}
+
+		for j := 0; j < tabWidth; j++ {
+			result = append(result, ' ')
+		}
+		if i < cursor {
+			newCursor += tabWidth - 1
+		}
+	}
+	return result, newCursor
+}
@@ -0,0 +1,95 @@
+package clitools
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const maxPromptHistory = 1000
+
+// Prompts the user entered before. Stored as one JSON string per line, so multi-line prompts survive.
+type promptHistory struct {
+	path    string
+	entries []string
+}
+
+// Load history from path. An empty path keeps history in memory only.
+func loadPromptHistory(path string) *promptHistory {
+	h := &promptHistory{path: path}
+	if path == "" {
+		return h
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return h
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		entry := ""
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil && entry != "" {
+			h.entries = append(h.entries, entry)
+		}
+	}
+
+	if len(h.entries) > maxPromptHistory {
+		h.entries = h.entries[len(h.entries)-maxPromptHistory:]
+	}
+
+	return h
+}
+
+func (h *promptHistory) add(entry string) {
+	if strings.TrimSpace(entry) == "" {
+		return
+	}
+
+	if len(h.entries) > 0 && h.entries[len(h.entries)-1] == entry {
+		return
+	}
+
+	h.entries = append(h.entries, entry)
+	if len(h.entries) > maxPromptHistory {
+		h.entries = h.entries[len(h.entries)-maxPromptHistory:]
+		h.rewrite()
+		return
+	}
+
+	h.append(entry)
+}
+
+func (h *promptHistory) append(entry string) {
+	if h.path == "" {
+		return
+	}
+
+	os.MkdirAll(filepath.Dir(h.path), 0700)
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	line, _ := json.Marshal(entry)
+	f.Write(append(line, '\n'))
+}
+
+func (h *promptHistory) rewrite() {
+	if h.path == "" {
+		return
+	}
+
+	lines := make([]string, 0, len(h.entries))
+	for _, e := range h.entries {
+		line, _ := json.Marshal(e)
+		lines = append(lines, string(line))
+	}
+
+	os.WriteFile(h.path, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+}
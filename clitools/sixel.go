@@ -0,0 +1,134 @@
+package clitools
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"io"
+	"strings"
+)
+
+// Terminals don't tell how wide a cell is, most are about this many pixels
+const sixelCellWidth = 10
+
+// Sixel has no compression, big images are slow. Images are scaled down to at most this wide.
+const sixelMaxWidth = 800
+
+// Writes an image as sixel: scaled to columns, with a palette of 256 colors.
+func writeSixel(w io.Writer, data []byte, columns int) error {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("could not decode image: %w", err)
+	}
+
+	width := sixelMaxWidth
+	if columns > 0 {
+		width = min(width, columns*sixelCellWidth)
+	}
+	scaled := scale(img, width)
+
+	bounds := scaled.Bounds()
+	paletted := image.NewPaletted(bounds, palette.Plan9)
+	draw.FloydSteinberg.Draw(paletted, bounds, scaled, image.Point{})
+
+	_, err = io.WriteString(w, encodeSixel(paletted)+"\n")
+	return err
+}
+
+// Scales an image down to at most width pixels wide, keeping its aspect ratio.
+func scale(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() <= width {
+		return img
+	}
+
+	height := max(bounds.Dy()*width/bounds.Dx(), 1)
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			scaled.Set(x, y, img.At(bounds.Min.X+x*bounds.Dx()/width, bounds.Min.Y+y*bounds.Dy()/height))
+		}
+	}
+	return scaled
+}
+
+// Encodes the image in bands of six rows. Each color of a band is a row of sixel characters.
+func encodeSixel(img *image.Paletted) string {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	sb := &strings.Builder{}
+	sb.WriteString("\x1bP0;1;0q")
+	fmt.Fprintf(sb, "\"1;1;%v;%v", width, height)
+
+	used := make([]bool, len(img.Palette))
+	for _, i := range img.Pix {
+		used[i] = true
+	}
+	for i, c := range img.Palette {
+		if !used[i] {
+			continue
+		}
+		r, g, b, _ := c.RGBA()
+		fmt.Fprintf(sb, "#%v;2;%v;%v;%v", i, r*100/0xFFFF, g*100/0xFFFF, b*100/0xFFFF)
+	}
+
+	row := make([]byte, width)
+	for band := 0; band < height; band += 6 {
+		colors := map[uint8]bool{}
+		for y := band; y < min(band+6, height); y++ {
+			for x := range width {
+				colors[img.ColorIndexAt(bounds.Min.X+x, bounds.Min.Y+y)] = true
+			}
+		}
+
+		first := true
+		for c := range len(img.Palette) {
+			if !colors[uint8(c)] {
+				continue
+			}
+
+			for x := range width {
+				bits := 0
+				for dy := range 6 {
+					y := band + dy
+					if y < height && img.ColorIndexAt(bounds.Min.X+x, bounds.Min.Y+y) == uint8(c) {
+						bits |= 1 << dy
+					}
+				}
+				row[x] = byte(63 + bits)
+			}
+
+			//Back to the start of the band for the next color
+			if !first {
+				sb.WriteByte('$')
+			}
+			first = false
+			fmt.Fprintf(sb, "#%v", c)
+			writeSixelRow(sb, bytes.TrimRight(row, "?"))
+		}
+		sb.WriteByte('-')
+	}
+
+	sb.WriteString("\x1b\\")
+	return sb.String()
+}
+
+// Writes a row of sixel characters, with runs of the same character as !<count><character>.
+func writeSixelRow(sb *strings.Builder, row []byte) {
+	for i := 0; i < len(row); {
+		run := 1
+		for i+run < len(row) && row[i+run] == row[i] {
+			run++
+		}
+
+		if run > 3 {
+			fmt.Fprintf(sb, "!%v%c", run, row[i])
+		} else {
+			sb.Write(row[i : i+run])
+		}
+		i += run
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/c00/botman-v2/chattools"
+	"github.com/c00/botman-v2/chattools/imagetool"
+	"github.com/c00/botman-v2/clitools"
+	"github.com/c00/botman-v2/internal/config"
+	"github.com/c00/botman-v2/internal/history"
+	"github.com/c00/botman-v2/internal/mainloop"
+	"github.com/spf13/cobra"
+)
+
+var imageConfigFlag *string
+var imageToolFlag *string
+var imageNFlag *int
+var imageSeedFlag *uint32
+var imageNegativeFlag *string
+
+// The most columns a preview takes
+const previewColumns = 48
+
+var imageCmd = &cobra.Command{
+	Use:   "image [prompt]",
+	Short: "Generate images with the image tool of the config, without a model",
+	Args:  cobra.ArbitraryArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		pipedIn, err := clitools.GetPipedIn()
+		if err != nil {
+			log.Error2(err)
+			os.Exit(1)
+		}
+
+		prompt := strings.TrimSpace(fmt.Sprintf("%v %v", pipedIn, strings.Join(args, " ")))
+		if prompt == "" {
+			cmd.Help()
+			return
+		}
+
+		if *imageConfigFlag == "" {
+			*imageConfigFlag = config.GetUserConfigFilename()
+		}
+		conf, err := config.Load(*imageConfigFlag)
+		if err != nil {
+			log.Error2(err)
+			os.Exit(1)
+		}
+		conf.InjectApiKeys()
+
+		store, err := getStorageProvider(conf.Storage)
+		if err != nil {
+			log.Error("cannot instantiate storage provider: %v", err)
+			os.Exit(1)
+		}
+
+		tool, err := getImageTool(conf.Tools, *imageToolFlag, store)
+		if err != nil {
+			log.Error2(err)
+			os.Exit(1)
+		}
+
+		result := tool.Generate(context.Background(), imagetool.Request{
+			Prompt:         prompt,
+			NegativePrompt: *imageNegativeFlag,
+			N:              *imageNFlag,
+			Seed:           *imageSeedFlag,
+		})
+		if !result.Success {
+			log.Error("%v", result.Content)
+			os.Exit(1)
+		}
+		log.Debug("%v", result.Content)
+
+		images, ok := result.Value.(imagetool.Result)
+		if !ok {
+			log.Log("%v", result.Content)
+			return
+		}
+
+		preview := mainloop.ImagePreview{Store: store, Protocol: imageProtocol(), Columns: previewWidth()}
+		for _, path := range images.Paths() {
+			fmt.Println(path)
+			if preview.Protocol != clitools.ImageProtocolNone {
+				preview.ShowPath(os.Stdout, path)
+			}
+		}
+	},
+}
+
+func init() {
+	imageConfigFlag = imageCmd.Flags().StringP("config", "", "", "Use configuration file")
+	imageToolFlag = imageCmd.Flags().StringP("tool", "", "", "The name of the image tool to use. Defaults to the first image tool in the config")
+	imageNFlag = imageCmd.Flags().IntP("n", "", 0, "The number of images (default is the setting of the tool)")
+	imageSeedFlag = imageCmd.Flags().Uint32P("seed", "", 0, "The seed of the images (0 is random)")
+	imageNegativeFlag = imageCmd.Flags().StringP("negative", "", "", "The negative prompt")
+
+	rootCmd.AddCommand(imageCmd)
+}
+
+// The image tool to generate with: the one named name, or else the first image tool in the config.
+func getImageTool(defs []chattools.ToolDefinition, name string, store chattools.Storage) (imagetool.Generator, error) {
+	for _, def := range defs {
+		if name != "" && def.Name != name {
+			continue
+		}
+
+		tool, err := chattools.DefaultRegistry.New(def, chattools.Env{Storage: store})
+		if err != nil {
+			if name != "" {
+				return nil, fmt.Errorf("cannot create tool %v: %w", name, err)
+			}
+			log.Debug("skipped tool %v: %v", def.Name, err)
+			continue
+		}
+
+		generator, ok := tool.(imagetool.Generator)
+		if ok {
+			return generator, nil
+		}
+		if name != "" {
+			return nil, fmt.Errorf("tool %v does not generate images", name)
+		}
+	}
+
+	if name != "" {
+		return nil, fmt.Errorf("there is no tool %v in the config", name)
+	}
+	return nil, fmt.Errorf("there is no image tool in the config, add a tool of type %v, %v or %v", chattools.ToolTypeSdxl, chattools.ToolTypeDalle, chattools.ToolTypeLocalSd)
+}
+
+// The protocol to show images in the terminal with. None with --no-images.
+func imageProtocol() string {
+	if *noImagesFlag {
+		return clitools.ImageProtocolNone
+	}
+	return clitools.DetectImageProtocol(os.Stdout)
+}
+
+func previewWidth() int {
+	return min(clitools.TerminalWidth(os.Stdout), previewColumns)
+}
+
+// Print a conversation, with the images tools saved in it if the terminal can show them.
+func printHistory(chat history.HistoryEntry, conf config.StorageConfig) {
+	protocol := imageProtocol()
+	if protocol == clitools.ImageProtocolNone {
+		chat.Print()
+		return
+	}
+
+	store, err := getStorageProvider(conf)
+	if err != nil {
+		log.Debug("no images, cannot instantiate storage provider: %v", err)
+		chat.Print()
+		return
+	}
+
+	preview := mainloop.ImagePreview{Store: store, Protocol: protocol, Columns: previewWidth()}
+	chat.FprintWithImages(os.Stdout, preview.Show)
+}
+
+// Print how a generated image was made. The file is a path, or the name of an image in the configured storage.
+func inspectImage(file string) {
+	data, err := loadImage(file)
+	if err != nil {
+		log.Error2(err)
+		os.Exit(1)
+	}
+
+	fields, err := imagetool.ReadFields(data)
+	if err != nil {
+		log.Error2(err)
+		os.Exit(1)
+	}
+	if len(fields) == 0 {
+		log.Log("%v has no metadata", file)
+		return
+	}
+	printFields(os.Stdout, fields)
+}
+
+// Reads an image from a file, or else from the configured storage.
+func loadImage(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return data, err
+	}
+
+	conf, confErr := config.Load(config.GetUserConfigFilename())
+	if confErr != nil {
+		return nil, err
+	}
+	store, storeErr := getStorageProvider(conf.Storage)
+	if storeErr != nil {
+		return nil, err
+	}
+
+	data, storeErr = store.Load(filepath.Base(path))
+	if storeErr != nil {
+		return nil, fmt.Errorf("could not find image %v: %w", path, storeErr)
+	}
+	return data, nil
+}
+
+// Prints fields as key: value. Values of more lines go below their key, indented.
+func printFields(w io.Writer, fields []imagetool.Field) {
+	for _, f := range fields {
+		if !strings.Contains(f.Value, "\n") {
+			fmt.Fprintf(w, "%v: %v\n", f.Key, f.Value)
+			continue
+		}
+
+		fmt.Fprintf(w, "%v:\n", f.Key)
+		for _, line := range strings.Split(f.Value, "\n") {
+			fmt.Fprintf(w, "  %v\n", line)
+		}
+	}
+}
@@ -1,18 +1,29 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/c00/botman-v2/chatbot"
+	"github.com/c00/botman-v2/chattools"
 	"github.com/c00/botman-v2/clitools"
 	botman "github.com/c00/botman-v2/internal/cmd"
 	"github.com/c00/botman-v2/internal/config"
+	"github.com/c00/botman-v2/internal/contextwindow"
+	"github.com/c00/botman-v2/internal/events"
 	"github.com/c00/botman-v2/internal/history"
+	"github.com/c00/botman-v2/internal/limits"
 	"github.com/c00/botman-v2/internal/logger"
 	"github.com/c00/botman-v2/internal/mainloop"
+	"github.com/c00/botman-v2/internal/markdown"
 	"github.com/c00/botman-v2/internal/storageprovider"
+	"github.com/c00/botman-v2/jsonschema"
 	"github.com/spf13/cobra"
 )
 
@@ -20,27 +31,67 @@ var verbosity int
 var versionFlag *bool
 var helpFlag *bool
 var interactiveFlag *bool
-var historyFlag *int
+var historyFlag *string
 var configFile *string
 var continueFlag *bool
 var lastFlag *bool
+var editFlag *bool
+var rawFlag *bool
+var codeFlag *bool
+var blockFlag *int
+var langFlag *string
+var jsonFlag *bool
+var maxToolRoundsFlag *int
+var maxTurnsFlag *int
+var maxTokensFlag *int
+var maxTimeFlag *time.Duration
+var approvalFlag *string
+var toolChoiceFlag *string
+var noParallelToolsFlag *bool
+var schemaFlag *string
+var schemaRetriesFlag *int
+var noImagesFlag *bool
+var inspectImageFlag *string
 
 var log = logger.New("main")
 
 func init() {
 	rootCmd.PersistentFlags().CountVarP(&verbosity, "verbose", "v", "increase verbosity")
+	noImagesFlag = rootCmd.PersistentFlags().BoolP("no-images", "", false, "Do not show generated images in the terminal")
 	versionFlag = rootCmd.Flags().BoolP("version", "", false, "Prints the version")
 	helpFlag = rootCmd.Flags().BoolP("help", "", false, "Prints help")
 	interactiveFlag = rootCmd.Flags().BoolP("interactive", "i", false, "Creates an interactive chat session rather than a single response")
 	configFile = rootCmd.Flags().StringP("config", "", "", "Use configuration file")
 	continueFlag = rootCmd.Flags().BoolP("continue", "c", false, "Continue the last conversation. Does not show the conversation so far. Use -ih 0 for that instead.")
-	historyFlag = rootCmd.Flags().IntP("history", "h", -1, "Show historical chat, looking baxk [n] chats. Can be combined with -i to continue conversation")
+	historyFlag = rootCmd.Flags().StringP("history", "h", "", "Show historical chat, looking back [n] chats, or the chat saved with /save [name]. Can be combined with -i to continue conversation")
 	lastFlag = rootCmd.Flags().BoolP("last", "l", false, "Print last response")
+	editFlag = rootCmd.Flags().BoolP("edit", "e", false, "Write the prompt in $EDITOR. Piped input and arguments are added to the prompt.")
+	rawFlag = rootCmd.Flags().BoolP("raw", "", false, "Print responses as they are, without rendering Markdown")
+	codeFlag = rootCmd.Flags().BoolP("code", "", false, "Only print the code blocks of responses. Works with -l and --history")
+	blockFlag = rootCmd.Flags().IntP("block", "", 0, "Only print code block [n], starting at 1. Implies --code")
+	langFlag = rootCmd.Flags().StringP("lang", "", "", "Only print code blocks in this language. Implies --code")
+	jsonFlag = rootCmd.Flags().BoolP("json", "", false, "Write NDJSON events instead of text. Works with -l and --history")
+	maxToolRoundsFlag = rootCmd.Flags().IntP("max-tool-rounds", "", 0, fmt.Sprintf("Stop calling tools after [n] rounds per prompt (default %v, 0 is unlimited)", limits.DefaultMaxToolRounds))
+	maxTurnsFlag = rootCmd.Flags().IntP("max-turns", "", 0, "Stop after [n] prompts (0 is unlimited)")
+	maxTokensFlag = rootCmd.Flags().IntP("max-tokens", "", 0, "Stop after using about [n] tokens (0 is unlimited)")
+	maxTimeFlag = rootCmd.Flags().DurationP("max-time", "", 0, "Stop after this long, e.g. 5m (0 is unlimited)")
+	approvalFlag = rootCmd.Flags().StringP("approval", "", "", "Approval mode for all tools: auto, ask or deny. Overrides the config")
+	toolChoiceFlag = rootCmd.Flags().StringP("tool-choice", "", "", "Whether the model calls tools in response to prompts: auto, none, any or tool:<name>")
+	noParallelToolsFlag = rootCmd.Flags().BoolP("no-parallel-tools", "", false, "Let the model call at most one tool per response")
+	schemaFlag = rootCmd.Flags().StringP("schema", "", "", "Answer with only JSON that matches the JSON schema in this file")
+	schemaRetriesFlag = rootCmd.Flags().IntP("schema-retries", "", mainloop.DefaultSchemaRetries, "Ask again [n] times when a response does not match --schema")
+	inspectImageFlag = rootCmd.Flags().StringP("inspect-image", "", "", "Show how a generated image was made. A path, or the name of an image in the configured storage")
+
+	//Arguments are a prompt, so help and completion are not commands
+	rootCmd.CompletionOptions.DisableDefaultCmd = true
+	rootCmd.SetHelpCommand(&cobra.Command{Use: "__help", Hidden: true, Run: func(cmd *cobra.Command, args []string) {}})
 }
 
 var rootCmd = &cobra.Command{
 	Use:   binary,
 	Short: fmt.Sprintf("%v is a tool for talking to LLMs.", binary),
+	//Arguments are the prompt, unless they start with the image subcommand
+	Args: cobra.ArbitraryArgs,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
 		verboseFlags, err := cmd.Flags().GetCount("verbose")
 		if err != nil {
@@ -68,6 +119,11 @@ var rootCmd = &cobra.Command{
 			return
 		}
 
+		if *inspectImageFlag != "" {
+			inspectImage(*inspectImageFlag)
+			return
+		}
+
 		if *configFile == "" {
 			*configFile = config.GetUserConfigFilename()
 		}
@@ -91,30 +147,53 @@ var rootCmd = &cobra.Command{
 		histKeeper := history.NewYamlHistory(histPath)
 		var activeConversation *history.HistoryEntry
 
+		codeFilter := markdown.BlockFilter{Lang: *langFlag, Block: *blockFlag}
+		filterCode := *codeFlag || *blockFlag > 0 || *langFlag != ""
+
 		if *lastFlag {
 			chat, err := histKeeper.LoadChat(0)
 			if err != nil {
 				log.Error("could not load chat: %v", err)
 				return
 			}
+			if *jsonFlag {
+				if len(chat.Messages) > 0 {
+					events.NewWriter(os.Stdout).Write(events.FromMessage(chat.Messages[len(chat.Messages)-1], true)...)
+				}
+				return
+			}
+			if filterCode {
+				printCodeBlocks(chat.CodeBlocks(true), codeFilter)
+				return
+			}
 			chat.PrintLastMessage()
 			return
 		}
 
 		//history
 		if *continueFlag {
-			*historyFlag = 0
+			*historyFlag = "0"
 			*interactiveFlag = true
 		}
-		if *historyFlag > -1 {
-			chat, err := histKeeper.LoadChat(*historyFlag)
+		if *historyFlag != "" {
+			chat, err := loadChat(histKeeper, *historyFlag)
 			if err != nil {
 				log.Error("could not load chat: %v", err)
 				return
 			}
 
-			if !*continueFlag {
-				chat.Print()
+			if *jsonFlag && !*interactiveFlag {
+				events.NewWriter(os.Stdout).Write(events.FromHistory(chat)...)
+				return
+			}
+
+			if filterCode && !*interactiveFlag {
+				printCodeBlocks(chat.CodeBlocks(false), codeFilter)
+				return
+			}
+
+			if !*continueFlag && !*jsonFlag {
+				printHistory(chat, conf.Storage)
 			}
 
 			if !*interactiveFlag {
@@ -131,6 +210,24 @@ var rootCmd = &cobra.Command{
 
 		prompt := strings.TrimSpace(fmt.Sprintf("%v %v", pipedIn, strings.Join(args, " ")))
 
+		if *editFlag {
+			tail := ""
+			if activeConversation != nil {
+				tail = activeConversation.Tail(mainloop.EditorTailMessages)
+			}
+
+			prompt, err = clitools.EditText(prompt, tail)
+			if err != nil {
+				log.Error2(err)
+				os.Exit(1)
+			}
+
+			if prompt == "" {
+				log.Log("Empty prompt, nothing was sent.")
+				return
+			}
+		}
+
 		if prompt == "" {
 			*interactiveFlag = true
 		}
@@ -142,13 +239,80 @@ var rootCmd = &cobra.Command{
 		}
 
 		ml := mainloop.New(chatter, histKeeper, store, *interactiveFlag, 0, os.Stdin, os.Stdout)
+		promptHistory := ""
+		if conf.SaveHistory {
+			promptHistory = filepath.Join(config.GetUserConfigPath(), "prompt-history")
+		}
+		ml.SetLineReader(clitools.NewLineEditor(os.Stdin, os.Stdout, promptHistory))
+		if *jsonFlag {
+			//Keep prompts out of the events
+			ml.SetLineReader(clitools.BasicReader{In: os.Stdin, Out: io.Discard})
+			ml.SetEventWriter(events.NewWriter(os.Stdout))
+		} else if filterCode {
+			ml.SetCodeFilter(codeFilter)
+		} else if !*rawFlag {
+			//Only render on a terminal, piped output stays as the model wrote it
+			ml.SetMarkdown(clitools.TerminalWidth(os.Stdout))
+		}
+		ml.SetChatterFactory(func(provider string, model string) (chatbot.Chatter, string, error) {
+			c := conf
+			c.LlmProvider = provider
+			if model != "" {
+				c.SetModel(model)
+			}
+			chatter, err := getChatter(c)
+			return chatter, c.Model(), err
+		}, conf.LlmProvider, conf.Model())
 		if conf.Tools != nil {
 			ml.SetTools(conf.Tools)
 		}
 		if activeConversation != nil {
 			ml.SetConversation(*activeConversation)
 		}
-		ml.Start(prompt)
+		ml.SetContextWindow(contextwindow.New(conf.Model(), conf.Context))
+		ml.SetCompaction(conf.Compaction)
+		ml.SetBudget(getBudget(cmd, conf.Budget))
+		ml.SetToolConcurrency(conf.ToolConcurrency)
+		ml.SetImagePreview(imageProtocol(), previewWidth())
+		switch *approvalFlag {
+		case "", chattools.ApprovalAuto, chattools.ApprovalAsk, chattools.ApprovalDeny:
+			ml.SetApprovalOverride(*approvalFlag)
+		default:
+			log.Error("unknown approval mode %v, use auto, ask or deny", *approvalFlag)
+			os.Exit(1)
+		}
+		toolChoice, err := chattools.ParseToolChoice(*toolChoiceFlag)
+		if err != nil {
+			log.Error2(err)
+			os.Exit(1)
+		}
+		toolChoice.DisableParallel = *noParallelToolsFlag
+		ml.SetToolChoice(toolChoice)
+		if *schemaFlag != "" {
+			schema, err := loadSchema(*schemaFlag)
+			if err != nil {
+				log.Error2(err)
+				os.Exit(1)
+			}
+			ml.SetResponseSchema(schema, *schemaRetriesFlag)
+		}
+		if conf.Compaction.Model != "" {
+			summarizerConf := conf
+			summarizerConf.SetModel(conf.Compaction.Model)
+			summarizer, err := getChatter(summarizerConf)
+			if err != nil {
+				log.Error("cannot instantiate summarizer: %v", err)
+				os.Exit(1)
+			}
+			ml.SetSummarizer(summarizer)
+		}
+		ml.StartMcpServers(conf.McpServers)
+		err = ml.Start(prompt)
+		ml.Close()
+		if err != nil {
+			log.Error2(err)
+			os.Exit(1)
+		}
 
 		log.Debug("Main loop finished.")
 	},
@@ -177,3 +341,52 @@ func getStorageProvider(conf config.StorageConfig) (storageprovider.StorageProvi
 
 	return nil, fmt.Errorf("unknown storage provider: %v", conf.Type)
 }
+
+func loadSchema(filename string) (jsonschema.JsonSchema, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return jsonschema.JsonSchema{}, fmt.Errorf("could not read schema: %w", err)
+	}
+
+	schema := jsonschema.JsonSchema{}
+	err = json.Unmarshal(data, &schema)
+	if err != nil {
+		return jsonschema.JsonSchema{}, fmt.Errorf("could not parse schema %v: %w", filename, err)
+	}
+	return schema, nil
+}
+
+func printCodeBlocks(blocks []chatbot.CodeBlock, filter markdown.BlockFilter) {
+	selected := filter.Select(blocks)
+	if len(selected) == 0 {
+		log.Error("no matching code blocks found")
+		os.Exit(1)
+	}
+	markdown.FprintCodeBlocks(os.Stdout, selected)
+}
+
+// Load a chat by lookback, or else by the title it was saved with.
+func loadChat(keeper history.HistoryKeeper, ref string) (history.HistoryEntry, error) {
+	lookback, err := strconv.Atoi(ref)
+	if err == nil {
+		return keeper.LoadChat(lookback)
+	}
+	return keeper.FindChat(ref)
+}
+
+// The budget from the config, with flags that were given on top.
+func getBudget(cmd *cobra.Command, budget limits.Budget) limits.Budget {
+	if cmd.Flags().Changed("max-tool-rounds") {
+		budget.MaxToolRounds = *maxToolRoundsFlag
+	}
+	if cmd.Flags().Changed("max-turns") {
+		budget.MaxTurns = *maxTurnsFlag
+	}
+	if cmd.Flags().Changed("max-tokens") {
+		budget.MaxTokens = *maxTokensFlag
+	}
+	if cmd.Flags().Changed("max-time") {
+		budget.MaxTime = *maxTimeFlag
+	}
+	return budget
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRootCmd_PromptArgs(t *testing.T) {
+	//Added by cobra when the command runs
+	rootCmd.InitDefaultHelpCmd()
+	rootCmd.InitDefaultCompletionCmd()
+
+	prompts := [][]string{
+		{"help", "me", "write", "a", "loop"},
+		{"completion", "of", "sentence"},
+		{"inspect", "this", "code"},
+	}
+	for _, prompt := range prompts {
+		cmd, args, err := rootCmd.Find(prompt)
+		assert.Nil(t, err)
+		assert.Equal(t, rootCmd, cmd)
+		assert.Equal(t, prompt, args)
+	}
+
+	cmd, args, err := rootCmd.Find([]string{"image", "a", "gopher"})
+	assert.Nil(t, err)
+	assert.Equal(t, imageCmd, cmd)
+	assert.Equal(t, []string{"a", "gopher"}, args)
+}
@@ -2,6 +2,11 @@ package config
 
 import (
 	"github.com/c00/botman-v2/chattools"
+	"github.com/c00/botman-v2/chattools/dalle"
+	"github.com/c00/botman-v2/chattools/mcp"
+	"github.com/c00/botman-v2/chattools/sdxl"
+	"github.com/c00/botman-v2/internal/contextwindow"
+	"github.com/c00/botman-v2/internal/limits"
 	"github.com/c00/botman-v2/internal/storageprovider"
 	"github.com/c00/botman-v2/providers/claude"
 	"github.com/c00/botman-v2/providers/fireworks"
@@ -17,31 +22,72 @@ const LlmProviderYappie = "yappie"
 const currentVersion = 1
 
 type BotmanConfig struct {
-	Version      int                        `yaml:"version"`
-	SaveHistory  bool                       `yaml:"saveHistory"`
-	SystemPrompt string                     `yaml:"systemPrompt"`
-	LlmProvider  string                     `yaml:"llmProvider"`
-	OpenAi       openai.Config              `yaml:"openAi"`
-	FireworksAi  fireworks.Config           `yaml:"fireworksAi"`
-	Claude       claude.Config              `yaml:"claude"`
-	Tools        []chattools.ToolDefinition `yaml:"tools"`
-	Storage      StorageConfig              `yaml:"storage"`
+	Version      int                            `yaml:"version"`
+	SaveHistory  bool                           `yaml:"saveHistory"`
+	SystemPrompt string                         `yaml:"systemPrompt"`
+	LlmProvider  string                         `yaml:"llmProvider"`
+	OpenAi       openai.Config                  `yaml:"openAi"`
+	FireworksAi  fireworks.Config               `yaml:"fireworksAi"`
+	Claude       claude.Config                  `yaml:"claude"`
+	Tools        []chattools.ToolDefinition     `yaml:"tools"`
+	McpServers   []mcp.ServerConfig             `yaml:"mcpServers,omitempty"`
+	Storage      StorageConfig                  `yaml:"storage"`
+	Context      contextwindow.Config           `yaml:"context"`
+	Compaction   contextwindow.CompactionConfig `yaml:"compaction"`
+	Budget       limits.Budget                  `yaml:"budget"`
+	// Tool calls that run at the same time
+	ToolConcurrency int `yaml:"toolConcurrency"`
+}
+
+// Model returns the model of the configured LLM provider
+func (c BotmanConfig) Model() string {
+	switch c.LlmProvider {
+	case LlmProviderClaude:
+		return c.Claude.Model
+	case LlmProviderFireworksAi:
+		return c.FireworksAi.Model
+	case LlmProviderOpenAi:
+		return c.OpenAi.Model
+	}
+
+	return c.LlmProvider
+}
+
+// SetModel sets the model of the configured LLM provider
+func (c *BotmanConfig) SetModel(model string) {
+	switch c.LlmProvider {
+	case LlmProviderClaude:
+		c.Claude.Model = model
+	case LlmProviderFireworksAi:
+		c.FireworksAi.Model = model
+	case LlmProviderOpenAi:
+		c.OpenAi.Model = model
+	}
 }
 
 // Inject API keys as defined in the chatters into tools where needed (e.g. openAi key for Dall-e and Fireworks API key for SDXL)
 func (c *BotmanConfig) InjectApiKeys() {
-	for idx, t := range c.Tools {
-		changes := false
-
-		if t.SdxlSettings != nil && t.SdxlSettings.ApiKey == "" {
-			changes = true
-			t.SdxlSettings.ApiKey = c.FireworksAi.ApiKey
+	for idx := range c.Tools {
+		switch c.Tools[idx].ToolType {
+		case chattools.ToolTypeSdxl:
+			injectApiKey(&c.Tools[idx], c.FireworksAi.ApiKey, func(s *sdxl.Config) *string { return &s.ApiKey })
+		case chattools.ToolTypeDalle:
+			injectApiKey(&c.Tools[idx], c.OpenAi.ApiKey, func(s *dalle.Config) *string { return &s.ApiKey })
 		}
+	}
+}
 
-		if changes {
-			c.Tools[idx] = t
-		}
+// Set the api key in the settings of a tool, unless it has one.
+func injectApiKey[T any](t *chattools.ToolDefinition, key string, apiKey func(*T) *string) {
+	var settings T
+	err := t.DecodeSettings(&settings)
+	if err != nil || *apiKey(&settings) != "" {
+		return
 	}
+
+	//The tool stays as it is when its settings cannot be written
+	*apiKey(&settings) = key
+	t.SetSettings(settings)
 }
 
 // Currently only supports s3
@@ -7,13 +7,15 @@ import (
 	"path/filepath"
 	"strconv"
 
+	"github.com/c00/botman-v2/internal/contextwindow"
+	"github.com/c00/botman-v2/internal/limits"
 	"github.com/c00/botman-v2/providers/claude"
 	"github.com/c00/botman-v2/providers/fireworks"
 	"github.com/c00/botman-v2/providers/openai"
 	"gopkg.in/yaml.v3"
 )
 
-const defaultPrompt = "Be concise. If code or a cli command is asked, only return the code or command. Do not add code block backticks. Output in plain text"
+const defaultPrompt = "Be concise. If code or a cli command is asked, only return the code or command, in a fenced code block with its language."
 
 // New configuration with sane defaults
 func NewAppConfig() BotmanConfig {
@@ -32,6 +34,13 @@ func NewAppConfig() BotmanConfig {
 			Model:     "claude-3-5-sonnet-20240620",
 			MaxTokens: 1024,
 		},
+		Context: contextwindow.Config{
+			Strategy: contextwindow.StrategyDropOldest,
+		},
+		Budget: limits.Budget{
+			MaxToolRounds: limits.DefaultMaxToolRounds,
+		},
+		ToolConcurrency: limits.DefaultToolConcurrency,
 	}
 }
 
@@ -160,6 +169,9 @@ func LoadFromEnv() BotmanConfig {
 			SystemPrompt: stringFromEnv("BOTMAN_CLAUDE_PROMPT", def.Claude.SystemPrompt),
 			MaxTokens:    intFromEnv("BOTMAN_CLAUDE_MAX_TOKENS", def.Claude.MaxTokens),
 		},
+		Context:         def.Context,
+		Budget:          def.Budget,
+		ToolConcurrency: def.ToolConcurrency,
 	}
 }
 
@@ -0,0 +1,35 @@
+package contextwindow
+
+const (
+	// Drop the oldest turns until the conversation fits.
+	StrategyDropOldest = "drop-oldest"
+	// Keep the first and last turns, drop the ones in between.
+	StrategyKeepEnds = "keep-ends"
+	// Do not truncate, return an error instead.
+	StrategyRefuse = "refuse"
+)
+
+const defaultReserveTokens = 1024
+
+type Config struct {
+	// One of the Strategy constants. Defaults to drop-oldest.
+	Strategy string `yaml:"strategy"`
+	// Overrides the known context limit of the model.
+	MaxTokens int `yaml:"maxTokens,omitempty"`
+	// Tokens kept free for the response.
+	ReserveTokens int `yaml:"reserveTokens,omitempty"`
+	// Number of turns at the start of the conversation to keep with keep-ends. Defaults to 1.
+	KeepFirst int `yaml:"keepFirst,omitempty"`
+	// Number of turns at the end of the conversation to always keep.
+	KeepLast int `yaml:"keepLast,omitempty"`
+}
+
+type CompactionConfig struct {
+	// Compact automatically when the conversation uses more than this fraction of the
+	// context window, e.g. 0.8. Zero disables automatic compaction.
+	Threshold float64 `yaml:"threshold,omitempty"`
+	// Number of turns at the end of the conversation that are not summarized. Defaults to 2.
+	KeepLast int `yaml:"keepLast,omitempty"`
+	// Use this model of the configured provider for summaries instead of the active one.
+	Model string `yaml:"model,omitempty"`
+}
@@ -0,0 +1,140 @@
+package contextwindow
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/c00/botman-v2/chatbot"
+	"github.com/c00/botman-v2/internal/logger"
+)
+
+var log = logger.New("ContextWindow")
+
+var ErrContextOverflow = errors.New("conversation does not fit in the context window")
+
+func New(model string, cfg Config) *Window {
+	if cfg.Strategy == "" {
+		cfg.Strategy = StrategyDropOldest
+	}
+
+	if cfg.ReserveTokens == 0 {
+		cfg.ReserveTokens = defaultReserveTokens
+	}
+
+	if cfg.KeepLast < 1 {
+		cfg.KeepLast = 1
+	}
+
+	//Keeping no first turns is drop-oldest
+	if cfg.Strategy == StrategyKeepEnds && cfg.KeepFirst < 1 {
+		cfg.KeepFirst = 1
+	}
+
+	limit := cfg.MaxTokens
+	if limit == 0 {
+		limit = ModelLimit(model)
+	}
+
+	return &Window{
+		cfg:       cfg,
+		model:     model,
+		limit:     limit,
+		tokenizer: TokenizerFor(model),
+	}
+}
+
+// Window keeps the messages sent to a model within its context limit.
+type Window struct {
+	cfg       Config
+	model     string
+	limit     int
+	tokenizer Tokenizer
+}
+
+// SetModel switches the window to the limit and tokenizer of another model.
+func (w *Window) SetModel(model string) {
+	w.model = model
+	w.tokenizer = TokenizerFor(model)
+	if w.cfg.MaxTokens == 0 {
+		w.limit = ModelLimit(model)
+	}
+}
+
+// Budget is the number of tokens available for the system prompt and messages.
+func (w *Window) Budget() int {
+	return w.limit - w.cfg.ReserveTokens
+}
+
+// Count estimates the number of tokens for a system prompt and messages.
+func (w *Window) Count(systemPrompt string, messages []chatbot.ChatMessage) int {
+	count := w.tokenizer.CountTokens(systemPrompt)
+	for _, m := range messages {
+		count += countMessage(w.tokenizer, m)
+	}
+	return count
+}
+
+// Fit returns the messages that should be sent to the model. The returned slice is always a copy.
+// Messages are dropped per turn, so tool calls and their results are never split up.
+func (w *Window) Fit(systemPrompt string, messages []chatbot.ChatMessage) ([]chatbot.ChatMessage, error) {
+	total := w.Count(systemPrompt, messages)
+	if total <= w.Budget() {
+		return append([]chatbot.ChatMessage{}, messages...), nil
+	}
+
+	if w.cfg.Strategy == StrategyRefuse {
+		return nil, w.overflowError(total)
+	}
+
+	turns := SplitTurns(messages)
+
+	keepFirst := 0
+	if w.cfg.Strategy == StrategyKeepEnds {
+		keepFirst = w.cfg.KeepFirst
+	}
+	keepLast := w.cfg.KeepLast
+
+	if keepFirst+keepLast > len(turns) {
+		keepFirst = max(len(turns)-keepLast, 0)
+	}
+
+	//Drop turns right after the protected first turns until it fits.
+	dropped := 0
+	for total > w.Budget() && keepFirst+keepLast < len(turns) {
+		total -= w.Count("", turns[keepFirst])
+		dropped += len(turns[keepFirst])
+		turns = append(turns[:keepFirst], turns[keepFirst+1:]...)
+	}
+
+	if total > w.Budget() {
+		return nil, w.overflowError(total)
+	}
+
+	log.Warn("Dropped %v messages to fit the context window of %v", dropped, w.model)
+
+	result := []chatbot.ChatMessage{}
+	for _, t := range turns {
+		result = append(result, t...)
+	}
+
+	return result, nil
+}
+
+func (w *Window) overflowError(total int) error {
+	return fmt.Errorf("%w: needs ~%v tokens, %v allows %v (reserving %v for the response)", ErrContextOverflow, total, w.model, w.Budget(), w.cfg.ReserveTokens)
+}
+
+// SplitTurns splits messages into turns. A turn starts with a user message and contains everything
+// up to the next user message, so tool calls and their results always stay together.
+func SplitTurns(messages []chatbot.ChatMessage) [][]chatbot.ChatMessage {
+	turns := [][]chatbot.ChatMessage{}
+
+	for _, m := range messages {
+		if m.Role == chatbot.ChatMessageRoleUser || len(turns) == 0 {
+			turns = append(turns, []chatbot.ChatMessage{})
+		}
+		turns[len(turns)-1] = append(turns[len(turns)-1], m)
+	}
+
+	return turns
+}
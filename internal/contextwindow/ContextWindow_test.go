@@ -0,0 +1,115 @@
+package contextwindow
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/c00/botman-v2/chatbot"
+	"github.com/c00/botman-v2/chattools"
+	"github.com/stretchr/testify/assert"
+)
+
+// Each turn is roughly 110 tokens with the heuristic tokenizer
+func makeTurns(n int) []chatbot.ChatMessage {
+	msgs := []chatbot.ChatMessage{}
+	for i := 0; i < n; i++ {
+		msgs = append(msgs,
+			chatbot.ChatMessage{Role: chatbot.ChatMessageRoleUser, Content: strings.Repeat("a", 200)},
+			chatbot.ChatMessage{Role: chatbot.ChatMessageRoleAssistant, Content: strings.Repeat("b", 200)},
+		)
+	}
+	return msgs
+}
+
+func TestFitWithinLimit(t *testing.T) {
+	w := New("claude-3-haiku-20240307", Config{})
+	msgs := makeTurns(3)
+
+	got, err := w.Fit("system", msgs)
+	assert.Nil(t, err)
+	assert.Equal(t, msgs, got)
+}
+
+func TestFitDropOldest(t *testing.T) {
+	w := New("unknown", Config{MaxTokens: 400, ReserveTokens: 100})
+	msgs := makeTurns(5)
+
+	got, err := w.Fit("", msgs)
+	assert.Nil(t, err)
+	assert.Len(t, got, 4)
+	assert.Equal(t, msgs[6:], got)
+}
+
+func TestFitKeepEnds(t *testing.T) {
+	w := New("unknown", Config{Strategy: StrategyKeepEnds, MaxTokens: 400, ReserveTokens: 100, KeepFirst: 1})
+	msgs := makeTurns(5)
+	msgs[0].Content = "first"
+
+	got, err := w.Fit("", msgs)
+	assert.Nil(t, err)
+	assert.Len(t, got, 6)
+	assert.Equal(t, "first", got[0].Content)
+	assert.Equal(t, msgs[6:], got[2:])
+}
+
+func TestFitKeepEndsDefault(t *testing.T) {
+	w := New("unknown", Config{Strategy: StrategyKeepEnds, MaxTokens: 400, ReserveTokens: 100})
+	msgs := makeTurns(5)
+	msgs[0].Content = "first"
+
+	got, err := w.Fit("", msgs)
+	assert.Nil(t, err)
+	assert.Len(t, got, 6)
+	assert.Equal(t, "first", got[0].Content)
+}
+
+func TestFitRefuse(t *testing.T) {
+	w := New("unknown", Config{Strategy: StrategyRefuse, MaxTokens: 400, ReserveTokens: 100})
+
+	_, err := w.Fit("", makeTurns(5))
+	assert.ErrorIs(t, err, ErrContextOverflow)
+}
+
+func TestFitLastTurnTooLarge(t *testing.T) {
+	w := New("unknown", Config{MaxTokens: 200, ReserveTokens: 100})
+
+	_, err := w.Fit("", makeTurns(2))
+	assert.ErrorIs(t, err, ErrContextOverflow)
+}
+
+func TestFitKeepsToolPairs(t *testing.T) {
+	w := New("unknown", Config{MaxTokens: 200, ReserveTokens: 100})
+	msgs := []chatbot.ChatMessage{
+		{Role: chatbot.ChatMessageRoleUser, Content: strings.Repeat("a", 400)},
+		{Role: chatbot.ChatMessageRoleAssistant, ToolCalls: []chattools.ToolCall{{ID: "1", Name: "add_numbers"}}},
+		{Role: chatbot.ChatMessageRoleTool, ToolResults: []chattools.ToolResult{{ID: "1", Name: "add_numbers", Content: "2"}}},
+		{Role: chatbot.ChatMessageRoleAssistant, Content: "2"},
+		{Role: chatbot.ChatMessageRoleUser, Content: "and now?"},
+		{Role: chatbot.ChatMessageRoleAssistant, ToolCalls: []chattools.ToolCall{{ID: "2", Name: "add_numbers"}}},
+		{Role: chatbot.ChatMessageRoleTool, ToolResults: []chattools.ToolResult{{ID: "2", Name: "add_numbers", Content: "3"}}},
+	}
+
+	got, err := w.Fit("", msgs)
+	assert.Nil(t, err)
+	assert.Equal(t, msgs[4:], got)
+}
+
+func TestModelLimit(t *testing.T) {
+	assert.Equal(t, 200000, ModelLimit("claude-3-5-sonnet-20240620"))
+	assert.Equal(t, 128000, ModelLimit("gpt-4o"))
+	assert.Equal(t, 8192, ModelLimit("gpt-4"))
+	assert.Equal(t, 65536, ModelLimit("accounts/fireworks/models/mixtral-8x22b-instruct"))
+	assert.Equal(t, defaultContextLimit, ModelLimit("something-else"))
+}
+
+type wordTokenizer struct{}
+
+func (wordTokenizer) CountTokens(text string) int {
+	return len(strings.Fields(text))
+}
+
+func TestRegisterTokenizer(t *testing.T) {
+	RegisterTokenizer("words-", wordTokenizer{})
+	assert.IsType(t, wordTokenizer{}, TokenizerFor("words-model"))
+	assert.IsType(t, HeuristicTokenizer{}, TokenizerFor("gpt-4o"))
+}
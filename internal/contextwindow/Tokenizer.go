@@ -0,0 +1,74 @@
+package contextwindow
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/c00/botman-v2/chatbot"
+)
+
+// Tokens added per message for role markers and formatting.
+const messageOverhead = 4
+
+// Tokenizer counts the tokens in a piece of text for a model.
+type Tokenizer interface {
+	CountTokens(text string) int
+}
+
+var (
+	tokenizers   = map[string]Tokenizer{}
+	tokenizersMu sync.RWMutex
+)
+
+// RegisterTokenizer registers an exact tokenizer for all models starting with prefix.
+// Botman registers none, so counts are estimates unless a library user registers one.
+func RegisterTokenizer(prefix string, t Tokenizer) {
+	tokenizersMu.Lock()
+	defer tokenizersMu.Unlock()
+	tokenizers[prefix] = t
+}
+
+// TokenizerFor returns the registered tokenizer for a model, or a HeuristicTokenizer if none exists.
+func TokenizerFor(model string) Tokenizer {
+	tokenizersMu.RLock()
+	defer tokenizersMu.RUnlock()
+
+	var found Tokenizer = HeuristicTokenizer{}
+	longest := -1
+	for prefix, t := range tokenizers {
+		if strings.HasPrefix(model, prefix) && len(prefix) > longest {
+			found = t
+			longest = len(prefix)
+		}
+	}
+
+	return found
+}
+
+// HeuristicTokenizer estimates tokens at roughly 4 bytes per token.
+// It slightly overestimates for English, which is the safe side to err on.
+type HeuristicTokenizer struct{}
+
+func (HeuristicTokenizer) CountTokens(text string) int {
+	if text == "" {
+		return 0
+	}
+	return len(text)/4 + 1
+}
+
+// Estimate the number of tokens a message takes up, including tool calls and results.
+func countMessage(t Tokenizer, msg chatbot.ChatMessage) int {
+	count := messageOverhead + t.CountTokens(msg.Content)
+
+	for _, tc := range msg.ToolCalls {
+		params, _ := json.Marshal(tc.Params)
+		count += t.CountTokens(tc.Name) + t.CountTokens(string(params)) + messageOverhead
+	}
+
+	for _, tr := range msg.ToolResults {
+		count += t.CountTokens(tr.Content) + messageOverhead
+	}
+
+	return count
+}
@@ -0,0 +1,41 @@
+package contextwindow
+
+import "strings"
+
+const defaultContextLimit = 8192
+
+// Context limits in tokens, keyed by model name prefix.
+var modelLimits = map[string]int{
+	"claude-3":        200000,
+	"gpt-4o":          128000,
+	"gpt-4-turbo":     128000,
+	"gpt-4":           8192,
+	"gpt-3.5-turbo":   16385,
+	"firefunction-v2": 8192,
+	"firellava-13b":   4096,
+	"mixtral-8x7b":    32768,
+	"mixtral-8x22b":   65536,
+	"hermes-2-pro":    4096,
+	"llama-v3-":       8192,
+	"llama-v3p1":      131072,
+	"qwen2-72b":       32768,
+}
+
+// ModelLimit returns the context limit in tokens for a model. Provider prefixes
+// like accounts/fireworks/models/ are ignored. Unknown models get a conservative default.
+func ModelLimit(model string) int {
+	if idx := strings.LastIndex(model, "/"); idx != -1 {
+		model = model[idx+1:]
+	}
+
+	limit := defaultContextLimit
+	longest := 0
+	for prefix, l := range modelLimits {
+		if strings.HasPrefix(model, prefix) && len(prefix) > longest {
+			limit = l
+			longest = len(prefix)
+		}
+	}
+
+	return limit
+}
@@ -0,0 +1,139 @@
+package events
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/c00/botman-v2/chatbot"
+	"github.com/c00/botman-v2/internal/history"
+)
+
+const (
+	// The name of the conversation, written first
+	TypeConversation = "conversation"
+	// A prompt of the user
+	TypeUser = "user"
+	// A summary of earlier turns of the conversation
+	TypeSummary = "summary"
+	// Response text. Streamed responses are written as a number of deltas.
+	TypeText       = "text"
+	TypeToolCall   = "tool_call"
+	TypeToolResult = "tool_result"
+	// A tool call waits for approval. Answer with a line on stdin.
+	TypeApproval = "approval"
+	TypeUsage    = "usage"
+	// The end of a response, with the reason the model gave for stopping if there is one
+	TypeStop  = "stop"
+	TypeError = "error"
+	// The output of a slash command in interactive mode
+	TypeCommand = "command"
+)
+
+// Event is a line of NDJSON output.
+type Event struct {
+	Type         string `json:"type"`
+	Conversation string `json:"conversation,omitempty"`
+	// Text of a prompt, response or tool result
+	Text string `json:"text,omitempty"`
+	// ID and name of a tool call or result
+	ID         string         `json:"id,omitempty"`
+	Name       string         `json:"name,omitempty"`
+	Params     map[string]any `json:"params,omitempty"`
+	Success    *bool          `json:"success,omitempty"`
+	Value      any            `json:"value,omitempty"`
+	Usage      *chatbot.Usage `json:"usage,omitempty"`
+	StopReason string         `json:"stopReason,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// NewWriter creates a Writer that writes events to out, one per line.
+func NewWriter(out io.Writer) *Writer {
+	return &Writer{enc: json.NewEncoder(out)}
+}
+
+// Writer writes events as NDJSON. It is safe for concurrent use.
+type Writer struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (w *Writer) Write(events ...Event) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, e := range events {
+		err := w.enc.Encode(e)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TextWriter returns an io.Writer that writes everything written to it as text events.
+func (w *Writer) TextWriter() io.Writer {
+	return textWriter{w}
+}
+
+type textWriter struct {
+	w *Writer
+}
+
+func (t textWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	err := t.w.Write(Event{Type: TypeText, Text: string(p)})
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// FromMessage converts a message to events. The text of responses is left out when withText is false,
+// e.g. because it has been streamed already.
+func FromMessage(msg chatbot.ChatMessage, withText bool) []Event {
+	events := []Event{}
+
+	switch {
+	case msg.Role == "system":
+		return events
+	case msg.Summary:
+		return append(events, Event{Type: TypeSummary, Text: msg.Content})
+	case msg.Role == chatbot.ChatMessageRoleUser:
+		return append(events, Event{Type: TypeUser, Text: msg.Content})
+	}
+
+	if withText && msg.Content != "" {
+		events = append(events, Event{Type: TypeText, Text: msg.Content})
+	}
+
+	for _, call := range msg.ToolCalls {
+		events = append(events, Event{Type: TypeToolCall, ID: call.ID, Name: call.Name, Params: call.Params})
+	}
+
+	for _, result := range msg.ToolResults {
+		success := result.Success
+		events = append(events, Event{Type: TypeToolResult, ID: result.ID, Name: result.Name, Text: result.Content, Success: &success, Value: result.Value})
+	}
+
+	if msg.Role != chatbot.ChatMessageRoleAssistant {
+		return events
+	}
+
+	if msg.Usage != nil {
+		events = append(events, Event{Type: TypeUsage, Usage: msg.Usage})
+	}
+
+	return append(events, Event{Type: TypeStop, StopReason: msg.StopReason})
+}
+
+// FromHistory converts a stored conversation to the events it would have produced.
+func FromHistory(entry history.HistoryEntry) []Event {
+	events := []Event{{Type: TypeConversation, Conversation: entry.Name}}
+	for _, msg := range entry.Messages {
+		events = append(events, FromMessage(msg, true)...)
+	}
+	return events
+}
@@ -2,9 +2,13 @@ package history
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/c00/botman-v2/chatbot"
+	"github.com/c00/botman-v2/internal/markdown"
 )
 
 func NewEntry() HistoryEntry {
@@ -18,22 +22,85 @@ func NewEntry() HistoryEntry {
 
 type HistoryEntry struct {
 	Name     string                `yaml:"name"`
+	Title    string                `yaml:"title,omitempty"`
 	Date     time.Time             `yaml:"date"`
 	Messages []chatbot.ChatMessage `yaml:"messages"`
+	Archive  []ArchivedTurns       `yaml:"archive,omitempty"`
+}
+
+// Messages that have been replaced by a summary when the conversation was compacted.
+type ArchivedTurns struct {
+	Date     time.Time             `yaml:"date"`
+	Summary  string                `yaml:"summary"`
+	Messages []chatbot.ChatMessage `yaml:"messages"`
 }
 
 func (e HistoryEntry) Print() {
+	e.Fprint(os.Stdout)
+}
+
+func (e HistoryEntry) Fprint(w io.Writer) {
+	e.FprintWithImages(w, nil)
+}
+
+// ImageWriter writes the images of a tool result value, e.g. to show them in a terminal.
+type ImageWriter func(w io.Writer, value any)
+
+// FprintWithImages prints the conversation, with the images of tool results written by images.
+func (e HistoryEntry) FprintWithImages(w io.Writer, images ImageWriter) {
 	for _, message := range e.Messages {
 		if message.Role == "system" {
 			continue
+		} else if message.Summary {
+			fmt.Fprint(w, "Summary: ", message.Content, "\n\n")
 		} else if message.Role == "assistant" {
-			fmt.Print(message.Content, "\n\n")
+			fmt.Fprint(w, message.Content, "\n\n")
 		} else if message.Role == "user" {
-			fmt.Print("You: ", message.Content, "\n\n")
+			fmt.Fprint(w, "You: ", message.Content, "\n\n")
+		} else {
+			fmt.Fprintf(w, "%v: %v\n", message.Role, message.Content)
+		}
+
+		if images == nil {
+			continue
+		}
+		for _, result := range message.ToolResults {
+			if result.Success {
+				images(w, result.Value)
+			}
+		}
+	}
+}
+
+// Tail formats the last n messages as text, e.g. to show as context.
+func (e HistoryEntry) Tail(n int) string {
+	start := max(len(e.Messages)-n, 0)
+
+	sb := &strings.Builder{}
+	HistoryEntry{Messages: e.Messages[start:]}.Fprint(sb)
+	return sb.String()
+}
+
+// CodeBlocks returns the code blocks of all assistant messages, or of the last message only.
+// Messages saved before code blocks were recorded are parsed instead.
+func (e HistoryEntry) CodeBlocks(lastOnly bool) []chatbot.CodeBlock {
+	messages := e.Messages
+	if lastOnly && len(messages) > 0 {
+		messages = messages[len(messages)-1:]
+	}
+
+	blocks := []chatbot.CodeBlock{}
+	for _, message := range messages {
+		if message.Role != chatbot.ChatMessageRoleAssistant {
+			continue
+		}
+		if message.CodeBlocks != nil {
+			blocks = append(blocks, message.CodeBlocks...)
 		} else {
-			fmt.Printf("%v: %v\n", message.Role, message.Content)
+			blocks = append(blocks, markdown.CodeBlocks(message.Content)...)
 		}
 	}
+	return blocks
 }
 
 func (e HistoryEntry) PrintLastMessage() {
@@ -1,15 +1,42 @@
 package history
 
 import (
+	"fmt"
+	"io"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/c00/botman-v2/chatbot"
+	"github.com/c00/botman-v2/chattools"
 	"github.com/stretchr/testify/assert"
 )
 
 func RunSuite(t *testing.T, keeperFactory func() HistoryKeeper) {
 	saveAndLoad(t, keeperFactory())
+	findByTitle(t, keeperFactory())
+}
+
+func findByTitle(t *testing.T, keeper HistoryKeeper) {
+	messages := []chatbot.ChatMessage{{Role: "user", Content: "hi"}}
+	_, err := keeper.SaveChat(HistoryEntry{Name: "entry 3", Title: "minion talk", Messages: messages})
+	assert.Nil(t, err)
+	_, err = keeper.SaveChat(HistoryEntry{Name: "entry 4", Messages: messages})
+	assert.Nil(t, err)
+
+	entry, err := keeper.FindChat("minion talk")
+	assert.Nil(t, err)
+	assert.Equal(t, "entry 3", entry.Name)
+
+	//The newest chat with the title
+	_, err = keeper.SaveChat(HistoryEntry{Name: "entry 5", Title: "minion talk", Messages: messages})
+	assert.Nil(t, err)
+	entry, err = keeper.FindChat("minion talk")
+	assert.Nil(t, err)
+	assert.Equal(t, "entry 5", entry.Name)
+
+	_, err = keeper.FindChat("other talk")
+	assert.ErrorContains(t, err, "no chat saved as other talk")
 }
 
 func saveAndLoad(t *testing.T, keeper HistoryKeeper) {
@@ -90,3 +117,34 @@ func mustParse(input string) time.Time {
 	}
 	return date
 }
+
+func TestHistoryEntryCodeBlocks(t *testing.T) {
+	entry := HistoryEntry{
+		Messages: []chatbot.ChatMessage{
+			{Role: "user", Content: "```\nnot mine\n```"},
+			{Role: "assistant", Content: "```go\nold\n```"},
+			{Role: "user", Content: "again"},
+			{Role: "assistant", Content: "ignored", CodeBlocks: []chatbot.CodeBlock{{Lang: "go", Code: "recorded"}}},
+		},
+	}
+
+	assert.Equal(t, []chatbot.CodeBlock{{Lang: "go", Code: "old"}, {Lang: "go", Code: "recorded"}}, entry.CodeBlocks(false))
+	assert.Equal(t, []chatbot.CodeBlock{{Lang: "go", Code: "recorded"}}, entry.CodeBlocks(true))
+}
+
+func TestHistoryEntryFprintWithImages(t *testing.T) {
+	entry := HistoryEntry{Messages: []chatbot.ChatMessage{
+		{Role: "user", Content: "draw a gopher"},
+		{Role: "tool", ToolResults: []chattools.ToolResult{
+			{Name: "draw", Success: true, Value: "gopher.png"},
+			{Name: "draw", Success: false, Value: "failed.png"},
+		}},
+		{Role: "assistant", Content: "Here you go"},
+	}}
+
+	sb := &strings.Builder{}
+	entry.FprintWithImages(sb, func(w io.Writer, value any) {
+		fmt.Fprintf(w, "[image %v]\n", value)
+	})
+	assert.Equal(t, "You: draw a gopher\n\ntool: \n[image gopher.png]\nHere you go\n\n", sb.String())
+}
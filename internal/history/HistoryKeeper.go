@@ -7,5 +7,7 @@ var log = logger.New("historyKeeper")
 type HistoryKeeper interface {
 	SaveChat(entry HistoryEntry) (HistoryEntry, error)
 	LoadChat(lookback int) (HistoryEntry, error)
+	// Load the most recent chat that was saved with this title.
+	FindChat(title string) (HistoryEntry, error)
 	List() ([]string, error)
 }
@@ -2,6 +2,7 @@ package history
 
 import (
 	"errors"
+	"fmt"
 )
 
 type InMemoryHistory struct {
@@ -36,6 +37,16 @@ func (h *InMemoryHistory) LoadChat(lookback int) (HistoryEntry, error) {
 	return h.entries[index], nil
 }
 
+func (h *InMemoryHistory) FindChat(title string) (HistoryEntry, error) {
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		if h.entries[i].Title == title {
+			return h.entries[i], nil
+		}
+	}
+
+	return HistoryEntry{}, fmt.Errorf("no chat saved as %v", title)
+}
+
 func (h *InMemoryHistory) List() ([]string, error) {
 	names := []string{}
 	for _, item := range h.entries {
@@ -15,6 +15,10 @@ func (h *NullKeeper) LoadChat(lookback int) (HistoryEntry, error) {
 
 }
 
+func (h *NullKeeper) FindChat(title string) (HistoryEntry, error) {
+	return HistoryEntry{}, errors.New("nullkeeper does not keep history")
+}
+
 func (h *NullKeeper) List() ([]string, error) {
 	return []string{}, nil
 }
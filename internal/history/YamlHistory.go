@@ -92,6 +92,27 @@ func (h *YamlHistory) LoadChat(lookback int) (HistoryEntry, error) {
 
 }
 
+func (h *YamlHistory) FindChat(title string) (HistoryEntry, error) {
+	files, err := h.List()
+	if err != nil {
+		return HistoryEntry{}, err
+	}
+
+	//Newest first
+	for i := len(files) - 1; i >= 0; i-- {
+		entry, err := h.loadFile(files[i])
+		if err != nil {
+			log.Debug("skipped history entry %v: %v", files[i], err)
+			continue
+		}
+		if entry.Title == title {
+			return entry, nil
+		}
+	}
+
+	return HistoryEntry{}, fmt.Errorf("no chat saved as %v", title)
+}
+
 func (h *YamlHistory) loadFile(path string) (HistoryEntry, error) {
 	//Read the history dir
 	filePath := filepath.Join(h.Path, path)
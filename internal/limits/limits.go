@@ -0,0 +1,20 @@
+package limits
+
+import "time"
+
+const DefaultMaxToolRounds = 10
+
+// Tool calls that run at the same time
+const DefaultToolConcurrency = 4
+
+// Budget limits how long the loop runs. Zero values are unlimited.
+type Budget struct {
+	// Tool round trips per prompt of the user
+	MaxToolRounds int `yaml:"maxToolRounds"`
+	// Prompts of the user per session
+	MaxTurns int `yaml:"maxTurns"`
+	// Input and output tokens per session, as reported by the provider or estimated when it does not
+	MaxTokens int `yaml:"maxTokens"`
+	// Wall time per session. A response that is streaming when time runs out is finished first.
+	MaxTime time.Duration `yaml:"maxTime"`
+}
@@ -1,16 +1,26 @@
 package mainloop
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/c00/botman-v2/chatbot"
 	"github.com/c00/botman-v2/chattools"
+	"github.com/c00/botman-v2/chattools/mcp"
 	"github.com/c00/botman-v2/clitools"
+	"github.com/c00/botman-v2/internal/contextwindow"
+	"github.com/c00/botman-v2/internal/events"
 	"github.com/c00/botman-v2/internal/history"
+	"github.com/c00/botman-v2/internal/limits"
 	"github.com/c00/botman-v2/internal/logger"
+	"github.com/c00/botman-v2/internal/markdown"
 	"github.com/c00/botman-v2/internal/storageprovider"
+	"github.com/c00/botman-v2/jsonschema"
 )
 
 var log = logger.New("MainLoop")
@@ -25,17 +35,27 @@ func New(
 	stdOut io.Writer,
 ) MainLoop {
 	return MainLoop{
-		Chatter:      chatter,
-		interactive:  interactive,
-		maxRuns:      maxRuns,
-		stdIn:        stdIn,
-		stdOut:       stdOut,
-		history:      histKeeper,
-		conversation: history.NewEntry(),
-		storage:      storage,
+		Chatter:         chatter,
+		interactive:     interactive,
+		maxRuns:         maxRuns,
+		stdIn:           stdIn,
+		stdOut:          stdOut,
+		history:         histKeeper,
+		conversation:    history.NewEntry(),
+		storage:         storage,
+		toolsEnabled:    true,
+		input:           clitools.BasicReader{In: stdIn, Out: stdOut},
+		budget:          limits.Budget{MaxToolRounds: limits.DefaultMaxToolRounds},
+		registry:        chattools.DefaultRegistry.Clone(),
+		ctx:             context.Background(),
+		toolConcurrency: limits.DefaultToolConcurrency,
 	}
 }
 
+// ChatterFactory creates a Chatter for a provider and model. An empty model selects the
+// configured model of the provider. Returns the chatter and the model it uses.
+type ChatterFactory func(provider string, model string) (chatbot.Chatter, string, error)
+
 type MainLoop struct {
 	Chatter      chatbot.Chatter
 	CurrentRun   int
@@ -43,10 +63,49 @@ type MainLoop struct {
 	maxRuns      int
 	stdIn        io.Reader
 	stdOut       io.Writer
+	input        clitools.LineReader
 	history      history.HistoryKeeper
 	storage      storageprovider.StorageProvider
 	conversation history.HistoryEntry
 	tools        []chattools.ToolDefinition
+	toolImpls    map[string]chattools.Tool
+	registry     *chattools.Registry
+	mcpServers   []*mcp.Server
+	window       *contextwindow.Window
+	compaction   contextwindow.CompactionConfig
+	summarizer   chatbot.Chatter
+	factory      ChatterFactory
+	provider     string
+	model        string
+	toolsEnabled bool
+	toolChoice   chattools.ToolChoice
+	//Set when the user was told the chatter ignores the tool choice
+	toolChoiceWarned bool
+	//Set when the user changes the system prompt
+	systemPrompt string
+	//Width to render Markdown at, 0 writes responses as they are
+	markdownWidth int
+	//Only write the code blocks of responses
+	codeFilter *markdown.BlockFilter
+	//Write NDJSON events instead of text
+	events *events.Writer
+	//Show the images tools save
+	imagePreview *ImagePreview
+	//Responses must be JSON that matches this schema
+	responseSchema *jsonschema.JsonSchema
+	schemaRetries  int
+	budget         limits.Budget
+	//Cancels running tools
+	ctx             context.Context
+	toolConcurrency int
+	//Set with --approval, overrides the approval mode of all tools
+	approvalOverride string
+	//Tools the user approved for the rest of the session
+	alwaysApproved []string
+	//Usage so far, to check the budget against
+	started    time.Time
+	turns      int
+	tokensUsed int
 }
 
 func (l *MainLoop) SetConversation(conv history.HistoryEntry) {
@@ -54,6 +113,47 @@ func (l *MainLoop) SetConversation(conv history.HistoryEntry) {
 	l.Chatter.SetMessages(conv.Messages)
 }
 
+// Render streamed responses as Markdown, wrapped at width. A width of 0 writes responses as they are.
+func (l *MainLoop) SetMarkdown(width int) {
+	l.markdownWidth = width
+}
+
+// Only write the code of the fenced code blocks in responses that pass filter. Takes precedence over SetMarkdown.
+func (l *MainLoop) SetCodeFilter(filter markdown.BlockFilter) {
+	l.codeFilter = &filter
+}
+
+// Write NDJSON events to w instead of text. Takes precedence over SetCodeFilter and SetMarkdown.
+func (l *MainLoop) SetEventWriter(w *events.Writer) {
+	l.events = w
+}
+
+func (l *MainLoop) emit(e ...events.Event) {
+	if l.events == nil {
+		return
+	}
+
+	err := l.events.Write(e...)
+	if err != nil {
+		log.Warn("could not write event: %v", err)
+	}
+}
+
+// Cancel running tools when ctx is done.
+func (l *MainLoop) SetContext(ctx context.Context) {
+	l.ctx = ctx
+}
+
+// Run at most n tool calls at the same time.
+func (l *MainLoop) SetToolConcurrency(n int) {
+	l.toolConcurrency = n
+}
+
+// Read user input with a different LineReader, e.g. a clitools.LineEditor
+func (l *MainLoop) SetLineReader(r clitools.LineReader) {
+	l.input = r
+}
+
 func (l *MainLoop) getToolDef(name string) (chattools.ToolDefinition, error) {
 	for _, td := range l.tools {
 		if td.Name == name {
@@ -64,92 +164,358 @@ func (l *MainLoop) getToolDef(name string) (chattools.ToolDefinition, error) {
 	return chattools.ToolDefinition{}, fmt.Errorf("tool %v not found", name)
 }
 
-func (l *MainLoop) SetTools(tools []chattools.ToolDefinition) {
-	l.tools = tools
-	l.Chatter.SetTools(tools)
+// Give the tools to the chatter if it supports them.
+func (l *MainLoop) applyTools() {
+	if !slices.Contains(l.Chatter.SupportedFeatures(), "tools") {
+		return
+	}
+
+	if l.toolsEnabled {
+		l.Chatter.SetTools(l.tools)
+	} else {
+		l.Chatter.SetTools(nil)
+	}
+}
+
+// Allow switching provider and model during the conversation.
+func (l *MainLoop) SetChatterFactory(factory ChatterFactory, provider string, model string) {
+	l.factory = factory
+	l.provider = provider
+	l.model = model
+}
+
+// Replace the Chatter, keeping the conversation, tools and system prompt. Tells w what it switched to.
+func (l *MainLoop) switchChatter(w io.Writer, provider string, model string) error {
+	if l.factory == nil {
+		return errors.New("switching models is not available")
+	}
+
+	chatter, model, err := l.factory(provider, model)
+	if err != nil {
+		return fmt.Errorf("cannot switch to %v %v: %w", provider, model, err)
+	}
+
+	if l.systemPrompt != "" {
+		chatter.SetSystemPrompt(l.systemPrompt)
+	}
+	chatter.SetMessages(l.conversation.Messages)
+
+	l.Chatter = chatter
+	l.provider = provider
+	l.model = model
+	l.applyTools()
+	l.applyResponseSchema()
+
+	if l.window != nil {
+		l.window.SetModel(model)
+	}
+
+	fmt.Fprintf(w, "Switched to %v %v.\n\n", provider, model)
+	return nil
+}
+
+// Keep the messages sent to the Chatter within the context window.
+// The full conversation is still saved to history.
+func (l *MainLoop) SetContextWindow(window *contextwindow.Window) {
+	l.window = window
 }
 
 func (l *MainLoop) Start(prompt string) error {
-	if prompt == "" {
-		if l.interactive {
-			prompt = clitools.GetInput("You", l.stdIn, l.stdOut)
-			if prompt == "" {
+	l.emit(events.Event{Type: events.TypeConversation, Conversation: l.conversation.Name})
+
+	err := l.start(prompt)
+	if err != nil {
+		l.emit(events.Event{Type: events.TypeError, Error: err.Error()})
+	}
+	return err
+}
+
+func (l *MainLoop) start(prompt string) error {
+	l.started = time.Now()
+
+	err := l.checkToolChoice(l.toolChoice)
+	if err != nil {
+		return err
+	}
+
+	if prompt != "" {
+		return l.loop(stateRequest, chatbot.ChatMessage{Role: chatbot.ChatMessageRoleUser, Content: prompt})
+	}
+
+	if !l.interactive {
+		log.Debug("No prompt, not interactive.")
+		return nil
+	}
+
+	return l.loop(stateInput, chatbot.ChatMessage{})
+}
+
+type loopState int
+
+const (
+	// Ask the user for the next message
+	stateInput loopState = iota
+	// Send the pending message and stream the response
+	stateRequest
+	// Run the tool calls of the last response
+	stateTools
+)
+
+// Run the loop until the user has nothing more to say, or a budget is used up.
+func (l *MainLoop) loop(state loopState, pending chatbot.ChatMessage) error {
+	var response chatbot.ChatMessage
+	toolRounds := 0
+	//Asking again for a response that does not match the schema
+	reasks := 0
+	reasking := false
+
+	for {
+		switch state {
+		case stateInput:
+			if !l.interactive {
+				return nil
+			}
+
+			msg, ok := l.nextMessage()
+			if !ok {
 				log.Debug("No input from user.")
 				return nil
 			}
-		} else {
-			log.Debug("No prompt, not interactive.")
-			return nil
+			pending = msg
+			state = stateRequest
+
+		case stateRequest:
+			err := l.checkBudget(pending)
+			if err != nil {
+				return err
+			}
+
+			if pending.Role == chatbot.ChatMessageRoleUser && !reasking {
+				l.turns++
+				toolRounds = 0
+				reasks = 0
+			}
+			reasking = false
+
+			l.applyToolChoice(l.toolChoiceFor(pending))
+			response, err = l.request(l.schemaPrompt(pending))
+			if err != nil {
+				return err
+			}
+
+			state = stateInput
+			if len(response.ToolCalls) > 0 {
+				state = stateTools
+				continue
+			}
+
+			if l.responseSchema == nil {
+				continue
+			}
+
+			raw, err := l.checkResponse(response)
+			if err != nil && reasks < l.schemaRetries {
+				log.Debug("Invalid response, asking again: %v", err)
+				reasks++
+				reasking = true
+				pending = reaskMessage(err)
+				state = stateRequest
+				continue
+			}
+			if err != nil {
+				err = fmt.Errorf("%w after %v attempts: %v", ErrInvalidResponse, reasks+1, err)
+				if !l.interactive {
+					return err
+				}
+				l.notify(err)
+				continue
+			}
+
+			err = l.writeJson(raw)
+			if err != nil {
+				return err
+			}
+
+		case stateTools:
+			if l.budget.MaxToolRounds > 0 && toolRounds >= l.budget.MaxToolRounds {
+				err := fmt.Errorf("%w: stopped after %v tool rounds for this prompt (--max-tool-rounds)", ErrBudgetExceeded, toolRounds)
+				err = l.skipTools(response, err)
+				if !l.interactive {
+					return err
+				}
+
+				//Stop the tool loop, but let the user continue the conversation
+				l.notify(err)
+				state = stateInput
+				continue
+			}
+
+			toolRounds++
+			results := l.runTools(response.ToolCalls)
+			l.showImages(results)
+			pending = chatbot.ChatMessage{Role: chatbot.ChatMessageRoleTool, ToolResults: results}
+			state = stateRequest
 		}
 	}
-
-	return l.run(chatbot.ChatMessage{Role: chatbot.ChatMessageRoleUser, Content: prompt})
 }
 
-// run an interation of the loop
-func (l *MainLoop) run(newMsg chatbot.ChatMessage) error {
+// Send a message and stream the response. The response is added to the conversation and saved.
+func (l *MainLoop) request(newMsg chatbot.ChatMessage) (chatbot.ChatMessage, error) {
 	l.CurrentRun++
 	if l.maxRuns != 0 && l.CurrentRun > l.maxRuns {
-		return fmt.Errorf("max runs exceeded")
+		return chatbot.ChatMessage{}, fmt.Errorf("max runs exceeded")
 	}
 
 	l.conversation.Messages = append(l.conversation.Messages, newMsg)
+	l.emit(events.FromMessage(newMsg, true)...)
+
+	if l.shouldCompact() {
+		err := l.Compact()
+		if err != nil && !errors.Is(err, ErrNothingToCompact) {
+			log.Warn("could not compact conversation: %v", err)
+		}
+		//The summary may have gone in front of newMsg
+		newMsg = l.conversation.Messages[len(l.conversation.Messages)-1]
+	}
+
+	if l.window != nil {
+		msgs, err := l.window.Fit(l.Chatter.GetSystemPrompt(), l.conversation.Messages)
+		if err != nil {
+			return chatbot.ChatMessage{}, err
+		}
+		//The chatter adds newMsg itself
+		l.Chatter.SetMessages(msgs[:len(msgs)-1])
+	}
 
 	//Create channel for streaming output
 	wg := &sync.WaitGroup{}
-	ch := stdOutChannel(wg, l.stdOut)
+	var out io.Writer = l.stdOut
+	if l.events != nil {
+		out = l.events.TextWriter()
+	} else if l.responseSchema != nil {
+		//Only the validated JSON is written
+		out = io.Discard
+	} else if l.codeFilter != nil {
+		out = markdown.NewCodeWriter(l.stdOut, *l.codeFilter)
+	} else if l.markdownWidth > 0 {
+		out = markdown.NewRenderer(l.stdOut, l.markdownWidth)
+	}
+	ch := stdOutChannel(wg, out)
 
 	// Prompt it
 	msg, err := l.Chatter.GetStreamingResponse(newMsg, ch)
 	if err != nil {
-		return fmt.Errorf("getting streaming response failed: %w", err)
+		return chatbot.ChatMessage{}, fmt.Errorf("getting streaming response failed: %w", err)
 	}
 
 	//Give channels time to flush their last shit to stdout
 	wg.Wait()
 
-	fmt.Println("")
+	if l.events != nil {
+		l.emit(events.FromMessage(msg, false)...)
+	} else if l.codeFilter == nil && l.responseSchema == nil {
+		fmt.Println("")
+	}
 	log.Debug("Gotten message Role: %v, ToolCalls: %v, Content: %v", msg.Role, len(msg.ToolCalls), msg.Content)
 
+	if blocks := markdown.CodeBlocks(msg.Content); len(blocks) > 0 {
+		msg.CodeBlocks = blocks
+	}
+
+	l.countTokens(msg)
+
 	l.conversation.Messages = append(l.conversation.Messages, msg)
 	_, err = l.history.SaveChat(l.conversation)
 	if err != nil {
-		return fmt.Errorf("could not save chat: %w", err)
+		return chatbot.ChatMessage{}, fmt.Errorf("could not save chat: %w", err)
 	}
 
-	//Run tool calls
-	//todo make goroutines
-	toolResults := []chattools.ToolResult{}
-	for _, call := range msg.ToolCalls {
-		log.Debug("Executing call: %v, Params: %v", call.Name, call.Params)
+	return msg, nil
+}
+
+// Run the approved tool calls concurrently and return results for all calls in the same order.
+func (l *MainLoop) runTools(calls []chattools.ToolCall) []chattools.ToolResult {
+	calls = slices.Clone(calls)
+	results := make([]chattools.ToolResult, len(calls))
+	limit := make(chan struct{}, max(l.toolConcurrency, 1))
+	wg := sync.WaitGroup{}
 
-		def, err := l.getToolDef(call.Name)
-		if err != nil {
-			log.Error("cannot get tool def: %v", err)
-			toolResults = append(toolResults, chattools.ToolResult{ID: call.ID, Name: call.Name, Success: false, Content: err.Error()})
+	//Validate and ask for approval before anything runs
+	approved := make([]bool, len(calls))
+	for i, call := range calls {
+		if invalid := l.validateCall(call); invalid != nil {
+			results[i] = *invalid
+			continue
+		}
+
+		call, rejected := l.approveTool(call)
+		if rejected != nil {
+			results[i] = *rejected
+			continue
+		}
+		calls[i] = call
+		approved[i] = true
+	}
+
+	for i, call := range calls {
+		if !approved[i] {
 			continue
 		}
 
-		toolResult := l.runTool(call, def)
-		log.Debug("Tool %v Result: %v", call.Name, toolResult.Content)
-		toolResults = append(toolResults, toolResult)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limit <- struct{}{}
+			defer func() { <-limit }()
+
+			results[i] = l.runToolCall(call)
+			log.Debug("Tool %v Result: %v", call.Name, results[i].Content)
+		}()
 	}
 
-	if len(toolResults) > 0 {
-		//if any tool results have been added, restart loop
-		return l.run(chatbot.ChatMessage{Role: chatbot.ChatMessageRoleTool, ToolResults: toolResults})
+	wg.Wait()
+	return results
+}
+
+// Run a single tool call within its timeout. A tool that panics or does not finish in time gives a failed result.
+func (l *MainLoop) runToolCall(call chattools.ToolCall) chattools.ToolResult {
+	log.Debug("Executing call: %v, Params: %v", call.Name, call.Params)
+	failed := func(content string) chattools.ToolResult {
+		return chattools.ToolResult{ID: call.ID, Name: call.Name, Success: false, Content: content}
 	}
 
-	//If interactive, Ask for input and restart loop
-	if l.interactive {
-		prompt := clitools.GetInput("You", l.stdIn, l.stdOut)
-		if prompt == "" {
-			log.Debug("No input from user.")
-			return nil
-		}
+	def, err := l.getToolDef(call.Name)
+	if err != nil {
+		log.Error("cannot get tool def: %v", err)
+		return failed(err.Error())
+	}
 
-		return l.run(chatbot.ChatMessage{Role: chatbot.ChatMessageRoleUser, Content: prompt})
+	timeout := def.Timeout
+	if timeout == 0 {
+		timeout = chattools.DefaultTimeout
 	}
+	ctx, cancel := context.WithTimeout(l.ctx, timeout)
+	defer cancel()
 
-	return nil
+	done := make(chan chattools.ToolResult, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Error("tool %v panicked: %v", call.Name, r)
+				done <- failed(fmt.Sprintf("tool %v failed: %v", call.Name, r))
+			}
+		}()
+		done <- l.runTool(ctx, call, def)
+	}()
+
+	select {
+	case result := <-done:
+		return result
+	case <-ctx.Done():
+		log.Error("tool %v did not finish: %v", call.Name, ctx.Err())
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return failed(fmt.Sprintf("tool %v did not finish within %v", call.Name, timeout))
+		}
+		return failed(fmt.Sprintf("tool %v was cancelled", call.Name))
+	}
 }
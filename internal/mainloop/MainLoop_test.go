@@ -6,6 +6,7 @@ import (
 
 	"github.com/c00/botman-v2/chatbot"
 	"github.com/c00/botman-v2/chattools"
+	"github.com/c00/botman-v2/internal/contextwindow"
 	"github.com/c00/botman-v2/internal/history"
 	"github.com/c00/botman-v2/internal/storageprovider"
 	"github.com/c00/botman-v2/providers/yappie"
@@ -93,6 +94,43 @@ func TestMainLooptools_Run(t *testing.T) {
 	assert.Equal(t, toolMessage.Role, chatbot.ChatMessageRoleTool)
 }
 
+func TestMainLoopContextWindow_Run(t *testing.T) {
+	chatter := &yappie.Yappie{}
+	userInput := &stringReader{}
+	output := &stringWriter{}
+
+	userInput.Add("one answer")
+	userInput.Add("second answer")
+	hist := &history.InMemoryHistory{}
+	store := storageprovider.NewMemStore()
+
+	ml := New(chatter, hist, store, true, 0, userInput, output)
+	//Yappie responses are ~135 tokens, so only the latest prompt fits.
+	ml.SetContextWindow(contextwindow.New("yappie", contextwindow.Config{MaxTokens: 200, ReserveTokens: 100}))
+
+	err := ml.Start("hey")
+	assert.Nil(t, err)
+	assert.Len(t, ml.Chatter.GetMessages(), 2)
+
+	entry, err := hist.LoadChat(0)
+	assert.Nil(t, err)
+	assert.Len(t, entry.Messages, 6)
+}
+
+func TestMainLoopContextWindowRefuse_Run(t *testing.T) {
+	chatter := &yappie.Yappie{}
+	userInput := &stringReader{}
+	output := &stringWriter{}
+	hist := &history.InMemoryHistory{}
+	store := storageprovider.NewMemStore()
+
+	ml := New(chatter, hist, store, false, 0, userInput, output)
+	ml.SetContextWindow(contextwindow.New("yappie", contextwindow.Config{Strategy: contextwindow.StrategyRefuse, MaxTokens: 101, ReserveTokens: 100}))
+
+	err := ml.Start("hey")
+	assert.ErrorIs(t, err, contextwindow.ErrContextOverflow)
+}
+
 type stringReader struct {
 	data []string
 	pos  int
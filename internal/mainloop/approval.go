@@ -0,0 +1,132 @@
+package mainloop
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/c00/botman-v2/chattools"
+	"github.com/c00/botman-v2/clitools"
+	"github.com/c00/botman-v2/internal/events"
+)
+
+// Use this approval mode for all tools, instead of the mode of each definition.
+func (l *MainLoop) SetApprovalOverride(mode string) {
+	l.approvalOverride = mode
+}
+
+func (l *MainLoop) approvalMode(def chattools.ToolDefinition) string {
+	mode := def.Approval
+	if l.approvalOverride != "" {
+		mode = l.approvalOverride
+	}
+
+	switch mode {
+	case "", chattools.ApprovalAuto:
+		return chattools.ApprovalAuto
+	case chattools.ApprovalDeny:
+		return chattools.ApprovalDeny
+	}
+
+	//Unknown modes are the safe choice
+	return chattools.ApprovalAsk
+}
+
+// Decide which tool calls may run. Calls that may not run get a failed result instead.
+// Approved calls can have edited params.
+func (l *MainLoop) approveTool(call chattools.ToolCall) (chattools.ToolCall, *chattools.ToolResult) {
+	def, err := l.getToolDef(call.Name)
+	if err != nil {
+		//Fails when it runs
+		return call, nil
+	}
+
+	denied := &chattools.ToolResult{ID: call.ID, Name: call.Name, Success: false, Content: "This tool call was denied by the approval policy."}
+
+	switch l.approvalMode(def) {
+	case chattools.ApprovalAuto:
+		return call, nil
+	case chattools.ApprovalDeny:
+		return call, denied
+	}
+
+	if slices.Contains(l.alwaysApproved, call.Name) {
+		return call, nil
+	}
+
+	if !l.interactive {
+		log.Warn("denied call to %v, tools that ask for approval cannot run without interactive mode", call.Name)
+		return call, denied
+	}
+
+	return l.askApproval(call)
+}
+
+func (l *MainLoop) askApproval(call chattools.ToolCall) (chattools.ToolCall, *chattools.ToolResult) {
+	for {
+		params, _ := json.MarshalIndent(call.Params, "", "  ")
+		if l.events != nil {
+			l.emit(events.Event{Type: events.TypeApproval, ID: call.ID, Name: call.Name, Params: call.Params})
+		} else {
+			fmt.Fprintf(l.stdOut, "Run tool %v with:\n%s\n", call.Name, params)
+		}
+
+		answer := strings.ToLower(strings.TrimSpace(l.readAnswer("[y]es, [n]o, [e]dit or [a]lways")))
+		switch answer {
+		case "y", "yes":
+			return call, nil
+		case "a", "always":
+			l.alwaysApproved = append(l.alwaysApproved, call.Name)
+			return call, nil
+		case "", "n", "no":
+			content := "The user rejected this tool call."
+			if answer != "" {
+				if reason := strings.TrimSpace(l.readAnswer("Reason (optional)")); reason != "" {
+					content = fmt.Sprintf("%v Reason: %v", content, reason)
+				}
+			}
+			return call, &chattools.ToolResult{ID: call.ID, Name: call.Name, Success: false, Content: content}
+		case "e", "edit":
+			edited, err := editParams(call, string(params))
+			if err == nil {
+				err = l.validateParams(call.Name, edited)
+			}
+			if err != nil {
+				l.notify(err)
+				continue
+			}
+			call.Params = edited
+		default:
+			l.notify(errors.New("Answer y, n, e or a."))
+		}
+	}
+}
+
+func editParams(call chattools.ToolCall, params string) (map[string]any, error) {
+	text, err := clitools.EditText(params, fmt.Sprintf("Edit the parameters of %v as JSON. Save an empty file to keep them as they were.", call.Name))
+	if err != nil {
+		return nil, err
+	}
+
+	if text == "" {
+		return call.Params, nil
+	}
+
+	edited := map[string]any{}
+	err = json.Unmarshal([]byte(text), &edited)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+
+	return edited, nil
+}
+
+// Read the answer to a question. Answers are not prompts, so they are kept out of the prompt history.
+func (l *MainLoop) readAnswer(label string) string {
+	if reader, ok := l.input.(clitools.AnswerReader); ok {
+		return reader.ReadAnswer(label)
+	}
+	return l.input.ReadLine(label)
+}
@@ -0,0 +1,132 @@
+package mainloop
+
+import (
+	"testing"
+
+	"github.com/c00/botman-v2/chattools"
+	"github.com/c00/botman-v2/clitools"
+	"github.com/c00/botman-v2/internal/history"
+	"github.com/c00/botman-v2/internal/storageprovider"
+	"github.com/c00/botman-v2/providers/yappie"
+	"github.com/stretchr/testify/assert"
+)
+
+func newApprovalLoop(approval string, interactive bool, inputs ...string) (*MainLoop, *stringWriter) {
+	userInput := &stringReader{}
+	for _, in := range inputs {
+		userInput.Add(in)
+	}
+	output := &stringWriter{}
+
+	ml := New(&yappie.Yappie{}, &history.InMemoryHistory{}, storageprovider.NewMemStore(), interactive, 0, userInput, output)
+	ml.SetTools([]chattools.ToolDefinition{
+		{ToolType: chattools.ToolTypeAddNumbers, Name: "add", Approval: approval},
+		{ToolType: chattools.ToolTypeAddNumbers, Name: "add_auto"},
+	})
+	return &ml, output
+}
+
+func addCall(id string) chattools.ToolCall {
+	return chattools.ToolCall{ID: id, Name: "add", Params: map[string]any{"a": 1, "b": 2}}
+}
+
+func TestApprovalModes(t *testing.T) {
+	ml, _ := newApprovalLoop(chattools.ApprovalDeny, true)
+	results := ml.runTools([]chattools.ToolCall{addCall("1"), {ID: "2", Name: "add_auto", Params: map[string]any{"a": 1, "b": 1}}})
+	assert.False(t, results[0].Success)
+	assert.Contains(t, results[0].Content, "denied")
+	assert.True(t, results[1].Success)
+
+	//Nobody to ask
+	ml, _ = newApprovalLoop(chattools.ApprovalAsk, false)
+	results = ml.runTools([]chattools.ToolCall{addCall("1")})
+	assert.False(t, results[0].Success)
+	assert.Contains(t, results[0].Content, "denied")
+
+	//Override
+	ml, _ = newApprovalLoop(chattools.ApprovalAsk, false)
+	ml.SetApprovalOverride(chattools.ApprovalAuto)
+	results = ml.runTools([]chattools.ToolCall{addCall("1")})
+	assert.True(t, results[0].Success)
+
+	ml, _ = newApprovalLoop("", false)
+	ml.SetApprovalOverride(chattools.ApprovalDeny)
+	results = ml.runTools([]chattools.ToolCall{addCall("1"), {ID: "2", Name: "add_auto"}})
+	assert.False(t, results[0].Success)
+	assert.False(t, results[1].Success)
+}
+
+func TestApprovalAsk(t *testing.T) {
+	ml, output := newApprovalLoop(chattools.ApprovalAsk, true, "maybe", "y", "n", "too big")
+
+	results := ml.runTools([]chattools.ToolCall{addCall("1"), addCall("2")})
+	assert.True(t, results[0].Success)
+	assert.Equal(t, "3", results[0].Content)
+	assert.False(t, results[1].Success)
+	assert.Equal(t, "The user rejected this tool call. Reason: too big", results[1].Content)
+
+	assert.Contains(t, output.String(), "Run tool add with:\n{\n  \"a\": 1,\n  \"b\": 2\n}")
+	assert.Contains(t, output.String(), "Answer y, n, e or a.")
+}
+
+func TestApprovalAlways(t *testing.T) {
+	ml, _ := newApprovalLoop(chattools.ApprovalAsk, true, "a")
+
+	results := ml.runTools([]chattools.ToolCall{addCall("1"), addCall("2")})
+	assert.True(t, results[0].Success)
+	assert.True(t, results[1].Success)
+
+	results = ml.runTools([]chattools.ToolCall{addCall("3")})
+	assert.True(t, results[0].Success)
+}
+
+// LineReader that keeps the lines it read as answers.
+type answerRecorder struct {
+	clitools.BasicReader
+	answers []string
+}
+
+func (r *answerRecorder) ReadAnswer(label string) string {
+	answer := r.ReadLine(label)
+	r.answers = append(r.answers, answer)
+	return answer
+}
+
+func TestApprovalReadsAnswers(t *testing.T) {
+	ml, output := newApprovalLoop(chattools.ApprovalAsk, true)
+	userInput := &stringReader{}
+	userInput.Add("y")
+	userInput.Add("n")
+	userInput.Add("too big")
+	reader := &answerRecorder{BasicReader: clitools.BasicReader{In: userInput, Out: output}}
+	ml.SetLineReader(reader)
+
+	results := ml.runTools([]chattools.ToolCall{addCall("1"), addCall("2")})
+	assert.True(t, results[0].Success)
+	assert.False(t, results[1].Success)
+	assert.Equal(t, []string{"y", "n", "too big"}, reader.answers)
+}
+
+func TestApprovalEdit(t *testing.T) {
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", `printf '{"a": 5, "b": 6}' >`)
+	ml, _ := newApprovalLoop(chattools.ApprovalAsk, true, "e", "y")
+
+	calls := []chattools.ToolCall{addCall("1")}
+	results := ml.runTools(calls)
+	assert.True(t, results[0].Success)
+	assert.Equal(t, "11", results[0].Content)
+
+	//The call of the model is left as it was
+	assert.Equal(t, 1, calls[0].Params["a"])
+}
+
+func TestApprovalEditInvalid(t *testing.T) {
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", `printf '{"a": "5"}' >`)
+	ml, output := newApprovalLoop(chattools.ApprovalAsk, true, "e", "n", "")
+
+	results := ml.runTools([]chattools.ToolCall{addCall("1")})
+	assert.False(t, results[0].Success)
+	assert.Contains(t, output.String(), `a: must be a number, not string "5"; b: is required`)
+}
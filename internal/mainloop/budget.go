@@ -0,0 +1,87 @@
+package mainloop
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/c00/botman-v2/chatbot"
+	"github.com/c00/botman-v2/chattools"
+	"github.com/c00/botman-v2/internal/contextwindow"
+	"github.com/c00/botman-v2/internal/events"
+	"github.com/c00/botman-v2/internal/limits"
+)
+
+var ErrBudgetExceeded = errors.New("budget used up")
+
+func (l *MainLoop) SetBudget(budget limits.Budget) {
+	l.budget = budget
+}
+
+// Check the budget before sending pending.
+func (l *MainLoop) checkBudget(pending chatbot.ChatMessage) error {
+	if l.budget.MaxTurns > 0 && pending.Role == chatbot.ChatMessageRoleUser && l.turns >= l.budget.MaxTurns {
+		return fmt.Errorf("%w: stopped after %v turns (--max-turns)", ErrBudgetExceeded, l.turns)
+	}
+
+	if l.budget.MaxTokens > 0 && l.tokensUsed >= l.budget.MaxTokens {
+		return fmt.Errorf("%w: stopped after using about %v tokens of %v (--max-tokens)", ErrBudgetExceeded, l.tokensUsed, l.budget.MaxTokens)
+	}
+
+	if l.budget.MaxTime > 0 && time.Since(l.started) >= l.budget.MaxTime {
+		return fmt.Errorf("%w: stopped after %v (--max-time)", ErrBudgetExceeded, time.Since(l.started).Round(time.Second))
+	}
+
+	return nil
+}
+
+// Add the tokens of a response to the tokens used.
+func (l *MainLoop) countTokens(response chatbot.ChatMessage) {
+	if l.budget.MaxTokens == 0 {
+		return
+	}
+
+	if response.Usage != nil {
+		l.tokensUsed += response.Usage.InputTokens + response.Usage.OutputTokens
+		return
+	}
+
+	//The chatter holds the messages that were sent, and the response
+	window := l.window
+	if window == nil {
+		window = contextwindow.New(l.model, contextwindow.Config{})
+	}
+	l.tokensUsed += window.Count(l.Chatter.GetSystemPrompt(), l.Chatter.GetMessages())
+}
+
+// Answer the tool calls of response with failed results, so the conversation stays valid without running them.
+func (l *MainLoop) skipTools(response chatbot.ChatMessage, reason error) error {
+	results := []chattools.ToolResult{}
+	for _, call := range response.ToolCalls {
+		results = append(results, chattools.ToolResult{ID: call.ID, Name: call.Name, Success: false, Content: fmt.Sprintf("Not run: %v", reason)})
+	}
+
+	msg := chatbot.ChatMessage{Role: chatbot.ChatMessageRoleTool, ToolResults: results}
+	l.conversation.Messages = append(l.conversation.Messages, msg)
+	if l.window == nil {
+		l.Chatter.AddMessages([]chatbot.ChatMessage{msg})
+	}
+	l.emit(events.FromMessage(msg, true)...)
+
+	_, err := l.history.SaveChat(l.conversation)
+	if err != nil {
+		return fmt.Errorf("could not save chat: %w", err)
+	}
+
+	return reason
+}
+
+// Tell the user why something stopped, without ending the session.
+func (l *MainLoop) notify(err error) {
+	if l.events != nil {
+		l.emit(events.Event{Type: events.TypeError, Error: err.Error()})
+		return
+	}
+
+	fmt.Fprintf(l.stdOut, "%v\n\n", err)
+}
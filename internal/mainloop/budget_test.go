@@ -0,0 +1,95 @@
+package mainloop
+
+import (
+	"testing"
+	"time"
+
+	"github.com/c00/botman-v2/chatbot"
+	"github.com/c00/botman-v2/chattools"
+	"github.com/c00/botman-v2/internal/history"
+	"github.com/c00/botman-v2/internal/limits"
+	"github.com/c00/botman-v2/internal/storageprovider"
+	"github.com/c00/botman-v2/providers/yappie"
+	"github.com/stretchr/testify/assert"
+)
+
+// A chatter that asks for a tool call in every response.
+type loopingChatter struct {
+	*yappie.Yappie
+}
+
+func (c loopingChatter) GetStreamingResponse(newMessage chatbot.ChatMessage, streamChan chan<- string) (chatbot.ChatMessage, error) {
+	msg, err := c.Yappie.GetStreamingResponse(newMessage, streamChan)
+	msg.ToolCalls = []chattools.ToolCall{{ID: "call", Name: "add_numbers", Params: map[string]any{"a": 1, "b": 2}}}
+	return msg, err
+}
+
+func newBudgetLoop(chatter chatbot.Chatter, budget limits.Budget, inputs ...string) (*MainLoop, *history.InMemoryHistory, *stringWriter) {
+	userInput := &stringReader{}
+	for _, in := range inputs {
+		userInput.Add(in)
+	}
+	output := &stringWriter{}
+	hist := &history.InMemoryHistory{}
+
+	ml := New(chatter, hist, storageprovider.NewMemStore(), len(inputs) > 0, 0, userInput, output)
+	ml.SetTools([]chattools.ToolDefinition{
+		{ToolType: chattools.ToolTypeAddNumbers, Name: "add_numbers", Description: "Add two numbers"},
+	})
+	ml.SetBudget(budget)
+	return &ml, hist, output
+}
+
+func TestBudgetMaxToolRounds(t *testing.T) {
+	ml, hist, _ := newBudgetLoop(loopingChatter{&yappie.Yappie{}}, limits.Budget{MaxToolRounds: 3})
+
+	err := ml.Start("hey")
+	assert.ErrorIs(t, err, ErrBudgetExceeded)
+	assert.Equal(t, 4, ml.CurrentRun)
+
+	//The last tool calls are answered without running them
+	entry, err := hist.LoadChat(0)
+	assert.Nil(t, err)
+	last := entry.Messages[len(entry.Messages)-1]
+	assert.Equal(t, chatbot.ChatMessageRoleTool, last.Role)
+	assert.False(t, last.ToolResults[0].Success)
+	assert.Contains(t, last.ToolResults[0].Content, "--max-tool-rounds")
+}
+
+func TestBudgetMaxToolRoundsInteractive(t *testing.T) {
+	ml, _, output := newBudgetLoop(loopingChatter{&yappie.Yappie{}}, limits.Budget{MaxToolRounds: 1}, "again")
+
+	err := ml.Start("hey")
+	assert.Nil(t, err)
+	//Each prompt gets its own tool rounds
+	assert.Equal(t, 4, ml.CurrentRun)
+	assert.Contains(t, output.String(), "stopped after 1 tool rounds")
+}
+
+func TestBudgetMaxTurns(t *testing.T) {
+	ml, _, _ := newBudgetLoop(&yappie.Yappie{}, limits.Budget{MaxTurns: 2}, "one", "two", "three")
+
+	err := ml.Start("hey")
+	assert.ErrorIs(t, err, ErrBudgetExceeded)
+	assert.Contains(t, err.Error(), "--max-turns")
+	//The first prompt makes Yappie call a tool, which is not a turn
+	assert.Equal(t, 3, ml.CurrentRun)
+}
+
+func TestBudgetMaxTokens(t *testing.T) {
+	//Yappie does not report usage, so it is estimated at ~140 tokens per request.
+	ml, _, _ := newBudgetLoop(&yappie.Yappie{}, limits.Budget{MaxTokens: 200}, "one", "two", "three")
+
+	err := ml.Start("hey")
+	assert.ErrorIs(t, err, ErrBudgetExceeded)
+	assert.Contains(t, err.Error(), "--max-tokens")
+	assert.Equal(t, 2, ml.CurrentRun)
+}
+
+func TestBudgetMaxTime(t *testing.T) {
+	ml, _, _ := newBudgetLoop(&yappie.Yappie{}, limits.Budget{MaxTime: time.Nanosecond})
+
+	err := ml.Start("hey")
+	assert.ErrorIs(t, err, ErrBudgetExceeded)
+	assert.Equal(t, 0, ml.CurrentRun)
+}
@@ -0,0 +1,340 @@
+package mainloop
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/c00/botman-v2/chatbot"
+	"github.com/c00/botman-v2/chattools"
+	"github.com/c00/botman-v2/clitools"
+	"github.com/c00/botman-v2/internal/events"
+	"github.com/c00/botman-v2/internal/history"
+)
+
+// Number of messages shown as context when writing a prompt in the editor
+const EditorTailMessages = 6
+
+type command struct {
+	name        string
+	usage       string
+	description string
+	// Writes its output to w. Returns a message to send to the model, or nil if there is nothing to send.
+	run func(l *MainLoop, w io.Writer, args string) (*chatbot.ChatMessage, error)
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{name: "model", usage: "/model [name]", description: "Show or switch the model of the current provider", run: cmdModel},
+		{name: "provider", usage: "/provider [name]", description: "Show or switch the LLM provider", run: cmdProvider},
+		{name: "system", usage: "/system [prompt]", description: "Show or replace the system prompt", run: cmdSystem},
+		{name: "tools", usage: "/tools [on|off]", description: "Show or toggle tool use", run: cmdTools},
+		{name: "toolchoice", usage: "/toolchoice [type]", description: "Show or set the tool choice: auto, none, any or tool:<name>", run: cmdToolChoice},
+		{name: "parallel", usage: "/parallel [on|off]", description: "Show or toggle parallel tool calls", run: cmdParallel},
+		{name: "retry", usage: "/retry", description: "Ask for a new response to your last prompt", run: cmdRetry},
+		{name: "undo", usage: "/undo", description: "Remove your last prompt and its response", run: cmdUndo},
+		{name: "clear", usage: "/clear", description: "Start a new conversation", run: cmdClear},
+		{name: "compact", usage: "/compact", description: "Summarize older turns to save context", run: cmdCompact},
+		{name: "save", usage: "/save <name>", description: "Save the conversation under a name", run: cmdSave},
+		{name: "edit", usage: "/edit [text]", description: "Write your prompt in $EDITOR", run: cmdEdit},
+		{name: "history", usage: "/history [name]", description: "Show the conversation so far, or the one saved as name", run: cmdHistory},
+		{name: "usage", usage: "/usage", description: "Show token usage", run: cmdUsage},
+		{name: "help", usage: "/help", description: "Show this help", run: cmdHelp},
+	}
+}
+
+// Ask the user for the next message to send. Commands are handled here and never sent to the model.
+// Returns false when the user has nothing more to say.
+func (l *MainLoop) nextMessage() (chatbot.ChatMessage, bool) {
+	for {
+		input := l.input.ReadLine("You")
+		if input == "" {
+			return chatbot.ChatMessage{}, false
+		}
+
+		if !strings.HasPrefix(input, "/") {
+			return chatbot.ChatMessage{Role: chatbot.ChatMessageRoleUser, Content: input}, true
+		}
+
+		//Escape a leading slash with another one
+		if strings.HasPrefix(input, "//") {
+			return chatbot.ChatMessage{Role: chatbot.ChatMessageRoleUser, Content: input[1:]}, true
+		}
+
+		msg, err := l.runCommand(input)
+		if err != nil {
+			l.notify(err)
+			continue
+		}
+
+		if msg != nil {
+			return *msg, true
+		}
+	}
+}
+
+func (l *MainLoop) runCommand(input string) (*chatbot.ChatMessage, error) {
+	name, args, _ := strings.Cut(strings.TrimPrefix(input, "/"), " ")
+	args = strings.TrimSpace(args)
+
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
+		if l.events == nil {
+			return c.run(l, l.stdOut, args)
+		}
+
+		//The output is a single event, to keep the output NDJSON
+		out := &strings.Builder{}
+		msg, err := c.run(l, out, args)
+		if text := strings.TrimSpace(out.String()); text != "" {
+			l.emit(events.Event{Type: events.TypeCommand, Name: name, Text: text})
+		}
+		return msg, err
+	}
+
+	return nil, fmt.Errorf("unknown command /%v, type /help for a list of commands", name)
+}
+
+func cmdModel(l *MainLoop, w io.Writer, args string) (*chatbot.ChatMessage, error) {
+	if args == "" {
+		fmt.Fprintf(w, "Provider: %v, model: %v\n\n", l.provider, l.model)
+		return nil, nil
+	}
+
+	return nil, l.switchChatter(w, l.provider, args)
+}
+
+func cmdProvider(l *MainLoop, w io.Writer, args string) (*chatbot.ChatMessage, error) {
+	if args == "" {
+		fmt.Fprintf(w, "Provider: %v, model: %v\n\n", l.provider, l.model)
+		return nil, nil
+	}
+
+	return nil, l.switchChatter(w, args, "")
+}
+
+func cmdSystem(l *MainLoop, w io.Writer, args string) (*chatbot.ChatMessage, error) {
+	if args == "" {
+		fmt.Fprintf(w, "System prompt: %v\n\n", l.Chatter.GetSystemPrompt())
+		return nil, nil
+	}
+
+	l.systemPrompt = args
+	l.Chatter.SetSystemPrompt(args)
+	fmt.Fprint(w, "System prompt updated.\n\n")
+	return nil, nil
+}
+
+func cmdTools(l *MainLoop, w io.Writer, args string) (*chatbot.ChatMessage, error) {
+	switch args {
+	case "":
+	case "on":
+		l.toolsEnabled = true
+	case "off":
+		l.toolsEnabled = false
+	default:
+		return nil, errors.New("usage: /tools [on|off]")
+	}
+	l.applyTools()
+
+	names := []string{}
+	for _, t := range l.tools {
+		names = append(names, t.Name)
+	}
+
+	state := "off"
+	if l.toolsEnabled {
+		state = "on"
+	}
+
+	fmt.Fprintf(w, "Tools are %v. Available tools: %v\n\n", state, strings.Join(names, ", "))
+	return nil, nil
+}
+
+func cmdToolChoice(l *MainLoop, w io.Writer, args string) (*chatbot.ChatMessage, error) {
+	if args != "" {
+		choice, err := chattools.ParseToolChoice(args)
+		if err != nil {
+			return nil, err
+		}
+
+		err = l.checkToolChoice(choice)
+		if err != nil {
+			return nil, err
+		}
+
+		l.toolChoice.Type = choice.Type
+		l.toolChoice.Name = choice.Name
+	}
+
+	fmt.Fprintf(w, "Tool choice: %v\n\n", l.toolChoice)
+	return nil, nil
+}
+
+func cmdParallel(l *MainLoop, w io.Writer, args string) (*chatbot.ChatMessage, error) {
+	switch args {
+	case "":
+	case "on":
+		l.toolChoice.DisableParallel = false
+	case "off":
+		l.toolChoice.DisableParallel = true
+	default:
+		return nil, errors.New("usage: /parallel [on|off]")
+	}
+
+	state := "on"
+	if l.toolChoice.DisableParallel {
+		state = "off"
+	}
+
+	fmt.Fprintf(w, "Parallel tool calls are %v.\n\n", state)
+	return nil, nil
+}
+
+func cmdRetry(l *MainLoop, w io.Writer, args string) (*chatbot.ChatMessage, error) {
+	idx := l.lastPromptIndex()
+	if idx == -1 {
+		return nil, errors.New("nothing to retry")
+	}
+
+	prompt := l.conversation.Messages[idx]
+	l.conversation.Messages = l.conversation.Messages[:idx]
+	l.Chatter.SetMessages(l.conversation.Messages)
+
+	return &prompt, nil
+}
+
+func cmdUndo(l *MainLoop, w io.Writer, args string) (*chatbot.ChatMessage, error) {
+	idx := l.lastPromptIndex()
+	if idx == -1 {
+		return nil, errors.New("nothing to undo")
+	}
+
+	l.conversation.Messages = l.conversation.Messages[:idx]
+	l.Chatter.SetMessages(l.conversation.Messages)
+
+	_, err := l.history.SaveChat(l.conversation)
+	if err != nil {
+		return nil, fmt.Errorf("could not save chat: %w", err)
+	}
+
+	fmt.Fprint(w, "Removed the last prompt and its response.\n\n")
+	return nil, nil
+}
+
+func cmdClear(l *MainLoop, w io.Writer, args string) (*chatbot.ChatMessage, error) {
+	l.conversation = history.NewEntry()
+	l.Chatter.SetMessages([]chatbot.ChatMessage{})
+
+	fmt.Fprint(w, "Started a new conversation.\n\n")
+	return nil, nil
+}
+
+func cmdCompact(l *MainLoop, w io.Writer, args string) (*chatbot.ChatMessage, error) {
+	err := l.Compact()
+	if err != nil {
+		return nil, fmt.Errorf("could not compact conversation: %w", err)
+	}
+
+	fmt.Fprint(w, "Conversation compacted.\n\n")
+	return nil, nil
+}
+
+func cmdSave(l *MainLoop, w io.Writer, args string) (*chatbot.ChatMessage, error) {
+	if args == "" {
+		return nil, errors.New("usage: /save <name>")
+	}
+
+	if _, ok := l.history.(*history.NullKeeper); ok {
+		return nil, errors.New("history is disabled, set saveHistory to true in your config")
+	}
+
+	l.conversation.Title = args
+	_, err := l.history.SaveChat(l.conversation)
+	if err != nil {
+		return nil, fmt.Errorf("could not save chat: %w", err)
+	}
+
+	fmt.Fprintf(w, "Saved conversation as %[1]v. Show it with /history %[1]v or botman --history \"%[1]v\".\n\n", args)
+	return nil, nil
+}
+
+func cmdEdit(l *MainLoop, w io.Writer, args string) (*chatbot.ChatMessage, error) {
+	text, err := clitools.EditText(args, l.conversation.Tail(EditorTailMessages))
+	if err != nil {
+		return nil, err
+	}
+
+	if text == "" {
+		fmt.Fprint(w, "Empty prompt, nothing was sent.\n\n")
+		return nil, nil
+	}
+
+	fmt.Fprintf(w, "%v\n\n", text)
+	return &chatbot.ChatMessage{Role: chatbot.ChatMessageRoleUser, Content: text}, nil
+}
+
+func cmdHistory(l *MainLoop, w io.Writer, args string) (*chatbot.ChatMessage, error) {
+	if args == "" {
+		l.conversation.Fprint(w)
+		return nil, nil
+	}
+
+	entry, err := l.history.FindChat(args)
+	if err != nil {
+		return nil, err
+	}
+	entry.Fprint(w)
+	return nil, nil
+}
+
+func cmdUsage(l *MainLoop, w io.Writer, args string) (*chatbot.ChatMessage, error) {
+	responses := 0
+	total := chatbot.Usage{}
+	for _, m := range l.conversation.Messages {
+		if m.Usage == nil {
+			continue
+		}
+		responses++
+		total.InputTokens += m.Usage.InputTokens
+		total.OutputTokens += m.Usage.OutputTokens
+	}
+
+	if responses > 0 {
+		fmt.Fprintf(w, "Reported usage: %v input tokens, %v output tokens over %v responses.\n", total.InputTokens, total.OutputTokens, responses)
+	} else {
+		fmt.Fprintln(w, "The provider has not reported any usage.")
+	}
+
+	if l.window != nil {
+		used := l.window.Count(l.Chatter.GetSystemPrompt(), l.conversation.Messages)
+		fmt.Fprintf(w, "Context: ~%v of %v tokens.\n", used, l.window.Budget())
+	}
+
+	fmt.Fprintln(w)
+	return nil, nil
+}
+
+func cmdHelp(l *MainLoop, w io.Writer, args string) (*chatbot.ChatMessage, error) {
+	for _, c := range commands {
+		fmt.Fprintf(w, "%-18v %v\n", c.usage, c.description)
+	}
+	fmt.Fprint(w, "\nStart a prompt with // to send a message that starts with a slash.\n\n")
+	return nil, nil
+}
+
+// Index of the last message the user typed, or -1 if there is none.
+func (l *MainLoop) lastPromptIndex() int {
+	for i := len(l.conversation.Messages) - 1; i >= 0; i-- {
+		m := l.conversation.Messages[i]
+		if m.Role == chatbot.ChatMessageRoleUser && !m.Summary {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,149 @@
+package mainloop
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/c00/botman-v2/chatbot"
+	"github.com/c00/botman-v2/chattools"
+	"github.com/c00/botman-v2/internal/history"
+	"github.com/c00/botman-v2/internal/storageprovider"
+	"github.com/c00/botman-v2/providers/yappie"
+	"github.com/stretchr/testify/assert"
+)
+
+func newInteractiveLoop(inputs ...string) (*MainLoop, *history.InMemoryHistory, *stringWriter) {
+	userInput := &stringReader{}
+	for _, i := range inputs {
+		userInput.Add(i)
+	}
+	output := &stringWriter{}
+	hist := &history.InMemoryHistory{}
+
+	ml := New(&yappie.Yappie{}, hist, storageprovider.NewMemStore(), true, 0, userInput, output)
+	return &ml, hist, output
+}
+
+func TestCommandsAreNotSent(t *testing.T) {
+	ml, _, output := newInteractiveLoop("/help", "/nope", "second answer")
+
+	err := ml.Start("hey")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, ml.CurrentRun)
+	assert.Len(t, ml.Chatter.GetMessages(), 4)
+	assert.Contains(t, output.String(), "/retry")
+	assert.Contains(t, output.String(), "unknown command /nope")
+}
+
+func TestCommandEscapedSlash(t *testing.T) {
+	ml, _, _ := newInteractiveLoop("//usr/bin")
+
+	err := ml.Start("hey")
+	assert.Nil(t, err)
+	assert.Equal(t, "/usr/bin", ml.Chatter.GetMessages()[2].Content)
+}
+
+func TestCommandUndo(t *testing.T) {
+	ml, hist, _ := newInteractiveLoop("one answer", "/undo")
+
+	err := ml.Start("hey")
+	assert.Nil(t, err)
+	assert.Len(t, ml.Chatter.GetMessages(), 2)
+
+	entry, err := hist.LoadChat(0)
+	assert.Nil(t, err)
+	assert.Len(t, entry.Messages, 2)
+	assert.Equal(t, "hey", entry.Messages[0].Content)
+}
+
+func TestCommandRetry(t *testing.T) {
+	ml, _, _ := newInteractiveLoop("one answer", "/retry")
+
+	err := ml.Start("hey")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, ml.CurrentRun)
+	assert.Len(t, ml.Chatter.GetMessages(), 4)
+	assert.Equal(t, "one answer", ml.Chatter.GetMessages()[2].Content)
+}
+
+func TestCommandClear(t *testing.T) {
+	ml, _, _ := newInteractiveLoop("/clear", "one answer")
+
+	err := ml.Start("hey")
+	assert.Nil(t, err)
+	assert.Len(t, ml.Chatter.GetMessages(), 2)
+	assert.Equal(t, "one answer", ml.Chatter.GetMessages()[0].Content)
+}
+
+func TestCommandSystem(t *testing.T) {
+	ml, _, _ := newInteractiveLoop("/system You are a minion")
+
+	err := ml.Start("hey")
+	assert.Nil(t, err)
+	assert.Equal(t, "You are a minion", ml.Chatter.GetSystemPrompt())
+}
+
+func TestCommandTools(t *testing.T) {
+	ml, _, output := newInteractiveLoop("/tools off", "one answer")
+	ml.SetTools([]chattools.ToolDefinition{
+		{ToolType: chattools.ToolTypeAddNumbers, Name: "add_numbers", Description: "Add two numbers"},
+	})
+
+	err := ml.Start("")
+	assert.Nil(t, err)
+	assert.Contains(t, output.String(), "Tools are off. Available tools: add_numbers")
+	assert.Len(t, ml.Chatter.GetMessages(), 2)
+}
+
+func TestCommandModel(t *testing.T) {
+	ml, _, output := newInteractiveLoop("one answer", "/model other-model", "/model")
+	ml.SetChatterFactory(func(provider string, model string) (chatbot.Chatter, string, error) {
+		return &yappie.Yappie{SystemPrompt: model}, model, nil
+	}, "yappie", "yappie")
+
+	err := ml.Start("hey")
+	assert.Nil(t, err)
+	assert.Equal(t, "other-model", ml.Chatter.GetSystemPrompt())
+	assert.Len(t, ml.Chatter.GetMessages(), 4)
+	assert.Contains(t, output.String(), "Provider: yappie, model: other-model")
+}
+
+func TestCommandSave(t *testing.T) {
+	ml, hist, output := newInteractiveLoop("/save minion talk", "/history minion talk", "/history nope")
+
+	err := ml.Start("hey")
+	assert.Nil(t, err)
+
+	entry, err := hist.FindChat("minion talk")
+	assert.Nil(t, err)
+	if assert.NotEmpty(t, entry.Messages) {
+		assert.Equal(t, "hey", entry.Messages[0].Content)
+	}
+
+	//The saved conversation is shown
+	_, shown, _ := strings.Cut(output.String(), "Saved conversation as minion talk.")
+	assert.Contains(t, shown, "You: hey")
+	assert.Contains(t, shown, "no chat saved as nope")
+}
+
+func TestCommandEdit(t *testing.T) {
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", `printf 'from the editor\n' >`)
+	ml, _, _ := newInteractiveLoop("/edit")
+
+	err := ml.Start("hey")
+	assert.Nil(t, err)
+	assert.Len(t, ml.Chatter.GetMessages(), 4)
+	assert.Equal(t, "from the editor", ml.Chatter.GetMessages()[2].Content)
+}
+
+func TestCommandEditCancel(t *testing.T) {
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", ": >")
+	ml, _, output := newInteractiveLoop("/edit")
+
+	err := ml.Start("hey")
+	assert.Nil(t, err)
+	assert.Len(t, ml.Chatter.GetMessages(), 2)
+	assert.Contains(t, output.String(), "Empty prompt, nothing was sent.")
+}
@@ -0,0 +1,136 @@
+package mainloop
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/c00/botman-v2/chatbot"
+	"github.com/c00/botman-v2/internal/contextwindow"
+	"github.com/c00/botman-v2/internal/history"
+)
+
+const defaultCompactKeepLast = 2
+
+const summaryPrompt = "You summarize conversations between a user and an assistant. The summary replaces the conversation, so keep every fact, decision, name, number and piece of code that may be needed later. Leave out pleasantries. Only output the summary."
+
+var ErrNothingToCompact = errors.New("nothing to compact")
+
+// Use a different chatter for summarizing the conversation. Defaults to the active Chatter.
+func (l *MainLoop) SetSummarizer(chatter chatbot.Chatter) {
+	l.summarizer = chatter
+}
+
+func (l *MainLoop) SetCompaction(cfg contextwindow.CompactionConfig) {
+	l.compaction = cfg
+}
+
+// Compact summarizes older turns into a single message. The original messages are archived in the history entry.
+func (l *MainLoop) Compact() error {
+	keepLast := l.compaction.KeepLast
+	if keepLast < 1 {
+		keepLast = defaultCompactKeepLast
+	}
+
+	turns := contextwindow.SplitTurns(l.conversation.Messages)
+	if len(turns) <= keepLast {
+		return ErrNothingToCompact
+	}
+
+	old := []chatbot.ChatMessage{}
+	for _, t := range turns[:len(turns)-keepLast] {
+		old = append(old, t...)
+	}
+
+	kept := []chatbot.ChatMessage{}
+	for _, t := range turns[len(turns)-keepLast:] {
+		kept = append(kept, t...)
+	}
+
+	summary, err := l.summarize(old)
+	if err != nil {
+		return fmt.Errorf("could not summarize conversation: %w", err)
+	}
+
+	l.conversation.Archive = append(l.conversation.Archive, history.ArchivedTurns{
+		Date:     time.Now(),
+		Summary:  summary,
+		Messages: old,
+	})
+
+	//The summary goes in front of the first kept prompt, so user and assistant messages still take turns.
+	kept[0].Content = fmt.Sprintf("Summary of the earlier conversation:\n\n%v\n\nThe conversation continues:\n\n%v", summary, kept[0].Content)
+	kept[0].Summary = true
+	l.conversation.Messages = kept
+	l.Chatter.SetMessages(l.conversation.Messages)
+
+	log.Debug("Compacted %v messages into a summary", len(old))
+
+	_, err = l.history.SaveChat(l.conversation)
+	if err != nil {
+		return fmt.Errorf("could not save chat: %w", err)
+	}
+
+	return nil
+}
+
+// Compact when the conversation is over the configured threshold of the context window
+func (l *MainLoop) shouldCompact() bool {
+	if l.window == nil || l.compaction.Threshold <= 0 {
+		return false
+	}
+
+	used := l.window.Count(l.Chatter.GetSystemPrompt(), l.conversation.Messages)
+	return float64(used) > l.compaction.Threshold*float64(l.window.Budget())
+}
+
+func (l *MainLoop) summarize(messages []chatbot.ChatMessage) (string, error) {
+	chatter := l.summarizer
+	if chatter == nil {
+		chatter = l.Chatter
+	}
+
+	//The chatter keeps state, so restore it afterwards.
+	prevMessages := chatter.GetMessages()
+	prevPrompt := chatter.GetSystemPrompt()
+	defer func() {
+		chatter.SetSystemPrompt(prevPrompt)
+		chatter.SetMessages(prevMessages)
+		if chatter == l.Chatter {
+			l.applyTools()
+			l.applyResponseSchema()
+		}
+	}()
+
+	chatter.SetSystemPrompt(summaryPrompt)
+	chatter.SetMessages([]chatbot.ChatMessage{})
+
+	//The summary is text, so no tool calls or JSON. Without tools the tool choice does not apply.
+	if slices.Contains(chatter.SupportedFeatures(), "tools") {
+		chatter.SetTools(nil)
+	}
+	if responder, ok := chatter.(chatbot.SchemaResponder); ok {
+		responder.SetResponseSchema(nil)
+	}
+
+	transcript := make([]string, 0, len(messages))
+	for _, m := range messages {
+		transcript = append(transcript, m.Sprint())
+	}
+
+	resp, err := chatter.GetResponse(chatbot.ChatMessage{
+		Role:    chatbot.ChatMessageRoleUser,
+		Content: fmt.Sprintf("Summarize this conversation:\n\n%v", strings.Join(transcript, "\n\n")),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(resp.ToolCalls) > 0 || strings.TrimSpace(resp.Content) == "" {
+		return "", errors.New("empty summary")
+	}
+
+	return strings.TrimSpace(resp.Content), nil
+}
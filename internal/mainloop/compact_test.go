@@ -0,0 +1,121 @@
+package mainloop
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/c00/botman-v2/chatbot"
+	"github.com/c00/botman-v2/chattools"
+	"github.com/c00/botman-v2/internal/contextwindow"
+	"github.com/c00/botman-v2/internal/history"
+	"github.com/c00/botman-v2/internal/storageprovider"
+	"github.com/c00/botman-v2/providers/yappie"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMainLoopCompactCommand(t *testing.T) {
+	chatter := &yappie.Yappie{}
+	userInput := &stringReader{}
+	output := &stringWriter{}
+
+	userInput.Add("one answer")
+	userInput.Add("/compact")
+	userInput.Add("second answer")
+	hist := &history.InMemoryHistory{}
+	store := storageprovider.NewMemStore()
+
+	ml := New(chatter, hist, store, true, 0, userInput, output)
+	ml.SetCompaction(contextwindow.CompactionConfig{KeepLast: 1})
+
+	err := ml.Start("hey")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, ml.CurrentRun)
+	assert.Len(t, ml.Chatter.GetMessages(), 4)
+	assert.True(t, ml.Chatter.GetMessages()[0].Summary)
+
+	entry, err := hist.LoadChat(0)
+	assert.Nil(t, err)
+	assert.Len(t, entry.Messages, 4)
+	//The summary is in front of the kept prompt, so roles still take turns
+	assert.Equal(t, chatbot.ChatMessageRoleUser, entry.Messages[0].Role)
+	assert.Contains(t, entry.Messages[0].Content, "Summary of the earlier conversation")
+	assert.True(t, strings.HasSuffix(entry.Messages[0].Content, "one answer"))
+	assert.Equal(t, chatbot.ChatMessageRoleAssistant, entry.Messages[1].Role)
+	assert.Len(t, entry.Archive, 1)
+	assert.Len(t, entry.Archive[0].Messages, 2)
+	assert.Equal(t, "hey", entry.Archive[0].Messages[0].Content)
+}
+
+func TestMainLoopCompactNothing(t *testing.T) {
+	chatter := &yappie.Yappie{}
+	hist := &history.InMemoryHistory{}
+
+	ml := New(chatter, hist, storageprovider.NewMemStore(), false, 0, &stringReader{}, &stringWriter{})
+
+	err := ml.Start("hey")
+	assert.Nil(t, err)
+
+	err = ml.Compact()
+	assert.ErrorIs(t, err, ErrNothingToCompact)
+}
+
+func TestMainLoopAutoCompact(t *testing.T) {
+	chatter := &yappie.Yappie{}
+	userInput := &stringReader{}
+
+	userInput.Add("one answer")
+	userInput.Add("second answer")
+	hist := &history.InMemoryHistory{}
+
+	ml := New(chatter, hist, storageprovider.NewMemStore(), true, 0, userInput, &stringWriter{})
+	ml.SetContextWindow(contextwindow.New("yappie", contextwindow.Config{MaxTokens: 1000, ReserveTokens: 100}))
+	ml.SetCompaction(contextwindow.CompactionConfig{Threshold: 0.25, KeepLast: 1})
+
+	err := ml.Start("hey")
+	assert.Nil(t, err)
+
+	entry, err := hist.LoadChat(0)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, entry.Archive)
+	assert.True(t, entry.Messages[0].Summary)
+	for i := 1; i < len(entry.Messages); i++ {
+		assert.NotEqual(t, entry.Messages[i-1].Role, entry.Messages[i].Role)
+	}
+}
+
+// Yappie that keeps whether it had tools when it was asked for a summary.
+type summaryChatter struct {
+	*yappie.Yappie
+	tools     []chattools.ToolDefinition
+	withTools bool
+}
+
+func (c *summaryChatter) SetTools(tools []chattools.ToolDefinition) {
+	c.tools = tools
+	c.Yappie.SetTools(tools)
+}
+
+func (c *summaryChatter) GetResponse(msg chatbot.ChatMessage) (chatbot.ChatMessage, error) {
+	c.withTools = len(c.tools) > 0
+	return c.Yappie.GetResponse(msg)
+}
+
+func TestMainLoopCompactWithoutTools(t *testing.T) {
+	chatter := &summaryChatter{Yappie: &yappie.Yappie{}}
+	userInput := &stringReader{}
+	userInput.Add("one answer")
+	userInput.Add("/compact")
+
+	ml := New(chatter, &history.InMemoryHistory{}, storageprovider.NewMemStore(), true, 0, userInput, &stringWriter{})
+	ml.SetTools([]chattools.ToolDefinition{
+		{ToolType: chattools.ToolTypeAddNumbers, Name: "add_numbers", Description: "Add two numbers"},
+	})
+	ml.SetToolChoice(chattools.ToolChoice{Type: chattools.ToolChoiceAny})
+	ml.SetCompaction(contextwindow.CompactionConfig{KeepLast: 1})
+
+	err := ml.Start("hey")
+	assert.Nil(t, err)
+	assert.False(t, chatter.withTools)
+	assert.Len(t, chatter.tools, 1)
+	assert.NotEmpty(t, ml.conversation.Archive)
+}
@@ -0,0 +1,126 @@
+package mainloop
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/c00/botman-v2/chattools"
+	"github.com/c00/botman-v2/clitools"
+	"github.com/c00/botman-v2/internal/contextwindow"
+	"github.com/c00/botman-v2/internal/events"
+	"github.com/c00/botman-v2/internal/history"
+	"github.com/c00/botman-v2/internal/storageprovider"
+	"github.com/c00/botman-v2/providers/yappie"
+	"github.com/stretchr/testify/assert"
+)
+
+func readEvents(t *testing.T, output string) []events.Event {
+	result := []events.Event{}
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		e := events.Event{}
+		assert.Nil(t, json.Unmarshal([]byte(line), &e), line)
+		result = append(result, e)
+	}
+	return result
+}
+
+func eventTypes(evts []events.Event) []string {
+	types := []string{}
+	for _, e := range evts {
+		//Collapse text deltas
+		if e.Type == events.TypeText && len(types) > 0 && types[len(types)-1] == events.TypeText {
+			continue
+		}
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+func TestMainLoopEvents(t *testing.T) {
+	chatter := &yappie.Yappie{}
+	output := &stringWriter{}
+	hist := &history.InMemoryHistory{}
+
+	ml := New(chatter, hist, storageprovider.NewMemStore(), false, 0, &stringReader{}, output)
+	ml.SetEventWriter(events.NewWriter(output))
+	ml.SetTools([]chattools.ToolDefinition{
+		{ToolType: chattools.ToolTypeAddNumbers, Name: "add_numbers", Description: "Add two numbers"},
+	})
+
+	err := ml.Start("hey")
+	assert.Nil(t, err)
+
+	evts := readEvents(t, output.String())
+	assert.Equal(t, []string{
+		events.TypeConversation, events.TypeUser, events.TypeText, events.TypeToolCall, events.TypeStop,
+		events.TypeToolResult, events.TypeText, events.TypeStop,
+	}, eventTypes(evts))
+
+	assert.Equal(t, ml.conversation.Name, evts[0].Conversation)
+	assert.Equal(t, "hey", evts[1].Text)
+
+	//Text deltas add up to the response
+	text := ""
+	for _, e := range evts {
+		if e.Type == events.TypeText {
+			text += e.Text
+		}
+		if e.Type == events.TypeStop {
+			break
+		}
+	}
+	assert.Equal(t, ml.conversation.Messages[1].Content, strings.TrimSpace(text))
+
+	for _, e := range evts {
+		if e.Type == events.TypeToolResult {
+			assert.Equal(t, "add_numbers", e.Name)
+			assert.NotNil(t, e.Success)
+		}
+	}
+
+	//History produces the same events, with each response as a single text event
+	entry, err := hist.LoadChat(0)
+	assert.Nil(t, err)
+	assert.Equal(t, eventTypes(evts), eventTypes(events.FromHistory(entry)))
+}
+
+func TestMainLoopEventsError(t *testing.T) {
+	output := &stringWriter{}
+
+	ml := New(&yappie.Yappie{}, &history.InMemoryHistory{}, storageprovider.NewMemStore(), false, 0, &stringReader{}, output)
+	ml.SetEventWriter(events.NewWriter(output))
+	ml.SetContextWindow(contextwindow.New("yappie", contextwindow.Config{Strategy: contextwindow.StrategyRefuse, MaxTokens: 101, ReserveTokens: 100}))
+
+	err := ml.Start("hey")
+	assert.NotNil(t, err)
+
+	evts := readEvents(t, output.String())
+	last := evts[len(evts)-1]
+	assert.Equal(t, events.TypeError, last.Type)
+	assert.Equal(t, err.Error(), last.Error)
+}
+
+func TestMainLoopEventsCommands(t *testing.T) {
+	ml, _, output := newInteractiveLoop("/system be brief", "/nope")
+	//Keep prompts out of the events, like --json does
+	ml.SetLineReader(clitools.BasicReader{In: ml.input.(clitools.BasicReader).In, Out: io.Discard})
+	ml.SetEventWriter(events.NewWriter(output))
+
+	err := ml.Start("hey")
+	assert.Nil(t, err)
+
+	//Every line is an event
+	evts := readEvents(t, output.String())
+	commands := []events.Event{}
+	for _, e := range evts {
+		if e.Type == events.TypeCommand || e.Type == events.TypeError {
+			commands = append(commands, e)
+		}
+	}
+	assert.Equal(t, []events.Event{
+		{Type: events.TypeCommand, Name: "system", Text: "System prompt updated."},
+		{Type: events.TypeError, Error: "unknown command /nope, type /help for a list of commands"},
+	}, commands)
+}
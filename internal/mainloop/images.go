@@ -0,0 +1,63 @@
+package mainloop
+
+import (
+	"io"
+	"path/filepath"
+
+	"github.com/c00/botman-v2/chattools"
+	"github.com/c00/botman-v2/chattools/imagetool"
+	"github.com/c00/botman-v2/clitools"
+)
+
+// ImagePreview shows saved images in a terminal.
+type ImagePreview struct {
+	Store chattools.Storage
+	// One of the clitools image protocols
+	Protocol string
+	// The most columns an image takes
+	Columns int
+}
+
+// Show writes the images of a tool result value to w.
+func (p ImagePreview) Show(w io.Writer, value any) {
+	for _, path := range imagetool.Paths(value) {
+		p.ShowPath(w, path)
+	}
+}
+
+// ShowPath writes a saved image to w. Images that cannot be shown are skipped, their path is shown elsewhere.
+func (p ImagePreview) ShowPath(w io.Writer, path string) {
+	data, err := p.Store.Load(filepath.Base(path))
+	if err != nil {
+		log.Debug("could not load image %v for a preview: %v", path, err)
+		return
+	}
+
+	err = clitools.WriteImage(w, p.Protocol, data, p.Columns)
+	if err != nil {
+		log.Debug("could not show image %v: %v", path, err)
+	}
+}
+
+// Show the images that tools save in the terminal, with one of the clitools image protocols, at most columns
+// wide. ImageProtocolNone shows none.
+func (l *MainLoop) SetImagePreview(protocol string, columns int) {
+	if protocol == clitools.ImageProtocolNone {
+		l.imagePreview = nil
+		return
+	}
+	l.imagePreview = &ImagePreview{Store: l.storage, Protocol: protocol, Columns: columns}
+}
+
+// Show the images of tool results, when responses are written as text.
+func (l *MainLoop) showImages(results []chattools.ToolResult) {
+	if l.imagePreview == nil || l.events != nil || l.codeFilter != nil || l.responseSchema != nil {
+		return
+	}
+
+	for _, result := range results {
+		if result.Success {
+			l.imagePreview.Show(l.stdOut, result.Value)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package mainloop
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/c00/botman-v2/chattools"
+	"github.com/c00/botman-v2/clitools"
+	"github.com/c00/botman-v2/internal/events"
+	"github.com/c00/botman-v2/internal/history"
+	"github.com/c00/botman-v2/internal/storageprovider"
+	"github.com/c00/botman-v2/providers/yappie"
+	"github.com/stretchr/testify/assert"
+)
+
+func newImageLoop(t *testing.T) (*MainLoop, *stringWriter) {
+	store := storageprovider.NewMemStore()
+	path, err := store.Save("image-1.png", []byte("not really a png"))
+	assert.Nil(t, err)
+
+	output := &stringWriter{}
+	ml := New(&yappie.Yappie{}, &history.InMemoryHistory{}, store, false, 0, &stringReader{}, output)
+	ml.RegisterTool("test-image", testToolFactory(func(ctx context.Context, call chattools.ToolCall) chattools.ToolResult {
+		value := map[string]any{"images": []any{map[string]any{"path": path}}}
+		return chattools.ToolResult{Success: true, Content: "Image saved at: " + path, Value: value}
+	}))
+	ml.SetTools([]chattools.ToolDefinition{{ToolType: "test-image", Name: "draw"}})
+	return &ml, output
+}
+
+func TestImagePreview(t *testing.T) {
+	ml, output := newImageLoop(t)
+	ml.SetImagePreview(clitools.ImageProtocolIterm, 40)
+
+	err := ml.Start("draw a gopher")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, strings.Count(output.String(), "\x1b]1337;File=inline=1;size=16;width=40;"))
+}
+
+func TestImagePreviewOff(t *testing.T) {
+	ml, output := newImageLoop(t)
+	ml.SetImagePreview(clitools.ImageProtocolNone, 40)
+	assert.Nil(t, ml.Start("draw a gopher"))
+	assert.NotContains(t, output.String(), "\x1b]1337")
+
+	//Not in the events
+	ml, output = newImageLoop(t)
+	ml.SetImagePreview(clitools.ImageProtocolIterm, 40)
+	ml.SetEventWriter(events.NewWriter(output))
+	assert.Nil(t, ml.Start("draw a gopher"))
+	assert.NotContains(t, output.String(), "\x1b]1337")
+}
+
+func TestImagePreview_Show(t *testing.T) {
+	buf := &bytes.Buffer{}
+	assert.Nil(t, png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 2, 2))))
+
+	store := storageprovider.NewMemStore()
+	path, err := store.Save("a.png", buf.Bytes())
+	assert.Nil(t, err)
+
+	out := &strings.Builder{}
+	preview := ImagePreview{Store: store, Protocol: clitools.ImageProtocolIterm}
+	preview.Show(out, map[string]any{"images": []any{map[string]any{"path": path}, map[string]any{"path": "gone.png"}}})
+
+	//Images that are gone are skipped
+	assert.Equal(t, 1, strings.Count(out.String(), "\x1b]1337;File="))
+}
@@ -0,0 +1,50 @@
+package mainloop
+
+import (
+	"errors"
+
+	"github.com/c00/botman-v2/chattools"
+	"github.com/c00/botman-v2/chattools/mcp"
+)
+
+// StartMcpServers connects to the MCP servers and adds their tools. Servers that cannot start are left out.
+// Stop them with Close.
+func (l *MainLoop) StartMcpServers(servers []mcp.ServerConfig) {
+	if l.toolImpls == nil {
+		l.toolImpls = map[string]chattools.Tool{}
+	}
+
+	for _, conf := range servers {
+		server, err := mcp.Start(l.ctx, conf)
+		if err != nil {
+			log.Error("cannot start MCP server %v: %v", conf.Name, err)
+			continue
+		}
+
+		log.Debug("MCP server %v has %v tools", conf.Name, len(server.Tools))
+		l.mcpServers = append(l.mcpServers, server)
+		l.addServerTools(server)
+	}
+
+	l.applyTools()
+}
+
+func (l *MainLoop) addServerTools(server *mcp.Server) {
+	for _, tool := range server.Tools {
+		l.addTool(tool.Definition(), tool)
+	}
+}
+
+// Close stops the MCP servers.
+func (l *MainLoop) Close() error {
+	errs := []error{}
+	for _, server := range l.mcpServers {
+		err := server.Close()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	l.mcpServers = nil
+
+	return errors.Join(errs...)
+}
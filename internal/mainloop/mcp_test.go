@@ -0,0 +1,52 @@
+package mainloop
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/c00/botman-v2/chattools"
+	"github.com/c00/botman-v2/chattools/mcp"
+	"github.com/c00/botman-v2/internal/history"
+	"github.com/c00/botman-v2/internal/mcptest"
+	"github.com/c00/botman-v2/internal/storageprovider"
+	"github.com/c00/botman-v2/providers/yappie"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartMcpServers(t *testing.T) {
+	fixture := mcptest.New()
+	ts := httptest.NewServer(fixture.Handler())
+	defer ts.Close()
+
+	chatter := &yappie.Yappie{}
+	ml := New(chatter, &history.InMemoryHistory{}, storageprovider.NewMemStore(), false, 0, &stringReader{}, &stringWriter{})
+	ml.StartMcpServers([]mcp.ServerConfig{
+		{Name: "fixture", Url: ts.URL, Tools: []string{"echo", "add"}},
+		{Name: "broken", Command: "botman-no-such-command"},
+	})
+	assert.Len(t, ml.tools, 2)
+
+	//Configured tools come first, MCP tools stay
+	ml.SetTools([]chattools.ToolDefinition{{ToolType: chattools.ToolTypeAddNumbers, Name: "add_numbers"}})
+	assert.Equal(t, []string{"add_numbers", "fixture_echo", "fixture_add"}, toolNames(ml.tools))
+
+	ml.SetTools(nil)
+	assert.Equal(t, []string{"fixture_echo", "fixture_add"}, toolNames(ml.tools))
+
+	//Yappie calls the first tool
+	err := ml.Start("hey")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"echo"}, fixture.Calls())
+	assert.Equal(t, chattools.ToolResult{ID: "random-id-1", Name: "fixture_echo", Success: true, Content: "foo"}, ml.conversation.Messages[2].ToolResults[0])
+
+	assert.Nil(t, ml.Close())
+	assert.True(t, fixture.Closed())
+}
+
+func toolNames(defs []chattools.ToolDefinition) []string {
+	names := []string{}
+	for _, def := range defs {
+		names = append(names, def.Name)
+	}
+	return names
+}
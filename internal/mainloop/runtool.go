@@ -1,75 +1,103 @@
 package mainloop
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/c00/botman-v2/chattools"
-	"github.com/c00/botman-v2/chattools/sdxl"
-	"github.com/c00/botman-v2/internal/storageprovider"
+	"github.com/c00/botman-v2/jsonschema"
+	//Register the tools that come with botman
+	_ "github.com/c00/botman-v2/chattools/command"
+	_ "github.com/c00/botman-v2/chattools/dalle"
+	_ "github.com/c00/botman-v2/chattools/localsd"
+	_ "github.com/c00/botman-v2/chattools/sdxl"
 )
 
-func (ml *MainLoop) runTool(call chattools.ToolCall, def chattools.ToolDefinition) chattools.ToolResult {
-	result := chattools.ToolResult{
-		Content: fmt.Sprintf("tool %v not implemented", def.ToolType),
-		Success: false,
+// Register a tool type for this loop only, e.g. a custom tool of a library user. Call it before SetTools.
+func (l *MainLoop) RegisterTool(toolType string, factory chattools.Factory) {
+	l.registry.Register(toolType, factory)
+}
+
+// SetTools creates the tools for the definitions. Definitions of tools that cannot be created are left out.
+func (l *MainLoop) SetTools(defs []chattools.ToolDefinition) {
+	l.tools = []chattools.ToolDefinition{}
+	l.toolImpls = map[string]chattools.Tool{}
+
+	for _, def := range defs {
+		tool, err := l.registry.New(def, chattools.Env{Storage: l.storage})
+		if err != nil {
+			log.Error("cannot create tool %v: %v", def.Name, err)
+			continue
+		}
+
+		if _, err := chattools.ParseToolChoice(def.ToolChoice); err != nil {
+			log.Warn("tool %v: %v", def.Name, err)
+		}
+
+		l.addTool(def.WithSchema(tool.Schema()), tool)
 	}
 
-	switch def.ToolType {
-	case chattools.ToolTypeAddNumbers:
-		result = runAddNumbers(call)
-	case chattools.ToolTypeSdxl:
-		result = runSdxlTool(call, def, ml.storage)
+	//Tools of MCP servers stay
+	for _, server := range l.mcpServers {
+		l.addServerTools(server)
 	}
 
-	//Set this here to be sure they get set.
-	result.ID = call.ID
-	result.Name = call.Name
+	l.applyTools()
+}
 
-	return result
+func (l *MainLoop) addTool(def chattools.ToolDefinition, tool chattools.Tool) {
+	if _, ok := l.toolImpls[def.Name]; ok {
+		log.Warn("skipped tool %v, there already is a tool with that name", def.Name)
+		return
+	}
+
+	l.tools = append(l.tools, def)
+	l.toolImpls[def.Name] = tool
 }
 
-func runSdxlTool(call chattools.ToolCall, def chattools.ToolDefinition, store storageprovider.StorageProvider) chattools.ToolResult {
-	result := chattools.ToolResult{}
+// Check the params of a call against the schema of its tool. A call that does not match gets a failed result
+// that explains why, so the model can correct it.
+func (l *MainLoop) validateCall(call chattools.ToolCall) *chattools.ToolResult {
+	err := l.validateParams(call.Name, call.Params)
+	if err == nil {
+		return nil
+	}
+
+	log.Warn("invalid call to %v: %v", call.Name, err)
+	return &chattools.ToolResult{
+		ID:      call.ID,
+		Name:    call.Name,
+		Success: false,
+		Content: fmt.Sprintf("The tool did not run, the parameters are invalid: %v", err),
+	}
+}
 
-	//todo get the storage provider here.
-	// store, err := storageprovider.NewLocalStore(filepath.Join(config.GetUserConfigPath(), "generated-images"))
-	// if err != nil {
-	// 	result.Content = fmt.Sprintf("cannot create storage provider: %v", err)
-	// 	return result
-	// }
-	tool, err := sdxl.New(def, store)
+func (l *MainLoop) validateParams(name string, params map[string]any) error {
+	def, err := l.getToolDef(name)
 	if err != nil {
-		result.Content = fmt.Sprintf("cannot create new sdxl tool: %v", err)
-		return result
+		//Fails when it runs
+		return nil
 	}
 
-	return tool.Run(call)
+	if params == nil {
+		params = map[string]any{}
+	}
+	return jsonschema.Validate(def.Schema(), params)
 }
 
-func getInt(params map[string]any, key string) int {
-	switch val := params[key].(type) {
-	case nil:
-		return 0
-	case int:
-		return val
-	case int32:
-		return int(val)
-	case int64:
-		return int(val)
-	case float32:
-		return int(val)
-	case float64:
-		return int(val)
+func (l *MainLoop) runTool(ctx context.Context, call chattools.ToolCall, def chattools.ToolDefinition) chattools.ToolResult {
+	result := chattools.ToolResult{
+		Content: fmt.Sprintf("tool %v not implemented", def.ToolType),
+		Success: false,
+	}
+
+	if tool, ok := l.toolImpls[def.Name]; ok {
+		result = tool.Run(ctx, call)
 	}
 
-	return 0
-}
+	//Set this here to be sure they get set.
+	result.ID = call.ID
+	result.Name = call.Name
 
-// func getString(params map[string]any, key string) string {
-// 	if val, ok := params[key]; ok {
-// 		if num, ok := val.(string); ok {
-// 			return num
-// 		}
-// 	}
-// 	return ""
-// }
+	return result
+}
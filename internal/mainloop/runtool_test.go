@@ -0,0 +1,172 @@
+package mainloop
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/c00/botman-v2/chattools"
+	"github.com/c00/botman-v2/internal/history"
+	"github.com/c00/botman-v2/internal/storageprovider"
+	"github.com/c00/botman-v2/jsonschema"
+	"github.com/c00/botman-v2/providers/yappie"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	toolTypeTestSleep = "test-sleep"
+	toolTypeTestPanic = "test-panic"
+	toolTypeTestHang  = "test-hang"
+)
+
+var running, maxRunning atomic.Int32
+
+// A tool that runs a function
+type testTool struct {
+	name string
+	run  func(ctx context.Context, call chattools.ToolCall) chattools.ToolResult
+}
+
+func (t testTool) Name() string {
+	return t.name
+}
+
+func (t testTool) Schema() jsonschema.JsonSchema {
+	return jsonschema.New()
+}
+
+func (t testTool) Run(ctx context.Context, call chattools.ToolCall) chattools.ToolResult {
+	return t.run(ctx, call)
+}
+
+func testToolFactory(run func(ctx context.Context, call chattools.ToolCall) chattools.ToolResult) chattools.Factory {
+	return func(def chattools.ToolDefinition, env chattools.Env) (chattools.Tool, error) {
+		return testTool{name: def.Name, run: run}, nil
+	}
+}
+
+func sleepTool(ctx context.Context, call chattools.ToolCall) chattools.ToolResult {
+	n := running.Add(1)
+	defer running.Add(-1)
+	for {
+		old := maxRunning.Load()
+		if n <= old || maxRunning.CompareAndSwap(old, n) {
+			break
+		}
+	}
+
+	ms, _ := call.Params["ms"].(int)
+	time.Sleep(time.Duration(ms) * time.Millisecond)
+	return chattools.ToolResult{Success: true, Content: fmt.Sprint(ms)}
+}
+
+func newToolLoop() *MainLoop {
+	ml := New(&yappie.Yappie{}, &history.InMemoryHistory{}, storageprovider.NewMemStore(), false, 0, &stringReader{}, &stringWriter{})
+	ml.RegisterTool(toolTypeTestSleep, testToolFactory(sleepTool))
+	ml.RegisterTool(toolTypeTestPanic, testToolFactory(func(ctx context.Context, call chattools.ToolCall) chattools.ToolResult {
+		panic("oh no")
+	}))
+	ml.RegisterTool(toolTypeTestHang, testToolFactory(func(ctx context.Context, call chattools.ToolCall) chattools.ToolResult {
+		//Ignores ctx on purpose
+		select {}
+	}))
+	ml.SetTools([]chattools.ToolDefinition{
+		{ToolType: toolTypeTestSleep, Name: "sleep"},
+		{ToolType: toolTypeTestPanic, Name: "panic"},
+		{ToolType: toolTypeTestHang, Name: "hang", Timeout: 50 * time.Millisecond},
+	})
+	return &ml
+}
+
+func TestRunToolsConcurrently(t *testing.T) {
+	ml := newToolLoop()
+	ml.SetToolConcurrency(2)
+	maxRunning.Store(0)
+
+	calls := []chattools.ToolCall{}
+	for i, ms := range []int{80, 10, 50, 20} {
+		calls = append(calls, chattools.ToolCall{ID: fmt.Sprint(i), Name: "sleep", Params: map[string]any{"ms": ms}})
+	}
+
+	results := ml.runTools(calls)
+
+	//In the order of the calls, not the order they finished in
+	assert.Len(t, results, 4)
+	for i, r := range results {
+		assert.Equal(t, fmt.Sprint(i), r.ID)
+		assert.Equal(t, fmt.Sprint(calls[i].Params["ms"]), r.Content)
+		assert.True(t, r.Success)
+	}
+	assert.Equal(t, int32(2), maxRunning.Load())
+}
+
+func TestRunToolsFailures(t *testing.T) {
+	ml := newToolLoop()
+
+	results := ml.runTools([]chattools.ToolCall{
+		{ID: "1", Name: "panic"},
+		{ID: "2", Name: "hang"},
+		{ID: "3", Name: "missing"},
+		{ID: "4", Name: "sleep", Params: map[string]any{"ms": 1}},
+	})
+
+	assert.Len(t, results, 4)
+	assert.False(t, results[0].Success)
+	assert.Contains(t, results[0].Content, "oh no")
+	assert.False(t, results[1].Success)
+	assert.Contains(t, results[1].Content, "did not finish within 50ms")
+	assert.False(t, results[2].Success)
+	assert.True(t, results[3].Success)
+
+	for i, r := range results {
+		assert.Equal(t, fmt.Sprint(i+1), r.ID)
+	}
+}
+
+func TestRunToolsCancelled(t *testing.T) {
+	ml := newToolLoop()
+	ctx, cancel := context.WithCancel(context.Background())
+	ml.SetContext(ctx)
+	cancel()
+
+	results := ml.runTools([]chattools.ToolCall{{ID: "1", Name: "hang"}})
+	assert.False(t, results[0].Success)
+	assert.Contains(t, results[0].Content, "cancelled")
+}
+
+func TestRegisterTool(t *testing.T) {
+	chatter := &yappie.Yappie{}
+	ml := New(chatter, &history.InMemoryHistory{}, storageprovider.NewMemStore(), false, 0, &stringReader{}, &stringWriter{})
+
+	called := false
+	ml.RegisterTool("custom", testToolFactory(func(ctx context.Context, call chattools.ToolCall) chattools.ToolResult {
+		called = true
+		return chattools.ToolResult{Success: true, Content: "custom result"}
+	}))
+	ml.SetTools([]chattools.ToolDefinition{
+		{ToolType: "custom", Name: "my_tool"},
+		{ToolType: "unknown", Name: "left_out"},
+	})
+	assert.Len(t, ml.tools, 1)
+
+	err := ml.Start("hey")
+	assert.Nil(t, err)
+	assert.True(t, called)
+	assert.Equal(t, "custom result", ml.conversation.Messages[2].ToolResults[0].Content)
+}
+
+func TestRunToolsInvalidParams(t *testing.T) {
+	ml := New(&yappie.Yappie{}, &history.InMemoryHistory{}, storageprovider.NewMemStore(), false, 0, &stringReader{}, &stringWriter{})
+	ml.SetTools([]chattools.ToolDefinition{{ToolType: chattools.ToolTypeAddNumbers, Name: "add", Approval: chattools.ApprovalDeny}})
+
+	results := ml.runTools([]chattools.ToolCall{
+		{ID: "1", Name: "add", Params: map[string]any{"a": "5"}},
+		{ID: "2", Name: "add"},
+	})
+
+	//Invalid calls are not even considered for approval
+	assert.Equal(t, chattools.ToolResult{ID: "1", Name: "add", Success: false, Content: `The tool did not run, the parameters are invalid: a: must be a number, not string "5"; b: is required`}, results[0])
+	assert.Equal(t, `The tool did not run, the parameters are invalid: a: is required; b: is required`, results[1].Content)
+}
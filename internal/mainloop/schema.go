@@ -0,0 +1,116 @@
+package mainloop
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/c00/botman-v2/chatbot"
+	"github.com/c00/botman-v2/internal/markdown"
+	"github.com/c00/botman-v2/jsonschema"
+)
+
+const DefaultSchemaRetries = 2
+
+var ErrInvalidResponse = errors.New("response does not match the schema")
+
+// Make the model answer with JSON that matches schema. Answers that don't match are asked again
+// up to retries times, with the problems. The JSON of valid answers is written to stdout.
+func (l *MainLoop) SetResponseSchema(schema jsonschema.JsonSchema, retries int) {
+	l.responseSchema = &schema
+	l.schemaRetries = retries
+	l.applyResponseSchema()
+}
+
+// Give the schema to the chatter if it supports it. Other chatters get instructions in the prompt.
+func (l *MainLoop) applyResponseSchema() {
+	if l.responseSchema == nil {
+		return
+	}
+
+	if responder, ok := l.Chatter.(chatbot.SchemaResponder); ok {
+		responder.SetResponseSchema(l.responseSchema)
+	}
+}
+
+// Add the schema to a prompt of the user, for chatters that don't support a response schema.
+func (l *MainLoop) schemaPrompt(msg chatbot.ChatMessage) chatbot.ChatMessage {
+	if l.responseSchema == nil || msg.Role != chatbot.ChatMessageRoleUser {
+		return msg
+	}
+	if _, ok := l.Chatter.(chatbot.SchemaResponder); ok {
+		return msg
+	}
+
+	data, err := json.MarshalIndent(l.responseSchema, "", "  ")
+	if err != nil {
+		log.Warn("could not encode response schema: %v", err)
+		return msg
+	}
+
+	msg.Content = fmt.Sprintf("%v\n\nAnswer with only JSON that matches this JSON schema, without any other text:\n\n%s", msg.Content, data)
+	return msg
+}
+
+// Check the response against the schema. Returns the JSON of the response when it matches.
+func (l *MainLoop) checkResponse(response chatbot.ChatMessage) (json.RawMessage, error) {
+	raw := []byte(extractJson(response.Content))
+
+	var value any
+	err := json.Unmarshal(raw, &value)
+	if err != nil {
+		return nil, fmt.Errorf("the response is not valid JSON: %w", err)
+	}
+
+	err = jsonschema.Validate(*l.responseSchema, value)
+	if err != nil {
+		return nil, err
+	}
+
+	return raw, nil
+}
+
+// The message that asks the model to answer again, because of err.
+func reaskMessage(err error) chatbot.ChatMessage {
+	problems := err.Error()
+	var validationErrs jsonschema.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		lines := []string{}
+		for _, e := range validationErrs {
+			lines = append(lines, "- "+e.Error())
+		}
+		problems = strings.Join(lines, "\n")
+	}
+
+	return chatbot.ChatMessage{
+		Role:    chatbot.ChatMessageRoleUser,
+		Content: fmt.Sprintf("Your answer does not match the JSON schema:\n\n%v\n\nAnswer again with only the corrected JSON.", problems),
+	}
+}
+
+// Write the JSON of a valid response, unless events are written instead.
+func (l *MainLoop) writeJson(raw json.RawMessage) error {
+	if l.events != nil {
+		return nil
+	}
+
+	buf := bytes.Buffer{}
+	err := json.Indent(&buf, raw, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not format response: %w", err)
+	}
+	buf.WriteString("\n")
+
+	_, err = l.stdOut.Write(buf.Bytes())
+	return err
+}
+
+// The JSON in a response. Models sometimes put it in a code block anyway.
+func extractJson(content string) string {
+	if blocks := markdown.CodeBlocks(content); len(blocks) > 0 {
+		return strings.TrimSpace(blocks[0].Code)
+	}
+	return strings.TrimSpace(content)
+}
@@ -0,0 +1,92 @@
+package mainloop
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/c00/botman-v2/chatbot"
+	"github.com/c00/botman-v2/internal/history"
+	"github.com/c00/botman-v2/internal/storageprovider"
+	"github.com/c00/botman-v2/jsonschema"
+	"github.com/c00/botman-v2/providers/yappie"
+	"github.com/stretchr/testify/assert"
+)
+
+// A chatter without response schema support.
+type plainChatter struct {
+	chatbot.Chatter
+}
+
+func personSchema() jsonschema.JsonSchema {
+	schema := jsonschema.New()
+	schema.AddString("name", "", true)
+	schema.AddInteger("age", "", true)
+	schema.AdditionalProperties = jsonschema.Bool(false)
+	return schema
+}
+
+func newSchemaLoop(chatter chatbot.Chatter, retries int) (*MainLoop, *history.InMemoryHistory, *stringWriter) {
+	output := &stringWriter{}
+	hist := &history.InMemoryHistory{}
+	ml := New(chatter, hist, storageprovider.NewMemStore(), false, 0, &stringReader{}, output)
+	ml.SetResponseSchema(personSchema(), retries)
+	return &ml, hist, output
+}
+
+func TestResponseSchema(t *testing.T) {
+	ml, _, output := newSchemaLoop(&yappie.Yappie{}, DefaultSchemaRetries)
+
+	err := ml.Start("Bob is 42")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, ml.CurrentRun)
+
+	//Only the JSON is written
+	value := map[string]any{}
+	assert.Nil(t, json.Unmarshal([]byte(output.String()), &value))
+	assert.Nil(t, jsonschema.Validate(personSchema(), value))
+}
+
+func TestResponseSchemaReask(t *testing.T) {
+	ml, hist, output := newSchemaLoop(&yappie.Yappie{InvalidResponses: 1}, DefaultSchemaRetries)
+
+	err := ml.Start("Bob is 42")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, ml.CurrentRun)
+	assert.Equal(t, 1, ml.turns)
+	assert.Contains(t, output.String(), `"name"`)
+
+	entry, err := hist.LoadChat(0)
+	assert.Nil(t, err)
+	assert.Len(t, entry.Messages, 4)
+	assert.Contains(t, entry.Messages[2].Content, "yappie: is not a known property")
+}
+
+func TestResponseSchemaRetriesUsedUp(t *testing.T) {
+	ml, _, output := newSchemaLoop(&yappie.Yappie{InvalidResponses: 5}, 2)
+
+	err := ml.Start("Bob is 42")
+	assert.ErrorIs(t, err, ErrInvalidResponse)
+	assert.Contains(t, err.Error(), "after 3 attempts")
+	assert.Equal(t, 3, ml.CurrentRun)
+	assert.Empty(t, output.String())
+}
+
+func TestResponseSchemaPrompt(t *testing.T) {
+	ml, hist, _ := newSchemaLoop(plainChatter{&yappie.Yappie{}}, 0)
+
+	//Yappie does not know it should answer with JSON
+	err := ml.Start("Bob is 42")
+	assert.ErrorIs(t, err, ErrInvalidResponse)
+	assert.Contains(t, err.Error(), "not valid JSON")
+
+	entry, err := hist.LoadChat(0)
+	assert.Nil(t, err)
+	assert.Contains(t, entry.Messages[0].Content, "Bob is 42")
+	assert.Contains(t, entry.Messages[0].Content, "matches this JSON schema")
+	assert.Contains(t, entry.Messages[0].Content, `"age"`)
+}
+
+func TestExtractJson(t *testing.T) {
+	assert.Equal(t, `{"a": 1}`, extractJson(` {"a": 1}`+"\n"))
+	assert.Equal(t, `{"a": 1}`, extractJson("Here you go:\n\n```json\n{\"a\": 1}\n```\n"))
+}
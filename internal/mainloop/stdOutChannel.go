@@ -6,7 +6,7 @@ import (
 	"sync"
 )
 
-// Create a channel that outputs to stdout
+// Create a channel that outputs to stdout. Writers with a Flush method, like a markdown.Renderer, are flushed when the channel closes.
 func stdOutChannel(wg *sync.WaitGroup, out io.Writer) chan string {
 	wg.Add(1)
 	ch := make(chan string)
@@ -14,6 +14,9 @@ func stdOutChannel(wg *sync.WaitGroup, out io.Writer) chan string {
 		for chunk := range ch {
 			fmt.Fprint(out, chunk)
 		}
+		if f, ok := out.(interface{ Flush() }); ok {
+			f.Flush()
+		}
 		wg.Done()
 	}(ch)
 
@@ -0,0 +1,69 @@
+package mainloop
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/c00/botman-v2/chatbot"
+	"github.com/c00/botman-v2/chattools"
+)
+
+// Force or forbid tool calls in the responses to prompts of the user. Responses to tool results use
+// the tool choice of the tools that ran, or auto. DisableParallel applies to all responses.
+func (l *MainLoop) SetToolChoice(choice chattools.ToolChoice) {
+	l.toolChoice = choice
+}
+
+// Check that the tool a choice forces exists.
+func (l *MainLoop) checkToolChoice(choice chattools.ToolChoice) error {
+	if choice.Type != chattools.ToolChoiceTool {
+		return nil
+	}
+
+	_, err := l.getToolDef(choice.Name)
+	if err != nil {
+		return fmt.Errorf("cannot force tool: %w", err)
+	}
+	return nil
+}
+
+// The tool choice for the response to pending.
+func (l *MainLoop) toolChoiceFor(pending chatbot.ChatMessage) chattools.ToolChoice {
+	if pending.Role != chatbot.ChatMessageRoleTool {
+		return l.toolChoice
+	}
+
+	choice := chattools.ToolChoice{Type: chattools.ToolChoiceAuto, DisableParallel: l.toolChoice.DisableParallel}
+	for _, result := range pending.ToolResults {
+		def, err := l.getToolDef(result.Name)
+		if err != nil || def.ToolChoice == "" {
+			continue
+		}
+
+		toolChoice, err := chattools.ParseToolChoice(def.ToolChoice)
+		if err != nil {
+			log.Warn("tool %v: %v", def.Name, err)
+			continue
+		}
+
+		//The first tool that has a choice decides
+		choice.Type = toolChoice.Type
+		choice.Name = toolChoice.Name
+		break
+	}
+	return choice
+}
+
+// Give the tool choice to the chatter if it supports it. Warns once when it does not.
+func (l *MainLoop) applyToolChoice(choice chattools.ToolChoice) {
+	chooser, ok := l.Chatter.(chatbot.ToolChooser)
+	if !ok || !slices.Contains(l.Chatter.SupportedFeatures(), "tools") {
+		if !choice.IsAuto() && !l.toolChoiceWarned {
+			log.Warn("the chatter does not support tool choice, the tool choice and parallel tool calls settings are ignored")
+			l.toolChoiceWarned = true
+		}
+		return
+	}
+
+	chooser.SetToolChoice(choice)
+}
@@ -0,0 +1,93 @@
+package mainloop
+
+import (
+	"testing"
+
+	"github.com/c00/botman-v2/chattools"
+	"github.com/c00/botman-v2/internal/history"
+	"github.com/c00/botman-v2/internal/limits"
+	"github.com/c00/botman-v2/internal/storageprovider"
+	"github.com/c00/botman-v2/providers/yappie"
+	"github.com/stretchr/testify/assert"
+)
+
+// Yappie that keeps the tool choices it was given.
+type choiceRecorder struct {
+	*yappie.Yappie
+	choices []chattools.ToolChoice
+}
+
+func (c *choiceRecorder) SetToolChoice(choice chattools.ToolChoice) {
+	c.choices = append(c.choices, choice)
+	c.Yappie.SetToolChoice(choice)
+}
+
+func newToolChoiceLoop(toolChoice string, inputs ...string) (*MainLoop, *choiceRecorder, *stringWriter) {
+	userInput := &stringReader{}
+	for _, in := range inputs {
+		userInput.Add(in)
+	}
+	output := &stringWriter{}
+	chatter := &choiceRecorder{Yappie: &yappie.Yappie{}}
+
+	ml := New(chatter, &history.InMemoryHistory{}, storageprovider.NewMemStore(), len(inputs) > 0, 0, userInput, output)
+	ml.SetTools([]chattools.ToolDefinition{
+		{ToolType: chattools.ToolTypeAddNumbers, Name: "add_numbers", Description: "Add two numbers", ToolChoice: toolChoice},
+	})
+	return &ml, chatter, output
+}
+
+func TestToolChoiceNone(t *testing.T) {
+	ml, chatter, _ := newToolChoiceLoop("")
+	ml.SetToolChoice(chattools.ToolChoice{Type: chattools.ToolChoiceNone})
+
+	err := ml.Start("hey")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, ml.CurrentRun)
+	assert.Equal(t, []chattools.ToolChoice{{Type: chattools.ToolChoiceNone}}, chatter.choices)
+}
+
+func TestToolChoiceAny(t *testing.T) {
+	ml, chatter, _ := newToolChoiceLoop("")
+	ml.SetToolChoice(chattools.ToolChoice{Type: chattools.ToolChoiceAny, DisableParallel: true})
+
+	//Only the response to the prompt is forced to call a tool
+	err := ml.Start("hey")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, ml.CurrentRun)
+	assert.Equal(t, []chattools.ToolChoice{
+		{Type: chattools.ToolChoiceAny, DisableParallel: true},
+		{Type: chattools.ToolChoiceAuto, DisableParallel: true},
+	}, chatter.choices)
+}
+
+func TestToolChoiceOfTool(t *testing.T) {
+	ml, chatter, _ := newToolChoiceLoop("tool:add_numbers")
+	ml.SetBudget(limits.Budget{MaxToolRounds: 2})
+
+	err := ml.Start("hey")
+	assert.ErrorIs(t, err, ErrBudgetExceeded)
+	assert.Equal(t, 3, ml.CurrentRun)
+	assert.Equal(t, chattools.ToolChoice{Type: chattools.ToolChoiceTool, Name: "add_numbers"}, chatter.choices[2])
+}
+
+func TestToolChoiceUnknownTool(t *testing.T) {
+	ml, _, _ := newToolChoiceLoop("")
+	ml.SetToolChoice(chattools.ToolChoice{Type: chattools.ToolChoiceTool, Name: "nope"})
+
+	err := ml.Start("hey")
+	assert.ErrorContains(t, err, "tool nope not found")
+	assert.Equal(t, 0, ml.CurrentRun)
+}
+
+func TestCommandToolChoice(t *testing.T) {
+	ml, chatter, output := newToolChoiceLoop("", "/toolchoice tool:nope", "/toolchoice none", "/parallel off", "hi")
+
+	err := ml.Start("")
+	assert.Nil(t, err)
+	assert.Contains(t, output.String(), "tool nope not found")
+	assert.Contains(t, output.String(), "Tool choice: none")
+	assert.Contains(t, output.String(), "Parallel tool calls are off.")
+	assert.Equal(t, []chattools.ToolChoice{{Type: chattools.ToolChoiceNone, DisableParallel: true}}, chatter.choices)
+	assert.Len(t, chatter.GetMessages(), 2)
+}
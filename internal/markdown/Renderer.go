@@ -0,0 +1,494 @@
+package markdown
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	styleReset   = "\x1b[0m"
+	styleBold    = "\x1b[1m"
+	styleDim     = "\x1b[2m"
+	styleItalic  = "\x1b[3m"
+	styleCode    = "\x1b[36m"
+	styleHeading = "\x1b[1;35m"
+)
+
+type lineKind int
+
+const (
+	kindUnknown lineKind = iota
+	kindBlank
+	kindParagraph
+	kindHeading
+	kindList
+	kindQuote
+	kindRule
+	kindFence
+	kindCode
+	kindTable
+)
+
+var (
+	orderedListRe = regexp.MustCompile(`^(\d+)[.)] `)
+	headingRe     = regexp.MustCompile(`^(#{1,6}) `)
+	tableSepRe    = regexp.MustCompile(`^\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?$`)
+)
+
+// NewRenderer creates a renderer that writes to out and wraps text at width.
+func NewRenderer(out io.Writer, width int) *Renderer {
+	if width < 20 {
+		width = 80
+	}
+
+	return &Renderer{
+		out:   out,
+		width: width,
+	}
+}
+
+// Renderer renders Markdown for a terminal while it is being streamed.
+// Text is written word by word as soon as a word is complete. Code blocks are written
+// per line and tables once they are complete, as their column widths depend on all rows.
+type Renderer struct {
+	out   io.Writer
+	width int
+	// The current line, from its start
+	buf string
+	// Bytes of the current line that have been handled
+	consumed int
+	kind     lineKind
+
+	col int
+	// Printed at the start of each wrapped line, with its width
+	contPrefix string
+	indent     int
+	lineStyle  string
+	inline     inlineState
+
+	inCode   bool
+	fence    string
+	codeLang string
+	table    []string
+}
+
+// Write streamed Markdown. Always consumes all of p.
+func (r *Renderer) Write(p []byte) (int, error) {
+	r.buf += string(p)
+
+	for {
+		idx := strings.IndexByte(r.buf, '\n')
+		if idx == -1 {
+			break
+		}
+
+		line := r.buf[:idx]
+		r.buf = r.buf[idx+1:]
+		r.processLine(strings.TrimSuffix(line, "\r"), true)
+	}
+
+	r.processLine(r.buf, false)
+	return len(p), nil
+}
+
+// Flush renders whatever is left at the end of a response.
+func (r *Renderer) Flush() {
+	if strings.TrimSpace(r.buf) == "" && !r.inCode {
+		r.buf = ""
+	}
+
+	if r.buf != "" {
+		r.processLine(r.buf, false)
+		if r.kind == kindUnknown {
+			r.kind, _ = r.classify(r.buf, true)
+			r.startLine(r.buf)
+		}
+
+		switch r.kind {
+		case kindParagraph, kindHeading, kindList, kindQuote:
+			r.streamWords(r.buf, true)
+			r.resetLine()
+		default:
+			r.renderBuffered(r.buf)
+		}
+		r.buf = ""
+	}
+
+	r.flushTable()
+	r.inCode = false
+	r.kind = kindUnknown
+	r.consumed = 0
+}
+
+func (r *Renderer) processLine(line string, complete bool) {
+	if r.kind == kindUnknown {
+		kind, ok := r.classify(line, complete)
+		if !ok {
+			return
+		}
+		r.kind = kind
+		r.startLine(line)
+	}
+
+	switch r.kind {
+	case kindParagraph, kindHeading, kindList, kindQuote:
+		r.streamWords(line, complete)
+		if complete {
+			r.endLine()
+		}
+	default:
+		if complete {
+			r.renderBuffered(line)
+		}
+	}
+}
+
+// Work out what kind of line this is. Returns false if more of the line is needed to know.
+func (r *Renderer) classify(line string, complete bool) (lineKind, bool) {
+	trimmed := strings.TrimLeft(line, " \t")
+
+	if r.inCode {
+		if strings.HasPrefix(trimmed, r.fence) {
+			return kindFence, true
+		}
+		if !complete && len(trimmed) < len(r.fence) && strings.HasPrefix(r.fence, trimmed) {
+			return kindUnknown, false
+		}
+		return kindCode, true
+	}
+
+	if trimmed == "" {
+		return kindBlank, complete
+	}
+
+	if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+		return kindFence, true
+	}
+
+	if strings.HasPrefix(trimmed, "|") {
+		return kindTable, true
+	}
+
+	if strings.HasPrefix(trimmed, ">") {
+		return kindQuote, true
+	}
+
+	if trimmed[0] == '`' || trimmed[0] == '~' {
+		if len(trimmed) < 3 && !complete {
+			return kindUnknown, false
+		}
+		return kindParagraph, true
+	}
+
+	if trimmed[0] == '#' {
+		hashes := len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+		if hashes == len(trimmed) && !complete {
+			return kindUnknown, false
+		}
+		if headingRe.MatchString(trimmed) {
+			return kindHeading, true
+		}
+		return kindParagraph, true
+	}
+
+	if strings.ContainsRune("-*_+", rune(trimmed[0])) {
+		if len(trimmed) == 1 && !complete {
+			return kindUnknown, false
+		}
+		if trimmed[0] != '_' && len(trimmed) > 1 && trimmed[1] == ' ' {
+			return kindList, true
+		}
+		if strings.Trim(trimmed, string(trimmed[0])) == "" {
+			if !complete {
+				return kindUnknown, false
+			}
+			if len(trimmed) >= 3 && trimmed[0] != '+' {
+				return kindRule, true
+			}
+		}
+		return kindParagraph, true
+	}
+
+	if unicode.IsDigit(rune(trimmed[0])) {
+		if orderedListRe.MatchString(trimmed) {
+			return kindList, true
+		}
+		digits := strings.TrimLeft(trimmed, "0123456789")
+		if !complete && (digits == "" || digits == "." || digits == ")") {
+			return kindUnknown, false
+		}
+		return kindParagraph, true
+	}
+
+	return kindParagraph, true
+}
+
+// Write the start of a line and skip its markers.
+func (r *Renderer) startLine(line string) {
+	if r.kind != kindTable {
+		r.flushTable()
+	}
+
+	leading := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+	trimmed := line[len(leading):]
+	r.col = 0
+	r.indent = 0
+	r.contPrefix = ""
+	r.lineStyle = ""
+
+	switch r.kind {
+	case kindHeading:
+		marker := headingRe.FindString(trimmed)
+		r.consumed = len(leading) + len(marker)
+		r.lineStyle = styleHeading
+		fmt.Fprint(r.out, r.lineStyle)
+	case kindList:
+		marker := orderedListRe.FindString(trimmed)
+		bullet := marker
+		if marker == "" {
+			marker = trimmed[:2]
+			bullet = "• "
+		}
+		r.consumed = len(leading) + len(marker)
+		r.indent = len(leading) + utf8.RuneCountInString(bullet)
+		r.contPrefix = strings.Repeat(" ", r.indent)
+		fmt.Fprint(r.out, leading, bullet)
+		r.col = r.indent
+	case kindQuote:
+		r.consumed = len(leading) + 1
+		if strings.HasPrefix(trimmed, "> ") {
+			r.consumed++
+		}
+		r.contPrefix = styleDim + "│ " + styleReset
+		r.indent = 2
+		fmt.Fprint(r.out, r.contPrefix)
+		r.col = r.indent
+	case kindParagraph:
+		r.consumed = len(leading)
+	}
+}
+
+// Write complete words. When the line is not complete, the last word may still grow.
+func (r *Renderer) streamWords(line string, complete bool) {
+	text := line[r.consumed:]
+	if !complete {
+		cut := strings.LastIndexAny(text, " \t")
+		if cut == -1 {
+			return
+		}
+		text = text[:cut]
+		r.consumed += cut + 1
+	} else {
+		r.consumed = len(line)
+	}
+
+	for _, word := range strings.Fields(text) {
+		r.writeWord(word)
+	}
+}
+
+func (r *Renderer) writeWord(word string) {
+	styled, w := r.inline.render(word, r.lineStyle)
+
+	if r.col > r.indent && r.col+1+w > r.width {
+		fmt.Fprint(r.out, styleReset, "\n", r.contPrefix, r.inline.active(r.lineStyle))
+		r.col = r.indent
+	} else if r.col > r.indent {
+		fmt.Fprint(r.out, " ")
+		r.col++
+	}
+
+	fmt.Fprint(r.out, styled)
+	r.col += w
+}
+
+func (r *Renderer) endLine() {
+	r.resetLine()
+	fmt.Fprint(r.out, "\n")
+}
+
+func (r *Renderer) resetLine() {
+	if r.lineStyle != "" || r.inline.any() {
+		fmt.Fprint(r.out, styleReset)
+	}
+	r.kind = kindUnknown
+	r.consumed = 0
+	r.col = 0
+	r.inline = inlineState{}
+}
+
+// Render lines that are only written once they are complete.
+func (r *Renderer) renderBuffered(line string) {
+	switch r.kind {
+	case kindBlank:
+		fmt.Fprint(r.out, "\n")
+	case kindRule:
+		fmt.Fprint(r.out, styleDim, strings.Repeat("─", r.width), styleReset, "\n")
+	case kindFence:
+		if r.inCode {
+			r.inCode = false
+		} else {
+			r.inCode = true
+			r.fence, r.codeLang, _ = openFence(line)
+		}
+		fmt.Fprint(r.out, styleDim, line, styleReset, "\n")
+	case kindCode:
+		fmt.Fprint(r.out, highlight(line, r.codeLang), "\n")
+	case kindTable:
+		r.table = append(r.table, line)
+	}
+
+	r.kind = kindUnknown
+	r.consumed = 0
+}
+
+func (r *Renderer) flushTable() {
+	if len(r.table) == 0 {
+		return
+	}
+
+	rows := r.table
+	r.table = nil
+
+	cells := [][]string{}
+	widths := []int{}
+	for _, row := range rows {
+		if tableSepRe.MatchString(strings.TrimSpace(row)) {
+			cells = append(cells, nil)
+			continue
+		}
+
+		row = strings.TrimSpace(row)
+		row = strings.TrimPrefix(strings.TrimSuffix(row, "|"), "|")
+		parts := strings.Split(row, "|")
+		for i, p := range parts {
+			parts[i] = strings.TrimSpace(p)
+			_, w := (&inlineState{}).render(parts[i], "")
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = max(widths[i], w)
+		}
+		cells = append(cells, parts)
+	}
+
+	total := 1
+	for _, w := range widths {
+		total += w + 3
+	}
+
+	//Doesn't fit, write it as is.
+	if total > r.width {
+		for _, row := range rows {
+			fmt.Fprintln(r.out, row)
+		}
+		return
+	}
+
+	for i, row := range cells {
+		if row == nil {
+			parts := []string{}
+			for _, w := range widths {
+				parts = append(parts, strings.Repeat("─", w+2))
+			}
+			fmt.Fprint(r.out, styleDim, "├", strings.Join(parts, "┼"), "┤", styleReset, "\n")
+			continue
+		}
+
+		fmt.Fprint(r.out, styleDim, "│", styleReset)
+		for j, w := range widths {
+			cell := ""
+			if j < len(row) {
+				cell = row[j]
+			}
+			styled, cw := (&inlineState{}).render(cell, "")
+			if i == 0 && len(cells) > 1 && cells[1] == nil {
+				styled = styleBold + styled + styleReset
+			}
+			fmt.Fprint(r.out, " ", styled, strings.Repeat(" ", w-cw), " ", styleDim, "│", styleReset)
+		}
+		fmt.Fprint(r.out, "\n")
+	}
+}
+
+// Inline styles that are toggled by markers like ** and `
+type inlineState struct {
+	bold   bool
+	italic bool
+	code   bool
+}
+
+func (s inlineState) any() bool {
+	return s.bold || s.italic || s.code
+}
+
+// The escape codes for the active styles
+func (s inlineState) active(lineStyle string) string {
+	codes := lineStyle
+	if s.bold {
+		codes += styleBold
+	}
+	if s.italic {
+		codes += styleItalic
+	}
+	if s.code {
+		codes += styleCode
+	}
+	return codes
+}
+
+// Render a word, returns the styled word and its width on screen.
+func (s *inlineState) render(word string, lineStyle string) (string, int) {
+	sb := strings.Builder{}
+	width := 0
+	runes := []rune(word)
+
+	toggle := func() {
+		sb.WriteString(styleReset)
+		sb.WriteString(s.active(lineStyle))
+	}
+
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+
+		if c == '`' {
+			s.code = !s.code
+			toggle()
+			continue
+		}
+
+		if !s.code && (c == '*' || c == '_') {
+			double := i+1 < len(runes) && runes[i+1] == c
+			atStart := i == 0 || !isWordRune(runes[i-1])
+			end := i + 1
+			if double {
+				end++
+			}
+			atEnd := end >= len(runes) || !isWordRune(runes[end])
+
+			if atStart || atEnd {
+				if double {
+					s.bold = !s.bold
+					i++
+				} else {
+					s.italic = !s.italic
+				}
+				toggle()
+				continue
+			}
+		}
+
+		sb.WriteRune(c)
+		width++
+	}
+
+	return sb.String(), width
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,96 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var ansiRe = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+func render(text string, width int, chunkSize int) string {
+	sb := &strings.Builder{}
+	r := NewRenderer(sb, width)
+	for len(text) > 0 {
+		n := min(chunkSize, len(text))
+		r.Write([]byte(text[:n]))
+		text = text[n:]
+	}
+	r.Flush()
+	return sb.String()
+}
+
+func plain(text string) string {
+	return ansiRe.ReplaceAllString(text, "")
+}
+
+func TestRenderer(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"paragraph", "Hello there.\n", "Hello there.\n"},
+		{"no trailing newline", "Hello there.", "Hello there."},
+		{"heading", "## A title\nText\n", "A title\nText\n"},
+		{"bold and italic", "A **bold** and *it*.\n", "A bold and it.\n"},
+		{"snake case", "Call my_func now\n", "Call my_func now\n"},
+		{"inline code", "Run `go **test**` now\n", "Run go **test** now\n"},
+		{"bullets", "- one\n- two\n  - nested\n", "• one\n• two\n  • nested\n"},
+		{"numbered", "1. one\n2. two\n", "1. one\n2. two\n"},
+		{"quote", "> wise words\n", "│ wise words\n"},
+		{"rule", "---\n", strings.Repeat("─", 20) + "\n"},
+		{"code block", "```go\nfunc main() {}\n```\n", "```go\nfunc main() {}\n```\n"},
+		{"markers in code block", "```\n# not a heading\n- **x**\n```\n", "```\n# not a heading\n- **x**\n```\n"},
+		{"wrapping", "one two three four five six seven\n", "one two three four\nfive six seven\n"},
+		{"wrapping list", "- one two three four five six\n", "• one two three four\n  five six\n"},
+		{"table", "| a | bb |\n|---|---|\n| ccc | d |\nafter\n", "│ a   │ bb │\n├─────┼────┤\n│ ccc │ d  │\nafter\n"},
+		{"table at end", "| a | b |\n|---|---|\n| c | d |", "│ a │ b │\n├───┼───┤\n│ c │ d │\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, plain(render(tt.input, 20, len(tt.input))))
+		})
+	}
+}
+
+func TestRendererChunks(t *testing.T) {
+	text := "# Title\n\nSome **bold** and *italic* text that goes on for a while, long enough to wrap.\n\n" +
+		"- item one\n- item `two`\n\n1. first\n2. second\n\n> quoted\n\n" +
+		"```python\ndef f(x):\n    return \"x\" # comment\n```\n\n| a | b |\n|---|---|\n| 1 | 2 |\n\nDone"
+
+	want := render(text, 40, len(text))
+	for _, size := range []int{1, 2, 3, 7, 13} {
+		assert.Equal(t, want, render(text, 40, size), "chunk size %v", size)
+	}
+}
+
+func TestRendererStreamsWords(t *testing.T) {
+	sb := &strings.Builder{}
+	r := NewRenderer(sb, 80)
+
+	r.Write([]byte("Hello wor"))
+	assert.Equal(t, "Hello", plain(sb.String()))
+
+	r.Write([]byte("ld and"))
+	assert.Equal(t, "Hello world", plain(sb.String()))
+
+	r.Write([]byte("\n| a |"))
+	assert.Equal(t, "Hello world and\n", plain(sb.String()))
+
+	r.Flush()
+	assert.Equal(t, "Hello world and\n│ a │\n", plain(sb.String()))
+}
+
+func TestHighlight(t *testing.T) {
+	line := `x := "if" // if`
+	got := highlight(line, "go")
+	assert.Equal(t, line, plain(got))
+	assert.Contains(t, got, colorString+`"if"`)
+	assert.Contains(t, got, colorComment+"// if")
+
+	assert.Equal(t, line, highlight(line, "unknown"))
+}
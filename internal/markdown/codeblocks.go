@@ -0,0 +1,189 @@
+package markdown
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/c00/botman-v2/chatbot"
+)
+
+// Returns the fence and language if line opens a fenced code block.
+func openFence(line string) (fence string, lang string, ok bool) {
+	trimmed := strings.TrimLeft(line, " \t")
+	if !strings.HasPrefix(trimmed, "```") && !strings.HasPrefix(trimmed, "~~~") {
+		return "", "", false
+	}
+
+	fence = trimmed[:3]
+	info := strings.Fields(strings.TrimLeft(trimmed, fence[:1]))
+	if len(info) > 0 {
+		lang = info[0]
+	}
+	return fence, lang, true
+}
+
+func closesFence(line string, fence string) bool {
+	trimmed := strings.TrimSpace(line)
+	return strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == ""
+}
+
+// CodeBlocks returns the fenced code blocks in text. A block that is not closed runs to the end of text.
+func CodeBlocks(text string) []chatbot.CodeBlock {
+	blocks := []chatbot.CodeBlock{}
+	var current *chatbot.CodeBlock
+	lines := []string{}
+	fence := ""
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+
+		if current == nil {
+			f, lang, ok := openFence(line)
+			if ok {
+				current = &chatbot.CodeBlock{Lang: lang}
+				fence = f
+				lines = []string{}
+			}
+			continue
+		}
+
+		if closesFence(line, fence) {
+			current.Code = strings.Join(lines, "\n")
+			blocks = append(blocks, *current)
+			current = nil
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+
+	if current != nil {
+		current.Code = strings.TrimSuffix(strings.Join(lines, "\n"), "\n")
+		blocks = append(blocks, *current)
+	}
+
+	return blocks
+}
+
+// BlockFilter selects code blocks by language and position.
+type BlockFilter struct {
+	// Only blocks in this language. Empty for any language.
+	Lang string
+	// Position of the block among the blocks in Lang, starting at 1. 0 selects all of them.
+	Block int
+}
+
+func (f BlockFilter) matchesLang(lang string) bool {
+	return f.Lang == "" || strings.EqualFold(f.Lang, lang)
+}
+
+// Select the blocks that pass the filter.
+func (f BlockFilter) Select(blocks []chatbot.CodeBlock) []chatbot.CodeBlock {
+	selected := []chatbot.CodeBlock{}
+	n := 0
+	for _, b := range blocks {
+		if !f.matchesLang(b.Lang) {
+			continue
+		}
+		n++
+		if f.Block == 0 || f.Block == n {
+			selected = append(selected, b)
+		}
+	}
+	return selected
+}
+
+// FprintCodeBlocks writes the code of each block, separated by empty lines.
+func FprintCodeBlocks(w io.Writer, blocks []chatbot.CodeBlock) {
+	for i, b := range blocks {
+		if i > 0 {
+			fmt.Fprintln(w, "")
+		}
+		fmt.Fprintln(w, b.Code)
+	}
+}
+
+// NewCodeWriter creates a writer that passes only the code of blocks that match filter to out.
+func NewCodeWriter(out io.Writer, filter BlockFilter) *CodeWriter {
+	return &CodeWriter{
+		out:    out,
+		filter: filter,
+	}
+}
+
+// CodeWriter filters streamed Markdown down to the code of its fenced code blocks.
+// The output is the same as FprintCodeBlocks of the selected blocks, written line by line.
+type CodeWriter struct {
+	out    io.Writer
+	filter BlockFilter
+	buf    string
+
+	fence string
+	// Inside a block that is selected
+	printing bool
+	// Blocks in the filtered language so far
+	seen    int
+	printed int
+}
+
+// Write streamed Markdown. Always consumes all of p.
+func (w *CodeWriter) Write(p []byte) (int, error) {
+	w.buf += string(p)
+
+	for {
+		idx := strings.IndexByte(w.buf, '\n')
+		if idx == -1 {
+			break
+		}
+
+		line := w.buf[:idx]
+		w.buf = w.buf[idx+1:]
+		w.line(strings.TrimSuffix(line, "\r"))
+	}
+
+	return len(p), nil
+}
+
+// Flush handles the last line of a response and resets the writer for the next one.
+func (w *CodeWriter) Flush() {
+	if w.buf != "" {
+		w.line(w.buf)
+		w.buf = ""
+	}
+
+	*w = CodeWriter{out: w.out, filter: w.filter}
+}
+
+func (w *CodeWriter) line(line string) {
+	if w.fence == "" {
+		fence, lang, ok := openFence(line)
+		if !ok {
+			return
+		}
+
+		w.fence = fence
+		if !w.filter.matchesLang(lang) {
+			return
+		}
+		w.seen++
+		w.printing = w.filter.Block == 0 || w.filter.Block == w.seen
+		if w.printing && w.printed > 0 {
+			fmt.Fprintln(w.out, "")
+		}
+		return
+	}
+
+	if closesFence(line, w.fence) {
+		if w.printing {
+			w.printed++
+		}
+		w.fence = ""
+		w.printing = false
+		return
+	}
+
+	if w.printing {
+		fmt.Fprintln(w.out, line)
+	}
+}
@@ -0,0 +1,71 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/c00/botman-v2/chatbot"
+	"github.com/stretchr/testify/assert"
+)
+
+const codeText = "Here you go:\n\n```go\npackage main\n\nfunc main() {}\n```\n\nRun it with:\n\n```bash\ngo run .\n```\n\nOr test:\n~~~go title=test\ngo test\n~~~\n"
+
+func TestCodeBlocks(t *testing.T) {
+	assert.Equal(t, []chatbot.CodeBlock{
+		{Lang: "go", Code: "package main\n\nfunc main() {}"},
+		{Lang: "bash", Code: "go run ."},
+		{Lang: "go", Code: "go test"},
+	}, CodeBlocks(codeText))
+
+	assert.Equal(t, []chatbot.CodeBlock{}, CodeBlocks("no code here"))
+	assert.Equal(t, []chatbot.CodeBlock{{Code: "unclosed"}}, CodeBlocks("```\nunclosed\n"))
+}
+
+func TestBlockFilter(t *testing.T) {
+	blocks := CodeBlocks(codeText)
+
+	tests := []struct {
+		name   string
+		filter BlockFilter
+		want   []string
+	}{
+		{"all", BlockFilter{}, []string{"package main\n\nfunc main() {}", "go run .", "go test"}},
+		{"block", BlockFilter{Block: 2}, []string{"go run ."}},
+		{"lang", BlockFilter{Lang: "Go"}, []string{"package main\n\nfunc main() {}", "go test"}},
+		{"lang and block", BlockFilter{Lang: "go", Block: 2}, []string{"go test"}},
+		{"out of range", BlockFilter{Block: 4}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, b := range tt.filter.Select(blocks) {
+				got = append(got, b.Code)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCodeWriter(t *testing.T) {
+	filters := []BlockFilter{{}, {Block: 2}, {Lang: "go"}, {Lang: "go", Block: 2}, {Lang: "rust"}}
+
+	for _, filter := range filters {
+		want := &strings.Builder{}
+		FprintCodeBlocks(want, filter.Select(CodeBlocks(codeText)))
+
+		for _, size := range []int{1, 5, len(codeText)} {
+			got := &strings.Builder{}
+			w := NewCodeWriter(got, filter)
+			text := codeText
+			for len(text) > 0 {
+				n := min(size, len(text))
+				w.Write([]byte(text[:n]))
+				text = text[n:]
+			}
+			w.Flush()
+
+			assert.Equal(t, want.String(), got.String(), "filter %+v, chunk size %v", filter, size)
+		}
+	}
+}
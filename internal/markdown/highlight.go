@@ -0,0 +1,153 @@
+package markdown
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+const (
+	colorKeyword = "\x1b[35m"
+	colorString  = "\x1b[32m"
+	colorComment = "\x1b[90m"
+	colorNumber  = "\x1b[33m"
+)
+
+type language struct {
+	keywords []string
+	comments []string
+}
+
+var languages = map[string]language{
+	"go": {
+		keywords: []string{"break", "case", "chan", "const", "continue", "default", "defer", "else", "fallthrough", "for", "func", "go", "goto", "if", "import", "interface", "map", "package", "range", "return", "select", "struct", "switch", "type", "var", "nil", "true", "false"},
+		comments: []string{"//"},
+	},
+	"python": {
+		keywords: []string{"and", "as", "assert", "async", "await", "break", "class", "continue", "def", "del", "elif", "else", "except", "finally", "for", "from", "global", "if", "import", "in", "is", "lambda", "not", "or", "pass", "raise", "return", "try", "while", "with", "yield", "None", "True", "False"},
+		comments: []string{"#"},
+	},
+	"javascript": {
+		keywords: []string{"async", "await", "break", "case", "catch", "class", "const", "continue", "default", "delete", "else", "export", "extends", "finally", "for", "function", "if", "import", "in", "instanceof", "let", "new", "of", "return", "switch", "this", "throw", "try", "typeof", "var", "while", "null", "undefined", "true", "false", "interface", "type"},
+		comments: []string{"//"},
+	},
+	"rust": {
+		keywords: []string{"as", "async", "await", "break", "const", "continue", "else", "enum", "fn", "for", "if", "impl", "in", "let", "loop", "match", "mod", "move", "mut", "pub", "ref", "return", "self", "Self", "struct", "trait", "type", "use", "where", "while", "true", "false"},
+		comments: []string{"//"},
+	},
+	"shell": {
+		keywords: []string{"if", "then", "else", "elif", "fi", "for", "while", "do", "done", "case", "esac", "in", "function", "return", "export", "local"},
+		comments: []string{"#"},
+	},
+	"sql": {
+		keywords: []string{"SELECT", "FROM", "WHERE", "INSERT", "INTO", "VALUES", "UPDATE", "SET", "DELETE", "CREATE", "TABLE", "DROP", "ALTER", "JOIN", "LEFT", "RIGHT", "INNER", "ON", "AND", "OR", "NOT", "NULL", "ORDER", "GROUP", "BY", "LIMIT", "AS", "select", "from", "where", "insert", "into", "values", "update", "set", "delete", "create", "table", "join", "on", "and", "or", "not", "null", "order", "group", "by", "limit", "as"},
+		comments: []string{"--"},
+	},
+	"yaml": {
+		keywords: []string{"true", "false", "null"},
+		comments: []string{"#"},
+	},
+}
+
+var languageAliases = map[string]string{
+	"golang":     "go",
+	"py":         "python",
+	"js":         "javascript",
+	"ts":         "javascript",
+	"typescript": "javascript",
+	"jsx":        "javascript",
+	"tsx":        "javascript",
+	"java":       "javascript",
+	"c":          "javascript",
+	"cpp":        "javascript",
+	"csharp":     "javascript",
+	"rs":         "rust",
+	"sh":         "shell",
+	"bash":       "shell",
+	"zsh":        "shell",
+	"console":    "shell",
+	"yml":        "yaml",
+}
+
+func lookupLanguage(name string) (language, bool) {
+	name = strings.ToLower(name)
+	if alias, ok := languageAliases[name]; ok {
+		name = alias
+	}
+	lang, ok := languages[name]
+	return lang, ok
+}
+
+// Highlight a single line of code. Lines of unknown languages are returned as they are.
+func highlight(line string, langName string) string {
+	lang, ok := lookupLanguage(langName)
+	if !ok {
+		return line
+	}
+
+	sb := strings.Builder{}
+	runes := []rune(line)
+
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		rest := string(runes[i:])
+
+		if isComment(rest, lang) {
+			sb.WriteString(colorComment + rest + styleReset)
+			break
+		}
+
+		if c == '"' || c == '\'' || c == '`' {
+			end := i + 1
+			for end < len(runes) && runes[end] != c {
+				if runes[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end = min(end+1, len(runes))
+			sb.WriteString(colorString + string(runes[i:end]) + styleReset)
+			i = end
+			continue
+		}
+
+		if unicode.IsLetter(c) || c == '_' {
+			end := i
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || runes[end] == '_') {
+				end++
+			}
+			word := string(runes[i:end])
+			if slices.Contains(lang.keywords, word) {
+				sb.WriteString(colorKeyword + word + styleReset)
+			} else {
+				sb.WriteString(word)
+			}
+			i = end
+			continue
+		}
+
+		if unicode.IsDigit(c) {
+			end := i
+			for end < len(runes) && (unicode.IsDigit(runes[end]) || runes[end] == '.' || runes[end] == 'x' || runes[end] == '_') {
+				end++
+			}
+			sb.WriteString(colorNumber + string(runes[i:end]) + styleReset)
+			i = end
+			continue
+		}
+
+		sb.WriteRune(c)
+		i++
+	}
+
+	return sb.String()
+}
+
+func isComment(text string, lang language) bool {
+	for _, c := range lang.comments {
+		if strings.HasPrefix(text, c) {
+			return true
+		}
+	}
+	return false
+}
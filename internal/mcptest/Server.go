@@ -0,0 +1,271 @@
+// Package mcptest is a small MCP server to test the MCP client against.
+package mcptest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// The server pages its tools by this many, to test the cursor.
+const pageSize = 2
+
+type message struct {
+	JsonRpc string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type tool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
+var tools = []tool{
+	{Name: "echo", Description: "Returns the text", InputSchema: map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"text": map[string]any{"type": "string", "description": "The text to return"}},
+		"required":   []string{"text"},
+	}},
+	{Name: "add", Description: "Adds a and b", InputSchema: map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"a": map[string]any{"type": "number"},
+			"b": map[string]any{"type": "number"},
+		},
+	}},
+	{Name: "fail", Description: "Always fails", InputSchema: map[string]any{"type": "object"}},
+	{Name: "slow", Description: "Runs until it is cancelled", InputSchema: map[string]any{"type": "object"}},
+	{Name: "bad.name", Description: "A name providers do not take", InputSchema: map[string]any{"type": "object"}},
+}
+
+// Server offers the tools echo, add, fail, slow and bad.name.
+type Server struct {
+	mu       sync.Mutex
+	inflight map[string]context.CancelFunc
+	calls    []string
+	closed   bool
+}
+
+func New() *Server {
+	return &Server{inflight: map[string]context.CancelFunc{}}
+}
+
+// ServeStdio serves newline delimited messages until in ends.
+func (s *Server) ServeStdio(in io.Reader, out io.Writer) error {
+	writeMu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+
+	reader := bufio.NewReader(in)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if strings.TrimSpace(string(line)) != "" {
+			msg := message{}
+			if jsonErr := json.Unmarshal(line, &msg); jsonErr != nil {
+				return jsonErr
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				response, ok := s.handle(context.Background(), msg)
+				if !ok {
+					return
+				}
+				data, _ := json.Marshal(response)
+				writeMu.Lock()
+				defer writeMu.Unlock()
+				out.Write(append(data, '\n'))
+			}()
+		}
+
+		if err == io.EOF {
+			wg.Wait()
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// Handler serves streamable HTTP. Tool calls are answered with server sent events, other requests with JSON.
+func (s *Server) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			s.mu.Lock()
+			s.closed = true
+			s.mu.Unlock()
+			return
+		}
+
+		msg := message{}
+		err := json.NewDecoder(r.Body).Decode(&msg)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if msg.Method == "initialize" {
+			w.Header().Set("Mcp-Session-Id", "test-session")
+		} else if r.Header.Get("Mcp-Session-Id") != "test-session" {
+			http.Error(w, "missing session", http.StatusBadRequest)
+			return
+		}
+
+		response, ok := s.handle(r.Context(), msg)
+		if !ok {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+
+		data, _ := json.Marshal(response)
+		if msg.Method != "tools/call" {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(data)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/progress\"}\n\n")
+		fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+	})
+}
+
+// Handle a message, returns false for messages that get no response.
+func (s *Server) handle(ctx context.Context, msg message) (message, bool) {
+	if len(msg.ID) == 0 {
+		if msg.Method == "notifications/cancelled" {
+			s.cancel(msg)
+		}
+		return message{}, false
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s.mu.Lock()
+	s.inflight[string(msg.ID)] = cancel
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.inflight, string(msg.ID))
+		s.mu.Unlock()
+	}()
+
+	result, err := s.result(ctx, msg)
+	if err != nil {
+		return message{JsonRpc: "2.0", ID: msg.ID, Error: err}, true
+	}
+	return message{JsonRpc: "2.0", ID: msg.ID, Result: result}, true
+}
+
+func (s *Server) result(ctx context.Context, msg message) (any, *rpcError) {
+	switch msg.Method {
+	case "initialize":
+		return map[string]any{
+			"protocolVersion": "2025-06-18",
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": "mcptest", "version": "1.0.0"},
+		}, nil
+	case "ping":
+		return map[string]any{}, nil
+	case "tools/list":
+		params := struct {
+			Cursor string `json:"cursor"`
+		}{}
+		json.Unmarshal(msg.Params, &params)
+
+		start := 0
+		fmt.Sscan(params.Cursor, &start)
+		end := min(start+pageSize, len(tools))
+		result := map[string]any{"tools": tools[start:end]}
+		if end < len(tools) {
+			result["nextCursor"] = fmt.Sprint(end)
+		}
+		return result, nil
+	case "tools/call":
+		return s.call(ctx, msg)
+	}
+
+	return nil, &rpcError{Code: -32601, Message: "method not found"}
+}
+
+func (s *Server) call(ctx context.Context, msg message) (any, *rpcError) {
+	params := struct {
+		Name      string         `json:"name"`
+		Arguments map[string]any `json:"arguments"`
+	}{}
+	err := json.Unmarshal(msg.Params, &params)
+	if err != nil {
+		return nil, &rpcError{Code: -32602, Message: err.Error()}
+	}
+
+	s.mu.Lock()
+	s.calls = append(s.calls, params.Name)
+	s.mu.Unlock()
+
+	text := func(t string) []any {
+		return []any{map[string]any{"type": "text", "text": t}}
+	}
+
+	switch params.Name {
+	case "echo":
+		return map[string]any{"content": text(fmt.Sprint(params.Arguments["text"]))}, nil
+	case "add":
+		a, _ := params.Arguments["a"].(float64)
+		b, _ := params.Arguments["b"].(float64)
+		return map[string]any{
+			"content":           text(fmt.Sprint(a + b)),
+			"structuredContent": map[string]any{"sum": a + b},
+		}, nil
+	case "fail":
+		return map[string]any{"content": text("it failed"), "isError": true}, nil
+	case "slow":
+		<-ctx.Done()
+		return nil, &rpcError{Code: -32603, Message: "cancelled"}
+	}
+
+	return nil, &rpcError{Code: -32602, Message: fmt.Sprintf("unknown tool %v", params.Name)}
+}
+
+func (s *Server) cancel(msg message) {
+	params := struct {
+		RequestID json.RawMessage `json:"requestId"`
+	}{}
+	json.Unmarshal(msg.Params, &params)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cancel, ok := s.inflight[string(params.RequestID)]; ok {
+		cancel()
+	}
+}
+
+// Calls returns the tools that were called, in order.
+func (s *Server) Calls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.calls)
+}
+
+// Closed returns whether the client ended its HTTP session.
+func (s *Server) Closed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
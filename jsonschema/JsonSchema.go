@@ -1,5 +1,23 @@
 package jsonschema
 
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	TypeObject  = "object"
+	TypeArray   = "array"
+	TypeString  = "string"
+	TypeNumber  = "number"
+	TypeInteger = "integer"
+	TypeBoolean = "boolean"
+	TypeNull    = "null"
+)
+
 func New() JsonSchema {
 	return JsonSchema{
 		Type:       "object",
@@ -7,89 +25,232 @@ func New() JsonSchema {
 	}
 }
 
+// Bool returns the schema true, that allows anything, or false, that allows nothing.
+// Mostly used as AdditionalProperties.
+func Bool(allow bool) *JsonSchema {
+	return &JsonSchema{Boolean: &allow}
+}
+
+// JsonSchema is the subset of JSON Schema that the tool APIs of LLM providers accept.
 type JsonSchema struct {
-	Type        string                 `json:"type"`
-	Description string                 `json:"description,omitempty"`
-	Properties  map[string]*JsonSchema `json:"properties,omitempty"`
-	Required    []string               `json:"required,omitempty"`
+	Type string `json:"type,omitempty" yaml:"type,omitempty"`
+	// Also allow null. Written as a type like ["string", "null"].
+	Nullable    bool   `json:"-" yaml:"-"`
+	Title       string `json:"title,omitempty" yaml:"title,omitempty"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	Default     any    `json:"default,omitempty" yaml:"default,omitempty"`
+	Enum        []any  `json:"enum,omitempty" yaml:"enum,omitempty"`
+	Const       any    `json:"const,omitempty" yaml:"const,omitempty"`
+
+	//Objects
+	Properties           map[string]*JsonSchema `json:"properties,omitempty" yaml:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty" yaml:"required,omitempty"`
+	AdditionalProperties *JsonSchema            `json:"additionalProperties,omitempty" yaml:"additionalProperties,omitempty"`
+
+	//Arrays
+	Items       *JsonSchema `json:"items,omitempty" yaml:"items,omitempty"`
+	MinItems    *int        `json:"minItems,omitempty" yaml:"minItems,omitempty"`
+	MaxItems    *int        `json:"maxItems,omitempty" yaml:"maxItems,omitempty"`
+	UniqueItems bool        `json:"uniqueItems,omitempty" yaml:"uniqueItems,omitempty"`
+
+	//Strings
+	MinLength *int   `json:"minLength,omitempty" yaml:"minLength,omitempty"`
+	MaxLength *int   `json:"maxLength,omitempty" yaml:"maxLength,omitempty"`
+	Pattern   string `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+	// Such as date-time, date, email, uri or uuid
+	Format string `json:"format,omitempty" yaml:"format,omitempty"`
+
+	//Numbers and integers
+	Minimum          *float64 `json:"minimum,omitempty" yaml:"minimum,omitempty"`
+	Maximum          *float64 `json:"maximum,omitempty" yaml:"maximum,omitempty"`
+	ExclusiveMinimum *float64 `json:"exclusiveMinimum,omitempty" yaml:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum *float64 `json:"exclusiveMaximum,omitempty" yaml:"exclusiveMaximum,omitempty"`
+	MultipleOf       *float64 `json:"multipleOf,omitempty" yaml:"multipleOf,omitempty"`
+
+	//Combining schemas
+	AnyOf []*JsonSchema `json:"anyOf,omitempty" yaml:"anyOf,omitempty"`
+	OneOf []*JsonSchema `json:"oneOf,omitempty" yaml:"oneOf,omitempty"`
+	AllOf []*JsonSchema `json:"allOf,omitempty" yaml:"allOf,omitempty"`
+
+	// A reference like #/$defs/Name, to a schema in Defs of the root schema
+	Ref  string                 `json:"$ref,omitempty" yaml:"$ref,omitempty"`
+	Defs map[string]*JsonSchema `json:"$defs,omitempty" yaml:"$defs,omitempty"`
+
+	// Set for the schemas true and false, other fields are not used then
+	Boolean *bool `json:"-" yaml:"-"`
 }
 
 func (j *JsonSchema) AddString(name string, description string, required bool) {
-	if j.Type != "object" {
-		j.Type = "object"
-	}
+	j.add(name, &JsonSchema{Type: TypeString, Description: description}, required)
+}
 
-	if j.Properties == nil {
-		j.Properties = map[string]*JsonSchema{}
+func (j *JsonSchema) AddNumber(name string, description string, required bool) {
+	j.add(name, &JsonSchema{Type: TypeNumber, Description: description}, required)
+}
+
+func (j *JsonSchema) AddInteger(name string, description string, required bool) {
+	j.add(name, &JsonSchema{Type: TypeInteger, Description: description}, required)
+}
+
+func (j *JsonSchema) AddBoolean(name string, description string, required bool) {
+	j.add(name, &JsonSchema{Type: TypeBoolean, Description: description}, required)
+}
+
+// AddEnum adds a string that is one of values.
+func (j *JsonSchema) AddEnum(name string, description string, values []string, required bool) {
+	enum := []any{}
+	for _, v := range values {
+		enum = append(enum, v)
 	}
+	j.add(name, &JsonSchema{Type: TypeString, Description: description, Enum: enum}, required)
+}
 
-	j.Properties[name] = &JsonSchema{
-		Type:        "string",
+// AddArray adds an array of items, and returns its schema.
+func (j *JsonSchema) AddArray(name string, description string, items JsonSchema, required bool) *JsonSchema {
+	schema := &JsonSchema{Type: TypeArray, Description: description, Items: &items}
+	j.add(name, schema, required)
+	return schema
+}
+
+func (j *JsonSchema) AddObject(name string, description string, required bool) *JsonSchema {
+	schema := &JsonSchema{
+		Type:        TypeObject,
 		Description: description,
+		Properties:  map[string]*JsonSchema{},
 	}
-	if required {
-		j.Required = append(j.Required, name)
-	}
+	j.add(name, schema, required)
+	return schema
 }
 
-func (j *JsonSchema) AddNumber(name string, description string, required bool) {
-	if j.Type != "object" {
-		j.Type = "object"
+// AddProperty adds a property with any schema.
+func (j *JsonSchema) AddProperty(name string, schema JsonSchema, required bool) {
+	j.add(name, &schema, required)
+}
+
+func (j *JsonSchema) add(name string, schema *JsonSchema, required bool) {
+	if j.Type != TypeObject {
+		j.Type = TypeObject
 	}
 
 	if j.Properties == nil {
 		j.Properties = map[string]*JsonSchema{}
 	}
 
-	j.Properties[name] = &JsonSchema{
-		Type:        "number",
-		Description: description,
-	}
+	j.Properties[name] = schema
 	if required {
 		j.Required = append(j.Required, name)
 	}
 }
 
-func (j *JsonSchema) AddObject(name string, description string, required bool) *JsonSchema {
-	if j.Type != "object" {
-		j.Type = "object"
+// Resolve returns the schema a reference points to, in the $defs of root.
+func (j JsonSchema) Resolve(root JsonSchema) (JsonSchema, error) {
+	if j.Ref == "" {
+		return j, nil
 	}
 
-	if j.Properties == nil {
-		j.Properties = map[string]*JsonSchema{}
+	if j.Ref == "#" {
+		return root, nil
 	}
 
-	schema := &JsonSchema{
-		Type:        "object",
-		Description: description,
-		Properties:  map[string]*JsonSchema{},
+	name, ok := strings.CutPrefix(j.Ref, "#/$defs/")
+	if !ok {
+		return JsonSchema{}, fmt.Errorf("unsupported reference %v", j.Ref)
 	}
 
-	if required {
-		j.Required = append(j.Required, name)
+	def, ok := root.Defs[name]
+	if !ok || def == nil {
+		return JsonSchema{}, fmt.Errorf("unknown reference %v", j.Ref)
 	}
 
-	j.Properties[name] = schema
+	return *def, nil
+}
 
-	return schema
+func (j JsonSchema) MarshalJSON() ([]byte, error) {
+	if j.Boolean != nil {
+		return json.Marshal(*j.Boolean)
+	}
+
+	type plain JsonSchema
+	if !j.Nullable || j.Type == "" {
+		return json.Marshal(plain(j))
+	}
+
+	return json.Marshal(struct {
+		Type []string `json:"type"`
+		plain
+	}{
+		Type:  []string{j.Type, TypeNull},
+		plain: plain(j),
+	})
 }
 
-func (j JsonSchema) Generate() any {
-	switch j.Type {
-	case "string":
-		return "foo"
-	case "number":
-		return float64(10)
-	case "":
-		fallthrough
-	case "object":
-		//recurse
-		result := map[string]any{}
-		for name, prop := range j.Properties {
-			result[name] = prop.Generate()
+func (j *JsonSchema) UnmarshalJSON(data []byte) error {
+	*j = JsonSchema{}
+
+	var allow bool
+	if json.Unmarshal(data, &allow) == nil {
+		j.Boolean = &allow
+		return nil
+	}
+
+	type plain JsonSchema
+	raw := struct {
+		Type any `json:"type"`
+		*plain
+	}{plain: (*plain)(j)}
+
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+
+	switch t := raw.Type.(type) {
+	case nil:
+	case string:
+		j.Type = t
+	case []any:
+		//Types like ["string", "null"]
+		for _, v := range t {
+			s, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("invalid type %v", v)
+			}
+			if s == TypeNull && len(t) > 1 {
+				j.Nullable = true
+			} else if j.Type == "" {
+				j.Type = s
+			}
 		}
-		return result
 	default:
-		return nil
+		return fmt.Errorf("invalid type %v", t)
+	}
+
+	return nil
+}
+
+// YAML goes through JSON, so both read and write the same schemas.
+func (j JsonSchema) MarshalYAML() (any, error) {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return nil, err
 	}
+
+	var v any
+	err = json.Unmarshal(data, &v)
+	return v, err
+}
+
+func (j *JsonSchema) UnmarshalYAML(value *yaml.Node) error {
+	var v any
+	err := value.Decode(&v)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("invalid schema: %w", err)
+	}
+
+	return json.Unmarshal(data, j)
 }
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
 )
 
 func TestSchema(t *testing.T) {
@@ -70,3 +71,196 @@ const expectedSchema = `{
   "name"
  ]
 }`
+
+const fullSchema = `{
+ "type": "object",
+ "properties": {
+  "id": {
+   "type": "string",
+   "format": "uuid"
+  },
+  "note": {
+   "type": [
+    "string",
+    "null"
+   ],
+   "maxLength": 2
+  },
+  "size": {
+   "type": "string",
+   "enum": [
+    "small",
+    "large"
+   ]
+  },
+  "count": {
+   "type": "integer",
+   "default": 3,
+   "minimum": 1,
+   "maximum": 5
+  },
+  "ratio": {
+   "type": "number",
+   "exclusiveMinimum": 20,
+   "multipleOf": 3
+  },
+  "enabled": {
+   "type": "boolean"
+  },
+  "tags": {
+   "type": "array",
+   "items": {
+    "type": "string"
+   },
+   "minItems": 2,
+   "uniqueItems": true
+  },
+  "owner": {
+   "$ref": "#/$defs/person"
+  },
+  "either": {
+   "anyOf": [
+    {
+     "type": "integer",
+     "maximum": 0
+    },
+    {
+     "type": "string"
+    }
+   ]
+  }
+ },
+ "required": [
+  "id"
+ ],
+ "additionalProperties": false,
+ "$defs": {
+  "person": {
+   "type": "object",
+   "properties": {
+    "name": {
+     "type": "string",
+     "minLength": 5
+    },
+    "manager": {
+     "$ref": "#/$defs/person"
+    }
+   },
+   "required": [
+    "name"
+   ]
+  }
+ }
+}`
+
+func TestUnmarshal(t *testing.T) {
+	schema := JsonSchema{}
+	err := json.Unmarshal([]byte(fullSchema), &schema)
+	assert.Nil(t, err)
+
+	assert.Equal(t, TypeString, schema.Properties["note"].Type)
+	assert.True(t, schema.Properties["note"].Nullable)
+	assert.False(t, *schema.AdditionalProperties.Boolean)
+	assert.Equal(t, 2, *schema.Properties["tags"].MinItems)
+	assert.Equal(t, "#/$defs/person", schema.Properties["owner"].Ref)
+
+	owner, err := schema.Properties["owner"].Resolve(schema)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"name"}, owner.Required)
+
+	_, err = JsonSchema{Ref: "#/$defs/nobody"}.Resolve(schema)
+	assert.NotNil(t, err)
+
+	//Writes the same schema again, apart from the order of properties
+	data, err := json.Marshal(schema)
+	assert.Nil(t, err)
+	assert.JSONEq(t, fullSchema, string(data))
+}
+
+func TestUnmarshalYAML(t *testing.T) {
+	schema := JsonSchema{}
+	err := yaml.Unmarshal([]byte(`
+type: object
+properties:
+  size:
+    type: string
+    enum: [small, large]
+  tags:
+    type: array
+    items: {type: string}
+    maxItems: 3
+additionalProperties: false
+`), &schema)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []any{"small", "large"}, schema.Properties["size"].Enum)
+	assert.Equal(t, 3, *schema.Properties["tags"].MaxItems)
+	assert.Equal(t, TypeString, schema.Properties["tags"].Items.Type)
+	assert.False(t, *schema.AdditionalProperties.Boolean)
+
+	data, err := yaml.Marshal(schema)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), "additionalProperties: false")
+}
+
+func TestGenerate_AllTypes(t *testing.T) {
+	schema := JsonSchema{}
+	err := json.Unmarshal([]byte(fullSchema), &schema)
+	assert.Nil(t, err)
+
+	got := schema.Generate().(map[string]any)
+
+	assert.Equal(t, "00000000-0000-4000-8000-000000000000", got["id"])
+	assert.Equal(t, "oo", got["note"])
+	assert.Equal(t, "small", got["size"])
+	assert.Equal(t, float64(3), got["count"])
+	assert.Equal(t, float64(21), got["ratio"])
+	assert.Equal(t, true, got["enabled"])
+	assert.Equal(t, []any{"foo", "foo1"}, got["tags"])
+	assert.Equal(t, float64(0), got["either"])
+
+	//Recursive references stop
+	owner := got["owner"].(map[string]any)
+	assert.Equal(t, "foooo", owner["name"])
+	assert.Contains(t, owner, "manager")
+}
+
+func TestGenerate_Numbers(t *testing.T) {
+	ptr := func(f float64) *float64 { return &f }
+
+	tests := []struct {
+		name   string
+		schema JsonSchema
+		want   any
+	}{
+		{name: "number", schema: JsonSchema{Type: TypeNumber}, want: float64(10)},
+		{name: "below maximum", schema: JsonSchema{Type: TypeNumber, Maximum: ptr(2.5)}, want: 2.5},
+		{name: "exclusive maximum", schema: JsonSchema{Type: TypeInteger, ExclusiveMaximum: ptr(3)}, want: float64(2)},
+		{name: "above minimum", schema: JsonSchema{Type: TypeInteger, Minimum: ptr(100)}, want: float64(100)},
+		{name: "multiple of", schema: JsonSchema{Type: TypeNumber, MultipleOf: ptr(4)}, want: float64(12)},
+		{name: "const", schema: JsonSchema{Type: TypeNumber, Const: 7}, want: 7},
+		{name: "null", schema: JsonSchema{Type: TypeNull}, want: nil},
+		{name: "false", schema: *Bool(false), want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.schema.Generate())
+		})
+	}
+}
+
+func TestAddHelpers(t *testing.T) {
+	schema := New()
+	schema.AddInteger("count", "How many", true)
+	schema.AddBoolean("dry_run", "Only pretend", false)
+	schema.AddEnum("size", "The size", []string{"small", "large"}, true)
+	schema.AddArray("tags", "Tags", JsonSchema{Type: TypeString}, false)
+
+	assert.Equal(t, []string{"count", "size"}, schema.Required)
+	assert.Equal(t, map[string]any{
+		"count":   float64(10),
+		"dry_run": true,
+		"size":    "small",
+		"tags":    []any{"foo"},
+	}, schema.Generate())
+}
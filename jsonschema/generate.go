@@ -0,0 +1,211 @@
+package jsonschema
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+)
+
+// Deeper than this, only required properties are generated.
+const maxGenerateDepth = 8
+
+// Deeper than this, references are not followed. Only schemas that require themselves get this deep.
+const maxRefDepth = maxGenerateDepth * 4
+
+// Sample strings for formats
+var formatSamples = map[string]string{
+	"date-time": "2024-01-01T12:00:00Z",
+	"date":      "2024-01-01",
+	"time":      "12:00:00Z",
+	"duration":  "P1D",
+	"email":     "foo@example.com",
+	"hostname":  "example.com",
+	"ipv4":      "127.0.0.1",
+	"ipv6":      "::1",
+	"uri":       "https://example.com",
+	"url":       "https://example.com",
+	"uuid":      "00000000-0000-4000-8000-000000000000",
+}
+
+// Generate returns sample data that is valid for the schema, such as fake tool call params.
+// Patterns are not taken into account.
+func (j JsonSchema) Generate() any {
+	return j.generate(j, 0, 0)
+}
+
+// Generate the sample for root, or a variant of it. Variants differ from each other, for unique items.
+func (j JsonSchema) generate(root JsonSchema, depth int, variant int) any {
+	if j.Boolean != nil {
+		if *j.Boolean {
+			return "foo"
+		}
+		return nil
+	}
+
+	if j.Ref != "" {
+		if depth > maxRefDepth {
+			return nil
+		}
+		resolved, err := j.Resolve(root)
+		if err != nil {
+			return nil
+		}
+		return resolved.generate(root, depth+1, variant)
+	}
+
+	if j.Const != nil {
+		return j.Const
+	}
+	if j.Default != nil && variant == 0 {
+		return j.Default
+	}
+	if len(j.Enum) > 0 {
+		return j.Enum[variant%len(j.Enum)]
+	}
+
+	if len(j.AnyOf) > 0 {
+		return j.AnyOf[0].generate(root, depth+1, variant)
+	}
+	if len(j.OneOf) > 0 {
+		return j.OneOf[0].generate(root, depth+1, variant)
+	}
+	if len(j.AllOf) > 0 {
+		return j.generateAllOf(root, depth, variant)
+	}
+
+	switch j.Type {
+	case TypeString:
+		return j.generateString(variant)
+	case TypeNumber:
+		return j.generateNumber(variant, false)
+	case TypeInteger:
+		return j.generateNumber(variant, true)
+	case TypeBoolean:
+		return variant%2 == 0
+	case TypeNull:
+		return nil
+	case TypeArray:
+		return j.generateArray(root, depth)
+	case "":
+		if j.Items != nil {
+			return j.generateArray(root, depth)
+		}
+		fallthrough
+	case TypeObject:
+		//recurse
+		result := map[string]any{}
+		for name, prop := range j.Properties {
+			if depth > maxGenerateDepth && !slices.Contains(j.Required, name) {
+				continue
+			}
+			result[name] = prop.generate(root, depth+1, variant)
+		}
+		return result
+	default:
+		return nil
+	}
+}
+
+// The properties of all schemas together.
+func (j JsonSchema) generateAllOf(root JsonSchema, depth int, variant int) any {
+	result := map[string]any{}
+	for _, schema := range j.AllOf {
+		value, ok := schema.generate(root, depth+1, variant).(map[string]any)
+		if !ok {
+			return schema.generate(root, depth+1, variant)
+		}
+		maps.Copy(result, value)
+	}
+	return result
+}
+
+func (j JsonSchema) generateString(variant int) string {
+	if sample, ok := formatSamples[j.Format]; ok && variant == 0 {
+		return sample
+	}
+
+	s := "foo"
+	if variant > 0 {
+		s = fmt.Sprintf("foo%v", variant)
+	}
+
+	if j.MinLength != nil && len(s) < *j.MinLength {
+		s += strings.Repeat("o", *j.MinLength-len(s))
+	}
+	if j.MaxLength != nil && len(s) > *j.MaxLength {
+		//Keep the end, where variants differ
+		s = s[len(s)-*j.MaxLength:]
+	}
+
+	return s
+}
+
+func (j JsonSchema) generateNumber(variant int, integer bool) float64 {
+	low := math.Inf(-1)
+	high := math.Inf(1)
+	step := 1.0
+	if !integer {
+		step = 0.5
+	}
+
+	if j.Minimum != nil {
+		low = *j.Minimum
+	}
+	if j.ExclusiveMinimum != nil {
+		low = math.Max(low, *j.ExclusiveMinimum+step)
+	}
+	if j.Maximum != nil {
+		high = *j.Maximum
+	}
+	if j.ExclusiveMaximum != nil {
+		high = math.Min(high, *j.ExclusiveMaximum-step)
+	}
+
+	n := 10 + float64(variant)
+	if n < low {
+		n = low + float64(variant)
+	}
+	if n > high {
+		n = high - float64(variant)
+	}
+
+	if j.MultipleOf != nil && *j.MultipleOf > 0 {
+		n = math.Ceil(n / *j.MultipleOf) * *j.MultipleOf
+		if n > high {
+			n -= *j.MultipleOf
+		}
+	}
+
+	if integer {
+		n = math.Ceil(n)
+		if n > high {
+			n--
+		}
+	}
+
+	return n
+}
+
+func (j JsonSchema) generateArray(root JsonSchema, depth int) []any {
+	count := 1
+	if j.MinItems != nil && *j.MinItems > count {
+		count = *j.MinItems
+	}
+	if j.MaxItems != nil && *j.MaxItems < count {
+		count = *j.MaxItems
+	}
+
+	items := j.Items
+	if items == nil {
+		items = &JsonSchema{Type: TypeString}
+	}
+
+	result := []any{}
+	for i := range count {
+		//Items that differ are fine without uniqueItems too
+		result = append(result, items.generate(root, depth+1, i))
+	}
+	return result
+}
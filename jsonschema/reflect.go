@@ -0,0 +1,307 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeFor[time.Time]()
+
+// FromStruct builds the schema of the struct v, or of the struct v points to, like a tool's params.
+// Fields are named by their json tag, and these tags add to their schema:
+//
+//	description:"The size of the image"
+//	enum:"small,medium,large"
+//	min:"1" max:"10"       minimum and maximum, the length of strings or the number of items of slices
+//	format:"date-time"     pattern:"^[a-z]+$"     default:"medium"
+//	required:"false"       fields are required, unless they are pointers, omitempty or have this tag
+//
+// Structs that contain themselves are referenced through $defs.
+func FromStruct(v any) (JsonSchema, error) {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return JsonSchema{}, fmt.Errorf("%v is not a struct", t)
+	}
+
+	b := builder{root: t, defs: map[string]*JsonSchema{}, building: map[reflect.Type]bool{}, referenced: map[reflect.Type]bool{}}
+	schema, err := b.schema(t)
+	if err != nil {
+		return JsonSchema{}, err
+	}
+
+	if len(b.defs) > 0 {
+		schema.Defs = b.defs
+	}
+	return *schema, nil
+}
+
+// MustFromStruct is FromStruct for types that are known to work, such as in a Schema method. It panics on errors.
+func MustFromStruct(v any) JsonSchema {
+	schema, err := FromStruct(v)
+	if err != nil {
+		panic(err)
+	}
+	return schema
+}
+
+// Decode turns params, such as the params of a tool call, into v. v is usually a pointer to a struct
+// that FromStruct made the schema of.
+func Decode(params map[string]any, v any) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("could not encode params: %w", err)
+	}
+
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return fmt.Errorf("could not decode params: %w", err)
+	}
+	return nil
+}
+
+type builder struct {
+	root       reflect.Type
+	defs       map[string]*JsonSchema
+	building   map[reflect.Type]bool
+	referenced map[reflect.Type]bool
+}
+
+func (b *builder) schema(t reflect.Type) (*JsonSchema, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		return &JsonSchema{Type: TypeString, Format: "date-time"}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &JsonSchema{Type: TypeString}, nil
+	case reflect.Bool:
+		return &JsonSchema{Type: TypeBoolean}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &JsonSchema{Type: TypeInteger}, nil
+	case reflect.Float32, reflect.Float64:
+		return &JsonSchema{Type: TypeNumber}, nil
+	case reflect.Interface:
+		//Anything
+		return &JsonSchema{}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			//encoding/json writes bytes as base64
+			return &JsonSchema{Type: TypeString}, nil
+		}
+		items, err := b.schema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &JsonSchema{Type: TypeArray, Items: items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("map keys of %v must be strings", t)
+		}
+		values, err := b.schema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &JsonSchema{Type: TypeObject, AdditionalProperties: values}, nil
+	case reflect.Struct:
+		return b.structSchema(t)
+	}
+
+	return nil, fmt.Errorf("type %v has no JSON schema", t)
+}
+
+func (b *builder) structSchema(t reflect.Type) (*JsonSchema, error) {
+	if b.building[t] {
+		b.referenced[t] = true
+		if t == b.root {
+			return &JsonSchema{Ref: "#"}, nil
+		}
+		return &JsonSchema{Ref: "#/$defs/" + t.Name()}, nil
+	}
+
+	b.building[t] = true
+	defer delete(b.building, t)
+
+	schema := &JsonSchema{Type: TypeObject, Properties: map[string]*JsonSchema{}, AdditionalProperties: Bool(false)}
+	err := b.addFields(schema, t)
+	if err != nil {
+		return nil, err
+	}
+
+	if b.referenced[t] && t != b.root {
+		b.defs[t.Name()] = schema
+		return &JsonSchema{Ref: "#/$defs/" + t.Name()}, nil
+	}
+	return schema, nil
+}
+
+func (b *builder) addFields(schema *JsonSchema, t reflect.Type) error {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, omitEmpty, skip := jsonName(field)
+		if skip {
+			continue
+		}
+
+		//Fields of embedded structs are fields of this struct, as encoding/json does
+		ft := field.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if field.Anonymous && field.Tag.Get("json") == "" && ft.Kind() == reflect.Struct {
+			err := b.addFields(schema, ft)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		prop, err := b.schema(field.Type)
+		if err != nil {
+			return fmt.Errorf("field %v: %w", field.Name, err)
+		}
+		//Don't change a schema that is shared through a reference
+		if prop.Ref == "" {
+			err = applyTags(prop, field)
+			if err != nil {
+				return fmt.Errorf("field %v: %w", field.Name, err)
+			}
+		}
+
+		schema.Properties[name] = prop
+
+		required := field.Type.Kind() != reflect.Pointer && !omitEmpty
+		if tag, ok := field.Tag.Lookup("required"); ok {
+			required = tag == "true"
+		}
+		if required {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	return nil
+}
+
+// The name of a field in JSON, as encoding/json names it.
+func jsonName(field reflect.StructField) (name string, omitEmpty bool, skip bool) {
+	if !field.IsExported() && !field.Anonymous {
+		return "", false, true
+	}
+
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false, true
+	}
+
+	name, options, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = field.Name
+	}
+	return name, strings.Contains(options, "omitempty"), false
+}
+
+func applyTags(s *JsonSchema, field reflect.StructField) error {
+	tag := field.Tag
+
+	s.Description = tag.Get("description")
+
+	//Of a slice, the items have the enum and format
+	values := s
+	if s.Type == TypeArray && s.Items.Ref == "" {
+		values = s.Items
+	}
+	if format, ok := tag.Lookup("format"); ok {
+		values.Format = format
+	}
+	if pattern, ok := tag.Lookup("pattern"); ok {
+		values.Pattern = pattern
+	}
+
+	if enum, ok := tag.Lookup("enum"); ok {
+		for _, value := range strings.Split(enum, ",") {
+			v, err := parseValue(values.Type, strings.TrimSpace(value))
+			if err != nil {
+				return fmt.Errorf("invalid enum: %w", err)
+			}
+			values.Enum = append(values.Enum, v)
+		}
+	}
+
+	if def, ok := tag.Lookup("default"); ok {
+		v, err := parseValue(s.Type, def)
+		if err != nil {
+			return fmt.Errorf("invalid default: %w", err)
+		}
+		s.Default = v
+	}
+
+	for _, key := range []string{"min", "max"} {
+		value, ok := tag.Lookup(key)
+		if !ok {
+			continue
+		}
+		err := setLimit(s, key == "min", value)
+		if err != nil {
+			return fmt.Errorf("invalid %v: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+// Set the minimum or maximum that fits the type of s.
+func setLimit(s *JsonSchema, min bool, value string) error {
+	switch s.Type {
+	case TypeNumber, TypeInteger:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		if min {
+			s.Minimum = &f
+		} else {
+			s.Maximum = &f
+		}
+	case TypeString, TypeArray:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		switch {
+		case s.Type == TypeString && min:
+			s.MinLength = &n
+		case s.Type == TypeString:
+			s.MaxLength = &n
+		case min:
+			s.MinItems = &n
+		default:
+			s.MaxItems = &n
+		}
+	default:
+		return fmt.Errorf("not supported for %v", s.Type)
+	}
+	return nil
+}
+
+// Parse a tag value as a value of type t.
+func parseValue(t string, value string) (any, error) {
+	switch t {
+	case TypeInteger:
+		return strconv.ParseInt(value, 10, 64)
+	case TypeNumber:
+		return strconv.ParseFloat(value, 64)
+	case TypeBoolean:
+		return strconv.ParseBool(value)
+	}
+	return value, nil
+}
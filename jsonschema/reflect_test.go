@@ -0,0 +1,118 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type Paging struct {
+	Page int `json:"page,omitempty" min:"1" default:"1"`
+}
+
+type Node struct {
+	Name     string  `json:"name"`
+	Children []*Node `json:"children,omitempty"`
+}
+
+type imageParams struct {
+	Paging
+	Prompt  string            `json:"prompt" description:"What the image shows" min:"3" max:"500"`
+	Size    string            `json:"size" enum:"small, medium, large" default:"medium"`
+	Count   int               `json:"count" min:"1" max:"4"`
+	Scale   float64           `json:"scale,omitempty"`
+	Seed    *int64            `json:"seed"`
+	Styles  []string          `json:"styles" enum:"photo,drawing" required:"false" max:"2"`
+	Tags    map[string]string `json:"tags,omitempty"`
+	Due     time.Time         `json:"due" required:"false"`
+	Tree    Node              `json:"tree" required:"false"`
+	Raw     any               `json:"raw,omitempty"`
+	Ignored string            `json:"-"`
+	private string
+}
+
+func TestFromStruct(t *testing.T) {
+	schema, err := FromStruct(&imageParams{})
+	assert.Nil(t, err)
+
+	data, err := json.MarshalIndent(schema, "", " ")
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{
+		"type": "object",
+		"properties": {
+			"page": {"type": "integer", "default": 1, "minimum": 1},
+			"prompt": {"type": "string", "description": "What the image shows", "minLength": 3, "maxLength": 500},
+			"size": {"type": "string", "default": "medium", "enum": ["small", "medium", "large"]},
+			"count": {"type": "integer", "minimum": 1, "maximum": 4},
+			"scale": {"type": "number"},
+			"seed": {"type": "integer"},
+			"styles": {"type": "array", "items": {"type": "string", "enum": ["photo", "drawing"]}, "maxItems": 2},
+			"tags": {"type": "object", "additionalProperties": {"type": "string"}},
+			"due": {"type": "string", "format": "date-time"},
+			"tree": {"$ref": "#/$defs/Node"},
+			"raw": {}
+		},
+		"required": ["prompt", "size", "count"],
+		"additionalProperties": false,
+		"$defs": {
+			"Node": {
+				"type": "object",
+				"properties": {
+					"name": {"type": "string"},
+					"children": {"type": "array", "items": {"$ref": "#/$defs/Node"}}
+				},
+				"required": ["name"],
+				"additionalProperties": false
+			}
+		}
+	}`, string(data))
+
+	//Generated params are valid, and decode into the struct
+	params := schema.Generate().(map[string]any)
+	assert.Nil(t, Validate(schema, params))
+
+	decoded := imageParams{}
+	assert.Nil(t, Decode(params, &decoded))
+	assert.Equal(t, "medium", decoded.Size)
+	assert.Equal(t, 1, decoded.Page)
+}
+
+func TestFromStruct_Recursive(t *testing.T) {
+	schema, err := FromStruct(Node{})
+	assert.Nil(t, err)
+	assert.Equal(t, "#", schema.Properties["children"].Items.Ref)
+	assert.Nil(t, Validate(schema, schema.Generate()))
+}
+
+func TestFromStruct_Errors(t *testing.T) {
+	_, err := FromStruct("not a struct")
+	assert.NotNil(t, err)
+
+	_, err = FromStruct(struct {
+		Run func() `json:"run"`
+	}{})
+	assert.EqualError(t, err, "field Run: type func() has no JSON schema")
+
+	_, err = FromStruct(struct {
+		Count int `json:"count" enum:"one,two"`
+	}{})
+	assert.ErrorContains(t, err, "field Count: invalid enum")
+
+	assert.Panics(t, func() { MustFromStruct(nil) })
+}
+
+func TestDecode(t *testing.T) {
+	params := map[string]any{"prompt": "a cat", "count": float64(2), "seed": 42, "styles": []any{"photo"}}
+
+	decoded := imageParams{}
+	assert.Nil(t, Decode(params, &decoded))
+	assert.Equal(t, "a cat", decoded.Prompt)
+	assert.Equal(t, 2, decoded.Count)
+	assert.Equal(t, int64(42), *decoded.Seed)
+	assert.Equal(t, []string{"photo"}, decoded.Styles)
+
+	err := Decode(map[string]any{"count": "two"}, &decoded)
+	assert.NotNil(t, err)
+}
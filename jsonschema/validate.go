@@ -0,0 +1,403 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// ValidationError is a value that does not match its schema.
+type ValidationError struct {
+	// Where the value is, like tags[1].name. Empty for the value itself.
+	Path    string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%v: %v", e.Path, e.Message)
+}
+
+// ValidationErrors are all the problems with a value.
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := []string{}
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Validate checks value against schema. Values are what encoding/json decodes into an any,
+// other Go numbers and slices are fine too. Returns ValidationErrors when it does not match.
+func Validate(schema JsonSchema, value any) error {
+	v := validator{root: schema}
+	v.validate(schema, value, "", 0)
+	if len(v.errors) == 0 {
+		return nil
+	}
+
+	slices.SortStableFunc(v.errors, func(a, b ValidationError) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return v.errors
+}
+
+type validator struct {
+	root   JsonSchema
+	errors ValidationErrors
+}
+
+func (v *validator) fail(path string, message string, a ...any) {
+	v.errors = append(v.errors, ValidationError{Path: path, Message: fmt.Sprintf(message, a...)})
+}
+
+func (v *validator) validate(s JsonSchema, value any, path string, depth int) {
+	if s.Boolean != nil {
+		if !*s.Boolean {
+			v.fail(path, "is not allowed")
+		}
+		return
+	}
+
+	if s.Ref != "" {
+		if depth > maxRefDepth {
+			return
+		}
+		resolved, err := s.Resolve(v.root)
+		if err != nil {
+			v.fail(path, "%v", err)
+			return
+		}
+		v.validate(resolved, value, path, depth+1)
+		return
+	}
+
+	if value == nil && s.Nullable {
+		return
+	}
+
+	if s.Const != nil && !equal(s.Const, value) {
+		v.fail(path, "must be %v", format(s.Const))
+		return
+	}
+
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(e any) bool { return equal(e, value) }) {
+		options := []string{}
+		for _, e := range s.Enum {
+			options = append(options, format(e))
+		}
+		v.fail(path, "must be one of %v, not %v", strings.Join(options, ", "), format(value))
+		return
+	}
+
+	v.validateCombined(s, value, path, depth)
+
+	if s.Type != "" && !isType(s.Type, value) {
+		v.fail(path, "must be %v %v, not %v", article(s.Type), s.Type, describe(value))
+		return
+	}
+
+	switch val := value.(type) {
+	case string:
+		v.validateString(s, val, path)
+	case map[string]any:
+		v.validateObject(s, val, path, depth)
+	case nil, bool:
+	default:
+		if n, ok := toFloat(value); ok {
+			v.validateNumber(s, n, path)
+		} else if items, ok := toSlice(value); ok {
+			v.validateArray(s, items, path, depth)
+		}
+	}
+}
+
+func (v *validator) validateCombined(s JsonSchema, value any, path string, depth int) {
+	for _, sub := range s.AllOf {
+		v.validate(orTrue(sub), value, path, depth+1)
+	}
+
+	if len(s.AnyOf) > 0 && v.matches(s.AnyOf, value, depth) == 0 {
+		v.fail(path, "does not match any of the allowed schemas")
+	}
+
+	if len(s.OneOf) > 0 {
+		if n := v.matches(s.OneOf, value, depth); n != 1 {
+			v.fail(path, "must match exactly one of the allowed schemas, matches %v", n)
+		}
+	}
+}
+
+// The number of schemas value matches.
+func (v *validator) matches(schemas []*JsonSchema, value any, depth int) int {
+	count := 0
+	for _, sub := range schemas {
+		check := validator{root: v.root}
+		check.validate(orTrue(sub), value, "", depth+1)
+		if len(check.errors) == 0 {
+			count++
+		}
+	}
+	return count
+}
+
+func (v *validator) validateString(s JsonSchema, val string, path string) {
+	length := utf8.RuneCountInString(val)
+	if s.MinLength != nil && length < *s.MinLength {
+		v.fail(path, "must be at least %v characters long", *s.MinLength)
+	}
+	if s.MaxLength != nil && length > *s.MaxLength {
+		v.fail(path, "must be at most %v characters long", *s.MaxLength)
+	}
+
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err == nil && !re.MatchString(val) {
+			v.fail(path, "must match the pattern %v", s.Pattern)
+		}
+	}
+
+	if s.Format != "" && !validFormat(s.Format, val) {
+		v.fail(path, "must be a valid %v", s.Format)
+	}
+}
+
+func (v *validator) validateNumber(s JsonSchema, n float64, path string) {
+	if s.Minimum != nil && n < *s.Minimum {
+		v.fail(path, "must be at least %v", *s.Minimum)
+	}
+	if s.Maximum != nil && n > *s.Maximum {
+		v.fail(path, "must be at most %v", *s.Maximum)
+	}
+	if s.ExclusiveMinimum != nil && n <= *s.ExclusiveMinimum {
+		v.fail(path, "must be more than %v", *s.ExclusiveMinimum)
+	}
+	if s.ExclusiveMaximum != nil && n >= *s.ExclusiveMaximum {
+		v.fail(path, "must be less than %v", *s.ExclusiveMaximum)
+	}
+	if s.MultipleOf != nil && *s.MultipleOf > 0 {
+		q := n / *s.MultipleOf
+		if math.Abs(q-math.Round(q)) > 1e-9 {
+			v.fail(path, "must be a multiple of %v", *s.MultipleOf)
+		}
+	}
+}
+
+func (v *validator) validateArray(s JsonSchema, items []any, path string, depth int) {
+	if s.MinItems != nil && len(items) < *s.MinItems {
+		v.fail(path, "must have at least %v items", *s.MinItems)
+	}
+	if s.MaxItems != nil && len(items) > *s.MaxItems {
+		v.fail(path, "must have at most %v items", *s.MaxItems)
+	}
+
+	if s.UniqueItems {
+		for i := range items {
+			for j := range i {
+				if equal(items[i], items[j]) {
+					v.fail(fmt.Sprintf("%v[%v]", path, i), "must be unique, it is the same as item %v", j)
+				}
+			}
+		}
+	}
+
+	if s.Items != nil {
+		for i, item := range items {
+			v.validate(*s.Items, item, fmt.Sprintf("%v[%v]", path, i), depth+1)
+		}
+	}
+}
+
+func (v *validator) validateObject(s JsonSchema, obj map[string]any, path string, depth int) {
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			v.fail(join(path, name), "is required")
+		}
+	}
+
+	for name := range obj {
+		if prop, ok := s.Properties[name]; ok {
+			v.validate(orTrue(prop), obj[name], join(path, name), depth+1)
+		} else if s.AdditionalProperties != nil {
+			if s.AdditionalProperties.Boolean != nil && !*s.AdditionalProperties.Boolean {
+				v.fail(join(path, name), "is not a known property")
+				continue
+			}
+			v.validate(*s.AdditionalProperties, obj[name], join(path, name), depth+1)
+		}
+	}
+}
+
+// A missing subschema, like "items": null, allows any value.
+func orTrue(s *JsonSchema) JsonSchema {
+	if s == nil {
+		return JsonSchema{}
+	}
+	return *s
+}
+
+func join(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func isType(t string, value any) bool {
+	switch t {
+	case TypeString:
+		_, ok := value.(string)
+		return ok
+	case TypeNumber:
+		_, ok := toFloat(value)
+		return ok
+	case TypeInteger:
+		n, ok := toFloat(value)
+		return ok && n == math.Trunc(n)
+	case TypeBoolean:
+		_, ok := value.(bool)
+		return ok
+	case TypeNull:
+		return value == nil
+	case TypeArray:
+		_, ok := toSlice(value)
+		return ok
+	case TypeObject:
+		_, ok := value.(map[string]any)
+		return ok
+	}
+
+	//Unknown types are not checked
+	return true
+}
+
+func toFloat(value any) (float64, bool) {
+	switch n := value.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case bool, string, nil:
+		return 0, false
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+func toSlice(value any) ([]any, bool) {
+	if items, ok := value.([]any); ok {
+		return items, true
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+
+	items := make([]any, rv.Len())
+	for i := range items {
+		items[i] = rv.Index(i).Interface()
+	}
+	return items, true
+}
+
+// Values are equal when they are the same JSON, so 1 and 1.0 are equal.
+func equal(a any, b any) bool {
+	if fa, ok := toFloat(a); ok {
+		fb, ok := toFloat(b)
+		return ok && fa == fb
+	}
+
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	if errA != nil || errB != nil {
+		return reflect.DeepEqual(a, b)
+	}
+	return string(ja) == string(jb)
+}
+
+func validFormat(format string, val string) bool {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, val)
+		return err == nil
+	case "date":
+		_, err := time.Parse(time.DateOnly, val)
+		return err == nil
+	case "email":
+		_, err := mail.ParseAddress(val)
+		return err == nil
+	case "uri", "url":
+		u, err := url.Parse(val)
+		return err == nil && u.Scheme != ""
+	case "uuid":
+		return uuidPattern.MatchString(val)
+	case "ipv4":
+		addr, err := netip.ParseAddr(val)
+		return err == nil && addr.Is4()
+	case "ipv6":
+		addr, err := netip.ParseAddr(val)
+		return err == nil && addr.Is6()
+	}
+
+	//Other formats are not checked
+	return true
+}
+
+// A value as it looks in JSON.
+func format(value any) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+// The JSON type of a value and the value, like string "10".
+func describe(value any) string {
+	switch {
+	case value == nil:
+		return "null"
+	case isType(TypeString, value):
+		return "string " + format(value)
+	case isType(TypeNumber, value):
+		return "number " + format(value)
+	case isType(TypeBoolean, value):
+		return "boolean " + format(value)
+	case isType(TypeArray, value):
+		return "an array"
+	case isType(TypeObject, value):
+		return "an object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func article(t string) string {
+	if t == TypeArray || t == TypeObject || t == TypeInteger {
+		return "an"
+	}
+	return "a"
+}
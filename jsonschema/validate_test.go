@@ -0,0 +1,77 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	schema := JsonSchema{}
+	err := json.Unmarshal([]byte(fullSchema), &schema)
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name   string
+		params string
+		want   string
+	}{
+		{name: "valid", params: `{"id": "00000000-0000-4000-8000-000000000000"}`},
+		{name: "generated", params: ""},
+		{name: "missing required", params: `{}`, want: "id: is required"},
+		{name: "wrong type", params: `{"id": "00000000-0000-4000-8000-000000000000", "count": "3"}`, want: `count: must be an integer, not string "3"`},
+		{name: "not an integer", params: `{"id": "00000000-0000-4000-8000-000000000000", "count": 2.5}`, want: `count: must be an integer, not number 2.5`},
+		{name: "enum", params: `{"id": "00000000-0000-4000-8000-000000000000", "size": "medium"}`, want: `size: must be one of "small", "large", not "medium"`},
+		{name: "format", params: `{"id": "nope"}`, want: "id: must be a valid uuid"},
+		{name: "nullable", params: `{"id": "00000000-0000-4000-8000-000000000000", "note": null}`},
+		{name: "max length", params: `{"id": "00000000-0000-4000-8000-000000000000", "note": "long"}`, want: "note: must be at most 2 characters long"},
+		{name: "range", params: `{"id": "00000000-0000-4000-8000-000000000000", "count": 9, "ratio": 20}`, want: "count: must be at most 5; ratio: must be more than 20; ratio: must be a multiple of 3"},
+		{name: "unique items", params: `{"id": "00000000-0000-4000-8000-000000000000", "tags": ["a", "a"]}`, want: "tags[1]: must be unique, it is the same as item 0"},
+		{name: "item type", params: `{"id": "00000000-0000-4000-8000-000000000000", "tags": ["a", 2]}`, want: "tags[1]: must be a string, not number 2"},
+		{name: "additional properties", params: `{"id": "00000000-0000-4000-8000-000000000000", "colour": "red"}`, want: "colour: is not a known property"},
+		{name: "reference", params: `{"id": "00000000-0000-4000-8000-000000000000", "owner": {"name": "Alice", "manager": {}}}`, want: "owner.manager.name: is required"},
+		{name: "any of", params: `{"id": "00000000-0000-4000-8000-000000000000", "either": 5}`, want: "either: does not match any of the allowed schemas"},
+		{name: "not an object", params: `[]`, want: "must be an object, not an array"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var params any = schema.Generate()
+			if tt.params != "" {
+				assert.Nil(t, json.Unmarshal([]byte(tt.params), &params))
+			}
+
+			err := Validate(schema, params)
+			if tt.want == "" {
+				assert.Nil(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.want)
+
+			var errs ValidationErrors
+			assert.ErrorAs(t, err, &errs)
+		})
+	}
+}
+
+func TestValidate_GoValues(t *testing.T) {
+	schema := New()
+	schema.AddInteger("a", "", true)
+	schema.AddArray("tags", "", JsonSchema{Type: TypeString}, false)
+
+	assert.Nil(t, Validate(schema, map[string]any{"a": 5, "tags": []string{"x"}}))
+	assert.EqualError(t, Validate(schema, map[string]any{"a": int64(5), "tags": []int{1}}), "tags[0]: must be a string, not number 1")
+}
+
+func TestValidate_NilSchemas(t *testing.T) {
+	schema := JsonSchema{}
+	err := json.Unmarshal([]byte(`{"type": "object", "properties": {"a": null, "tags": {"type": "array", "items": null}}, "anyOf": [null], "allOf": [null], "additionalProperties": null}`), &schema)
+	assert.Nil(t, err)
+
+	//Missing subschemas allow anything
+	assert.Nil(t, Validate(schema, map[string]any{"a": 1, "tags": []any{"x", 2}, "b": true}))
+
+	schema = JsonSchema{Type: TypeObject, Properties: map[string]*JsonSchema{"a": nil}, OneOf: []*JsonSchema{nil}}
+	assert.Nil(t, Validate(schema, map[string]any{"a": 1}))
+	assert.EqualError(t, Validate(schema, "a"), `must be an object, not string "a"`)
+}
@@ -34,15 +34,47 @@ type Claude struct {
 	cfg      Config
 	messages []ClaudeMessage
 	tools    []chattools.ToolDefinition
+	//Forces or forbids tool calls
+	toolChoice chattools.ToolChoice
+	//Answers are forced calls to a tool with this schema
+	responseSchema *jsonschema.JsonSchema
 }
 
+// The tool Claude answers with when there is a response schema
+const respondToolName = "respond"
+
 type claudePostBody struct {
-	Model     string          `json:"model"`
-	Messages  []ClaudeMessage `json:"messages"`
-	MaxTokens int             `json:"max_tokens"`
-	Stream    bool            `json:"stream,omitempty"`
-	System    string          `json:"system"`
-	Tools     []claudeToolDef `json:"tools,omitempty"`
+	Model      string            `json:"model"`
+	Messages   []ClaudeMessage   `json:"messages"`
+	MaxTokens  int               `json:"max_tokens"`
+	Stream     bool              `json:"stream,omitempty"`
+	System     string            `json:"system"`
+	Tools      []claudeToolDef   `json:"tools,omitempty"`
+	ToolChoice *claudeToolChoice `json:"tool_choice,omitempty"`
+}
+
+type claudeToolChoice struct {
+	Type                   string `json:"type"`
+	Name                   string `json:"name,omitempty"`
+	DisableParallelToolUse bool   `json:"disable_parallel_tool_use,omitempty"`
+}
+
+func toClaudeToolChoice(choice chattools.ToolChoice) *claudeToolChoice {
+	if choice.IsAuto() {
+		return nil
+	}
+
+	result := &claudeToolChoice{Type: choice.Type, DisableParallelToolUse: choice.DisableParallel}
+	switch choice.Type {
+	case "", chattools.ToolChoiceAuto:
+		result.Type = "auto"
+	case chattools.ToolChoiceNone:
+		//Only auto, any and tool take disable_parallel_tool_use
+		result.DisableParallelToolUse = false
+	case chattools.ToolChoiceTool:
+		result.Name = choice.Name
+	}
+	return result
 }
 
 type claudeToolDef struct {
@@ -76,6 +108,16 @@ func (c *Claude) GetStreamingResponse(message chatbot.ChatMessage, streamChan ch
 				InputSchema: t.Schema(),
 			})
 		}
+		body.ToolChoice = toClaudeToolChoice(c.toolChoice)
+	}
+
+	wrapped := false
+	if c.responseSchema != nil {
+		var err error
+		wrapped, err = c.addRespondTool(&body)
+		if err != nil {
+			return chatbot.ChatMessage{}, err
+		}
 	}
 
 	jsonBody, err := json.Marshal(body)
@@ -116,6 +158,9 @@ func (c *Claude) GetStreamingResponse(message chatbot.ChatMessage, streamChan ch
 	if err != nil {
 		return chatbot.ChatMessage{}, fmt.Errorf("stream consume error: %w", err)
 	}
+	if c.responseSchema != nil {
+		responseMessage = answerAsText(responseMessage, wrapped)
+	}
 	c.messages = append(c.messages, responseMessage)
 	return responseMessage.ToChatMessage(), nil
 }
@@ -166,3 +211,65 @@ func (c Claude) SupportedFeatures() []string {
 func (c *Claude) SetTools(tools []chattools.ToolDefinition) {
 	c.tools = tools
 }
+
+// Force or forbid tool calls.
+func (c *Claude) SetToolChoice(choice chattools.ToolChoice) {
+	c.toolChoice = choice
+}
+
+// Make Claude answer with JSON that matches schema, through a forced tool call.
+func (c *Claude) SetResponseSchema(schema *jsonschema.JsonSchema) {
+	c.responseSchema = schema
+}
+
+// Adds the tool Claude answers with. Without other tools it is forced, with other tools Claude must
+// call one of them, or answer with it. Returns whether the schema was wrapped.
+func (c *Claude) addRespondTool(body *claudePostBody) (bool, error) {
+	for _, t := range body.Tools {
+		if t.Name == respondToolName {
+			return false, fmt.Errorf("tool %v cannot be used with a response schema, rename the tool", respondToolName)
+		}
+	}
+
+	schema, wrapped := chatbot.WrapSchema(*c.responseSchema)
+	body.Tools = append(body.Tools, claudeToolDef{
+		Name:        respondToolName,
+		Description: "Give your final answer to the user with this tool.",
+		InputSchema: schema,
+	})
+
+	switch {
+	case len(c.tools) == 0, c.toolChoice.Type == chattools.ToolChoiceNone:
+		body.ToolChoice = &claudeToolChoice{Type: "tool", Name: respondToolName}
+	case c.toolChoice.Type == chattools.ToolChoiceTool:
+		//Keep the forced tool, its results come back for the answer
+	default:
+		//Any tool, so there is no answer without the respond tool
+		body.ToolChoice = &claudeToolChoice{Type: "any", DisableParallelToolUse: c.toolChoice.DisableParallel}
+	}
+	return wrapped, nil
+}
+
+// Replace the call to the respond tool with its input as text, so the answer is a plain assistant message.
+func answerAsText(msg ClaudeMessage, wrapped bool) ClaudeMessage {
+	for _, block := range msg.Content {
+		if block.Type != ContentTypeToolCall || block.ToolCallBlock.Name != respondToolName {
+			continue
+		}
+
+		text := string(block.ToolCallBlock.rawInput)
+		if block.ToolCallBlock.rawInput == nil {
+			data, _ := json.Marshal(block.ToolCallBlock.Input)
+			text = string(data)
+		}
+		if wrapped {
+			text = chatbot.UnwrapResponse(text)
+		}
+
+		msg.Content = []ContentBlock{{Type: ContentTypeText, TextBlock: &TextBlock{Type: ContentTypeText, Text: text}}}
+		msg.StopReason = "end_turn"
+		return msg
+	}
+
+	return msg
+}
@@ -23,6 +23,9 @@ type ClaudeMessage struct {
 	//assistant or user
 	Role    string         `json:"role"`
 	Content []ContentBlock `json:"content"`
+	//Only set on responses
+	StopReason string `json:"-"`
+	Usage      *Usage `json:"-"`
 }
 
 type ContentBlock struct {
@@ -150,8 +153,12 @@ func (cm ClaudeMessage) ToChatMessage() chatbot.ChatMessage {
 	}
 
 	msg := chatbot.ChatMessage{
-		Role:    cm.Role,
-		Content: strings.Join(texts, " "),
+		Role:       cm.Role,
+		Content:    strings.Join(texts, " "),
+		StopReason: cm.StopReason,
+	}
+	if cm.Usage != nil {
+		msg.Usage = &chatbot.Usage{InputTokens: cm.Usage.InputTokens, OutputTokens: cm.Usage.OutputTokens}
 	}
 	if len(toolCalls) > 0 {
 		msg.ToolCalls = toolCalls
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/c00/botman-v2/chattools"
+	"github.com/c00/botman-v2/jsonschema"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -58,3 +60,74 @@ func TestContentBlock_JSON(t *testing.T) {
 		})
 	}
 }
+
+func TestAnswerAsText(t *testing.T) {
+	respond := func(input map[string]any) ClaudeMessage {
+		return ClaudeMessage{Role: "assistant", StopReason: "tool_use", Content: []ContentBlock{
+			{Type: ContentTypeToolCall, ToolCallBlock: &ToolCallBlock{Type: ContentTypeToolCall, ID: "1", Name: respondToolName, Input: input}},
+		}}
+	}
+
+	msg := answerAsText(respond(map[string]any{"name": "Bob"}), false).ToChatMessage()
+	assert.Equal(t, `{"name":"Bob"}`, msg.Content)
+	assert.Empty(t, msg.ToolCalls)
+	assert.Equal(t, "end_turn", msg.StopReason)
+
+	msg = answerAsText(respond(map[string]any{"value": []any{1, 2}}), true).ToChatMessage()
+	assert.Equal(t, `[1,2]`, msg.Content)
+
+	//Other tool calls are left alone
+	other := respond(nil)
+	other.Content[0].ToolCallBlock.Name = "other"
+	assert.Equal(t, other, answerAsText(other, false))
+}
+
+func TestToClaudeToolChoice(t *testing.T) {
+	assert.Nil(t, toClaudeToolChoice(chattools.ToolChoice{}))
+	assert.Nil(t, toClaudeToolChoice(chattools.ToolChoice{Type: chattools.ToolChoiceAuto}))
+
+	assert.Equal(t, &claudeToolChoice{Type: "auto", DisableParallelToolUse: true}, toClaudeToolChoice(chattools.ToolChoice{DisableParallel: true}))
+	assert.Equal(t, &claudeToolChoice{Type: "any"}, toClaudeToolChoice(chattools.ToolChoice{Type: chattools.ToolChoiceAny}))
+	assert.Equal(t, &claudeToolChoice{Type: "none"}, toClaudeToolChoice(chattools.ToolChoice{Type: chattools.ToolChoiceNone, DisableParallel: true}))
+	assert.Equal(t, &claudeToolChoice{Type: "tool", Name: "add", DisableParallelToolUse: true}, toClaudeToolChoice(chattools.ToolChoice{Type: chattools.ToolChoiceTool, Name: "add", DisableParallel: true}))
+}
+
+func TestClaude_addRespondTool(t *testing.T) {
+	schema := jsonschema.New()
+	schema.AddString("name", "the name", true)
+	add := chattools.ToolDefinition{ToolType: chattools.ToolTypeAddNumbers, Name: "add"}
+
+	respondChoice := func(c *Claude) *claudeToolChoice {
+		body := &claudePostBody{ToolChoice: toClaudeToolChoice(c.toolChoice)}
+		for _, t := range c.tools {
+			body.Tools = append(body.Tools, claudeToolDef{Name: t.Name})
+		}
+		_, err := c.addRespondTool(body)
+		assert.Nil(t, err)
+		if assert.NotEmpty(t, body.Tools) {
+			assert.Equal(t, respondToolName, body.Tools[len(body.Tools)-1].Name)
+		}
+		return body.ToolChoice
+	}
+
+	//Without tools the answer is forced
+	c := &Claude{responseSchema: &schema}
+	assert.Equal(t, &claudeToolChoice{Type: "tool", Name: respondToolName}, respondChoice(c))
+
+	//With tools Claude can call them first
+	c.tools = []chattools.ToolDefinition{add}
+	assert.Equal(t, &claudeToolChoice{Type: "any"}, respondChoice(c))
+
+	c.toolChoice = chattools.ToolChoice{DisableParallel: true}
+	assert.Equal(t, &claudeToolChoice{Type: "any", DisableParallelToolUse: true}, respondChoice(c))
+
+	c.toolChoice = chattools.ToolChoice{Type: chattools.ToolChoiceTool, Name: "add"}
+	assert.Equal(t, &claudeToolChoice{Type: "tool", Name: "add"}, respondChoice(c))
+
+	c.toolChoice = chattools.ToolChoice{Type: chattools.ToolChoiceNone}
+	assert.Equal(t, &claudeToolChoice{Type: "tool", Name: respondToolName}, respondChoice(c))
+
+	//A tool of the same name is rejected
+	_, err := c.addRespondTool(&claudePostBody{Tools: []claudeToolDef{{Name: respondToolName}}})
+	assert.ErrorContains(t, err, "tool respond cannot be used with a response schema")
+}
@@ -87,9 +87,21 @@ func (pm StreamMessages) ToFinalMessage() ClaudeMessage {
 	//I'm assuming that the indexes in Deltas come in the right order.
 	//This may be a bad assumption.
 	content := []ContentBlock{}
+	var usage *Usage
+	stopReason := ""
 
 	for _, msg := range pm {
 		switch msg.Type {
+		case MsgTypeMessageStart:
+			u := msg.MessageStart.Message.Usage
+			usage = &u
+		case MsgTypeMessageDelta:
+			stopReason = msg.MessageDelta.Delta.StopReason
+			if usage == nil {
+				usage = &Usage{}
+			}
+			//Output tokens in the delta are cumulative
+			usage.OutputTokens = msg.MessageDelta.Usage.OutputTokens
 		case MsgTypeContentBlockStart:
 			//This is a new block.
 			if msg.BlockStart.Index != len(content) {
@@ -114,8 +126,10 @@ func (pm StreamMessages) ToFinalMessage() ClaudeMessage {
 	}
 
 	return ClaudeMessage{
-		Role:    chatbot.ChatMessageRoleAssistant,
-		Content: content,
+		Role:       chatbot.ChatMessageRoleAssistant,
+		Content:    content,
+		StopReason: stopReason,
+		Usage:      usage,
 	}
 }
 
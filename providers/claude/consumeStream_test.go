@@ -18,6 +18,8 @@ func TestConsumeChatStream(t *testing.T) {
 
 	assert.Len(t, message.Content, 1)
 	assert.Equal(t, "Hi!", message.Content[0].TextBlock.Text)
+	assert.Equal(t, "end_turn", message.StopReason)
+	assert.Equal(t, &Usage{InputTokens: 17, OutputTokens: 5}, message.Usage)
 }
 
 func TestConsumeToolStream(t *testing.T) {
@@ -48,7 +50,9 @@ func TestConsumeMultiToolStream(t *testing.T) {
 	assert.Len(t, message.Content, 3)
 
 	expected := ClaudeMessage{
-		Role: chatbot.ChatMessageRoleAssistant,
+		Role:       chatbot.ChatMessageRoleAssistant,
+		StopReason: "tool_use",
+		Usage:      &Usage{InputTokens: 430, OutputTokens: 180},
 		Content: []ContentBlock{
 			{
 				Type: ContentTypeText,
@@ -2,15 +2,18 @@ package openai
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"slices"
 	"strings"
 
 	"github.com/c00/botman-v2/chatbot"
 	"github.com/c00/botman-v2/chattools"
 	"github.com/c00/botman-v2/internal/channeltools"
 	"github.com/c00/botman-v2/internal/logger"
+	"github.com/c00/botman-v2/jsonschema"
 	openai "github.com/sashabaranov/go-openai"
 )
 
@@ -27,28 +30,62 @@ func New(cfg Config) (*OpenAi, error) {
 type OpenAi struct {
 	client   *openai.Client
 	cfg      Config
-	messages []openai.ChatCompletionMessage
+	messages []chatbot.ChatMessage
+	tools    []chattools.ToolDefinition
+	//Forces or forbids tool calls
+	toolChoice chattools.ToolChoice
+	//Answers are JSON that matches this schema
+	responseSchema *jsonschema.JsonSchema
 }
 
 func (c *OpenAi) GetStreamingResponse(message chatbot.ChatMessage, streamChan chan<- string) (chatbot.ChatMessage, error) {
 	defer close(streamChan)
 
-	log.Debug("GetStreamingResponse Content: %v", message.Content)
+	log.Debug("GetStreamingResponse: %v", message.Sprint())
 
-	c.messages = append(c.messages, openai.ChatCompletionMessage{Role: message.Role, Content: message.Content})
+	c.messages = append(c.messages, message)
 
 	postMessages := []openai.ChatCompletionMessage{
 		{Role: "system", Content: c.cfg.SystemPrompt},
 	}
-	postMessages = append(postMessages, c.messages...)
+	for _, m := range c.messages {
+		postMessages = append(postMessages, convertMessage(m)...)
+	}
+
+	request := openai.ChatCompletionRequest{
+		Model:    c.cfg.Model,
+		Messages: postMessages,
+	}
+
+	//Add tools
+	if len(c.tools) > 0 {
+		for _, t := range c.tools {
+			request.Tools = append(request.Tools, openai.Tool{
+				Type: openai.ToolTypeFunction,
+				Function: &openai.FunctionDefinition{
+					Name:        t.Name,
+					Description: t.Description,
+					Parameters:  t.Schema(),
+				},
+			})
+		}
+		request.ToolChoice = toOpenAiToolChoice(c.toolChoice)
+		if c.toolChoice.DisableParallel {
+			request.ParallelToolCalls = false
+		}
+	}
+
+	wrapped := false
+	if c.responseSchema != nil {
+		var schema jsonschema.JsonSchema
+		schema, wrapped = chatbot.WrapSchema(*c.responseSchema)
+		request.ResponseFormat = &openai.ChatCompletionResponseFormat{
+			Type:       openai.ChatCompletionResponseFormatTypeJSONSchema,
+			JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{Name: "response", Schema: schema},
+		}
+	}
 
-	stream, err := c.client.CreateChatCompletionStream(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model:    c.cfg.Model,
-			Messages: postMessages,
-		},
-	)
+	stream, err := c.client.CreateChatCompletionStream(context.Background(), request)
 
 	if err != nil {
 		return chatbot.ChatMessage{}, fmt.Errorf("error getting OpenAi Chat Completion: %v", err)
@@ -56,26 +93,100 @@ func (c *OpenAi) GetStreamingResponse(message chatbot.ChatMessage, streamChan ch
 	defer stream.Close()
 
 	responseContent := make([]string, 0, 50)
+	toolCalls := []openai.ToolCall{}
+	stopReason := ""
 
 	for {
 		response, err := stream.Recv()
 		if errors.Is(err, io.EOF) {
-			message := openai.ChatCompletionMessage{
-				Role:    chatbot.ChatMessageRoleAssistant,
-				Content: strings.Join(responseContent, ""),
+			message := chatbot.ChatMessage{
+				Role:       chatbot.ChatMessageRoleAssistant,
+				Content:    strings.Join(responseContent, ""),
+				StopReason: stopReason,
+			}
+			if wrapped {
+				message.Content = chatbot.UnwrapResponse(message.Content)
+			}
+			message.ToolCalls, err = toToolCalls(toolCalls)
+			if err != nil {
+				return chatbot.ChatMessage{}, err
 			}
 			c.messages = append(c.messages, message)
-			return chatbot.ChatMessage{Role: message.Role, Content: message.Content}, nil
+			return message, nil
 		}
 
 		if err != nil {
 			return chatbot.ChatMessage{}, fmt.Errorf("stream error: %v", err)
 		}
+		if len(response.Choices) == 0 {
+			continue
+		}
+
+		choice := response.Choices[0]
+		if choice.FinishReason != "" {
+			stopReason = string(choice.FinishReason)
+		}
+		toolCalls = addToolCallDeltas(toolCalls, choice.Delta.ToolCalls)
+		if choice.Delta.Content == "" {
+			continue
+		}
+
+		streamChan <- choice.Delta.Content
+
+		responseContent = append(responseContent, choice.Delta.Content)
+	}
+}
+
+// Tool calls are streamed in parts, the parts of a call have the index of the call.
+func addToolCallDeltas(calls []openai.ToolCall, deltas []openai.ToolCall) []openai.ToolCall {
+	for _, delta := range deltas {
+		idx := len(calls) - 1
+		if delta.Index != nil {
+			idx = *delta.Index
+		}
+		for idx >= len(calls) {
+			calls = append(calls, openai.ToolCall{Type: openai.ToolTypeFunction})
+		}
 
-		streamChan <- response.Choices[0].Delta.Content
+		call := &calls[idx]
+		if delta.ID != "" {
+			call.ID = delta.ID
+		}
+		call.Function.Name += delta.Function.Name
+		call.Function.Arguments += delta.Function.Arguments
+	}
+	return calls
+}
+
+func toToolCalls(calls []openai.ToolCall) ([]chattools.ToolCall, error) {
+	if len(calls) == 0 {
+		return nil, nil
+	}
+
+	result := make([]chattools.ToolCall, 0, len(calls))
+	for _, call := range calls {
+		params := map[string]any{}
+		if call.Function.Arguments != "" {
+			err := json.Unmarshal([]byte(call.Function.Arguments), &params)
+			if err != nil {
+				return nil, fmt.Errorf("invalid arguments for tool %v: %w", call.Function.Name, err)
+			}
+		}
+		result = append(result, chattools.ToolCall{ID: call.ID, Name: call.Function.Name, Params: params})
+	}
+	return result, nil
+}
 
-		responseContent = append(responseContent, response.Choices[0].Delta.Content)
+func toOpenAiToolChoice(choice chattools.ToolChoice) any {
+	switch choice.Type {
+	case chattools.ToolChoiceNone:
+		return "none"
+	case chattools.ToolChoiceAny:
+		return "required"
+	case chattools.ToolChoiceTool:
+		return openai.ToolChoice{Type: openai.ToolTypeFunction, Function: openai.ToolFunction{Name: choice.Name}}
 	}
+	return nil
 }
 
 func (c *OpenAi) GetResponse(message chatbot.ChatMessage) (chatbot.ChatMessage, error) {
@@ -84,26 +195,15 @@ func (c *OpenAi) GetResponse(message chatbot.ChatMessage) (chatbot.ChatMessage,
 }
 
 func (c *OpenAi) AddMessages(messages []chatbot.ChatMessage) {
-	for _, m := range messages {
-		c.messages = append(c.messages, convertMessage(m))
-	}
+	c.messages = append(c.messages, messages...)
 }
 
 func (c *OpenAi) SetMessages(messages []chatbot.ChatMessage) {
-	c.messages = make([]openai.ChatCompletionMessage, 0, len(messages))
-	for _, m := range messages {
-		c.messages = append(c.messages, convertMessage(m))
-	}
+	c.messages = slices.Clone(messages)
 }
 
 func (c *OpenAi) GetMessages() []chatbot.ChatMessage {
-	result := make([]chatbot.ChatMessage, 0, len(c.messages))
-
-	for _, m := range c.messages {
-		result = append(result, chatbot.ChatMessage{Role: m.Role, Content: m.Content})
-	}
-
-	return result
+	return slices.Clone(c.messages)
 }
 
 func (c *OpenAi) SetSystemPrompt(prompt string) {
@@ -117,17 +217,44 @@ func (c *OpenAi) GetSystemPrompt() string {
 
 // Get a list of features that this chatter supports.
 func (c OpenAi) SupportedFeatures() []string {
-	return []string{}
+	return []string{"tools"}
 }
 
-// Set tools for Yappie
 func (c *OpenAi) SetTools(tools []chattools.ToolDefinition) {
-	panic("tools not supported")
+	c.tools = tools
+}
+
+// Force or forbid tool calls, and turn off parallel calls.
+func (c *OpenAi) SetToolChoice(choice chattools.ToolChoice) {
+	c.toolChoice = choice
 }
 
-func convertMessage(m chatbot.ChatMessage) openai.ChatCompletionMessage {
-	return openai.ChatCompletionMessage{
+// Make the model answer with JSON that matches schema, through the JSON schema response format.
+func (c *OpenAi) SetResponseSchema(schema *jsonschema.JsonSchema) {
+	c.responseSchema = schema
+}
+
+// Converts a message to the messages of OpenAI. Every tool result is a message of its own.
+func convertMessage(m chatbot.ChatMessage) []openai.ChatCompletionMessage {
+	if m.Role == chatbot.ChatMessageRoleTool {
+		result := make([]openai.ChatCompletionMessage, 0, len(m.ToolResults))
+		for _, tr := range m.ToolResults {
+			result = append(result, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleTool, Content: tr.Content, ToolCallID: tr.ID})
+		}
+		return result
+	}
+
+	msg := openai.ChatCompletionMessage{
 		Role:    m.Role,
 		Content: m.Content,
 	}
+	for _, tc := range m.ToolCalls {
+		args, _ := json.Marshal(tc.Params)
+		msg.ToolCalls = append(msg.ToolCalls, openai.ToolCall{
+			ID:       tc.ID,
+			Type:     openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: tc.Name, Arguments: string(args)},
+		})
+	}
+	return []openai.ChatCompletionMessage{msg}
 }
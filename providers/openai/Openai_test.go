@@ -1,11 +1,17 @@
 package openai
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 
 	"github.com/c00/botman-v2/chatbot"
+	"github.com/c00/botman-v2/chattools"
 	chattertest "github.com/c00/botman-v2/internal/chattertest"
+	openai "github.com/sashabaranov/go-openai"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -19,3 +25,103 @@ func TestChatterSuite(t *testing.T) {
 		return chatter
 	})
 }
+
+// A stand-in for the chat completions API that streams chunks. Keeps the last request.
+type fakeApi struct {
+	request map[string]any
+	chunks  []string
+}
+
+func (f *fakeApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.request = map[string]any{}
+	json.NewDecoder(r.Body).Decode(&f.request)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, chunk := range f.chunks {
+		fmt.Fprintf(w, "data: %v\n\n", chunk)
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func newFakeChatter(t *testing.T, api *fakeApi) *OpenAi {
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	chatter, err := New(Config{ApiKey: "test-key", Model: "gpt-4o"})
+	assert.Nil(t, err)
+	cfg := openai.DefaultConfig("test-key")
+	cfg.BaseURL = server.URL + "/v1"
+	chatter.client = openai.NewClientWithConfig(cfg)
+	return chatter
+}
+
+func TestOpenAi_ToolCalls(t *testing.T) {
+	api := &fakeApi{chunks: []string{
+		`{"choices": [{"index": 0, "delta": {"role": "assistant", "tool_calls": [{"index": 0, "id": "call_1", "type": "function", "function": {"name": "add", "arguments": ""}}]}}]}`,
+		`{"choices": [{"index": 0, "delta": {"tool_calls": [{"index": 0, "function": {"arguments": "{\"a\": 2, "}}]}}]}`,
+		`{"choices": [{"index": 0, "delta": {"tool_calls": [{"index": 0, "function": {"arguments": "\"b\": 3}"}}]}}]}`,
+		`{"choices": [{"index": 0, "delta": {"tool_calls": [{"index": 1, "id": "call_2", "type": "function", "function": {"name": "add", "arguments": "{}"}}]}}]}`,
+		`{"choices": [{"index": 0, "delta": {}, "finish_reason": "tool_calls"}]}`,
+	}}
+	chatter := newFakeChatter(t, api)
+	chatter.SetTools([]chattools.ToolDefinition{{ToolType: chattools.ToolTypeAddNumbers, Name: "add", Description: "Add numbers"}})
+
+	response, err := chatter.GetResponse(chatbot.ChatMessage{Role: chatbot.ChatMessageRoleUser, Content: "add 2 and 3"})
+	assert.Nil(t, err)
+	assert.Equal(t, "tool_calls", response.StopReason)
+	assert.Equal(t, []chattools.ToolCall{
+		{ID: "call_1", Name: "add", Params: map[string]any{"a": float64(2), "b": float64(3)}},
+		{ID: "call_2", Name: "add", Params: map[string]any{}},
+	}, response.ToolCalls)
+
+	tools, _ := api.request["tools"].([]any)
+	if assert.Len(t, tools, 1) {
+		assert.Equal(t, "add", tools[0].(map[string]any)["function"].(map[string]any)["name"])
+	}
+	assert.NotContains(t, api.request, "tool_choice")
+	assert.NotContains(t, api.request, "parallel_tool_calls")
+
+	//Results go back as a message per call
+	api.chunks = []string{`{"choices": [{"index": 0, "delta": {"content": "5"}, "finish_reason": "stop"}]}`}
+	response, err = chatter.GetResponse(chatbot.ChatMessage{Role: chatbot.ChatMessageRoleTool, ToolResults: []chattools.ToolResult{
+		{ID: "call_1", Name: "add", Content: "5", Success: true},
+		{ID: "call_2", Name: "add", Content: "0", Success: true},
+	}})
+	assert.Nil(t, err)
+	assert.Equal(t, "5", response.Content)
+	assert.Len(t, chatter.GetMessages(), 4)
+
+	messages, _ := api.request["messages"].([]any)
+	if assert.Len(t, messages, 5) {
+		assert.Len(t, messages[2].(map[string]any)["tool_calls"], 2)
+		assert.Equal(t, map[string]any{"role": "tool", "content": "5", "tool_call_id": "call_1"}, messages[3])
+		assert.Equal(t, map[string]any{"role": "tool", "content": "0", "tool_call_id": "call_2"}, messages[4])
+	}
+}
+
+func TestOpenAi_ToolChoice(t *testing.T) {
+	api := &fakeApi{chunks: []string{`{"choices": [{"index": 0, "delta": {"content": "hi"}}]}`}}
+	chatter := newFakeChatter(t, api)
+	chatter.SetTools([]chattools.ToolDefinition{{ToolType: chattools.ToolTypeAddNumbers, Name: "add"}})
+
+	tests := []struct {
+		choice   chattools.ToolChoice
+		expected any
+	}{
+		{chattools.ToolChoice{Type: chattools.ToolChoiceNone}, "none"},
+		{chattools.ToolChoice{Type: chattools.ToolChoiceAny}, "required"},
+		{chattools.ToolChoice{Type: chattools.ToolChoiceTool, Name: "add"}, map[string]any{"type": "function", "function": map[string]any{"name": "add"}}},
+	}
+	for _, tt := range tests {
+		chatter.SetToolChoice(tt.choice)
+		_, err := chatter.GetResponse(chatbot.ChatMessage{Role: chatbot.ChatMessageRoleUser, Content: "hi"})
+		assert.Nil(t, err)
+		assert.Equal(t, tt.expected, api.request["tool_choice"])
+	}
+
+	chatter.SetToolChoice(chattools.ToolChoice{DisableParallel: true})
+	_, err := chatter.GetResponse(chatbot.ChatMessage{Role: chatbot.ChatMessageRoleUser, Content: "hi"})
+	assert.Nil(t, err)
+	assert.NotContains(t, api.request, "tool_choice")
+	assert.Equal(t, false, api.request["parallel_tool_calls"])
+}
@@ -1,6 +1,7 @@
 package yappie
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 
@@ -8,6 +9,7 @@ import (
 	"github.com/c00/botman-v2/chattools"
 	"github.com/c00/botman-v2/internal/channeltools"
 	"github.com/c00/botman-v2/internal/logger"
+	"github.com/c00/botman-v2/jsonschema"
 )
 
 const defaultResponse = "Belloo! poopayee bappleees tank yuuu! Chasy potatoooo tulaliloo belloo! Belloo! baboiii hana dul sae jiji daa po kass. Hahaha hahaha uuuhhh chasy jeje. Butt baboiii poulet tikka masala pepete jeje hana dul sae. Bee do bee do bee do daa wiiiii tank yuuu! Potatoooo gelatooo po kass poopayee. Daa jiji tank yuuu! Uuuhhh bappleees ti aamoo! Gelatooo gelatooo. Tatata bala tu hahaha me want bananaaa! Bananaaaa wiiiii me want bananaaa! Wiiiii tatata bala tu."
@@ -21,6 +23,13 @@ type Yappie struct {
 	tools        []chattools.ToolDefinition
 	//Will return a tool use for the tool at this index if tool exists at index
 	UseToolIndex int
+	//Calls all tools in one response instead, unless the tool choice disables parallel calls
+	ParallelCalls bool
+	toolChoice    chattools.ToolChoice
+	//Answers with JSON generated from this schema
+	responseSchema *jsonschema.JsonSchema
+	//Answers this many times with JSON that does not match the response schema first
+	InvalidResponses int
 }
 
 // Get a list of features that this chatter supports.
@@ -37,18 +46,23 @@ func (c *Yappie) GetStreamingResponse(newMessage chatbot.ChatMessage, streamChan
 	log.Debug("GetStreamingResponse Content: %v", newMessage.Content)
 	c.messages = append(c.messages, newMessage)
 
-	for _, part := range strings.Split(defaultResponse, " ") {
-		streamChan <- part + " "
+	content := defaultResponse
+	if c.responseSchema != nil {
+		content = c.structuredResponse()
+		streamChan <- content
+	} else {
+		for _, part := range strings.Split(defaultResponse, " ") {
+			streamChan <- part + " "
+		}
 	}
 
 	close(streamChan)
 
-	response := chatbot.ChatMessage{Role: chatbot.ChatMessageRoleAssistant, Content: defaultResponse}
+	response := chatbot.ChatMessage{Role: chatbot.ChatMessageRoleAssistant, Content: content}
 	c.messages = append(c.messages, response)
 
-	if len(c.messages) == 2 && c.UseToolIndex >= 0 && c.UseToolIndex < len(c.tools) {
+	for i, tool := range c.toolsToCall() {
 		//Create tool call
-		tool := c.tools[c.UseToolIndex]
 		schema := tool.Schema()
 		params := schema.Generate()
 
@@ -58,11 +72,11 @@ func (c *Yappie) GetStreamingResponse(newMessage chatbot.ChatMessage, streamChan
 		}
 
 		toolCall := chattools.ToolCall{
-			ID:     "random-id-1",
-			Name:   c.tools[c.UseToolIndex].Name,
+			ID:     fmt.Sprintf("random-id-%v", i+1),
+			Name:   tool.Name,
 			Params: paramMap,
 		}
-		response.ToolCalls = []chattools.ToolCall{toolCall}
+		response.ToolCalls = append(response.ToolCalls, toolCall)
 	}
 
 	return response, nil
@@ -93,3 +107,56 @@ func (c *Yappie) SetSystemPrompt(prompt string) {
 func (c *Yappie) GetSystemPrompt() string {
 	return c.SystemPrompt
 }
+
+// Set which tools Yappie calls.
+func (c *Yappie) SetToolChoice(choice chattools.ToolChoice) {
+	c.toolChoice = choice
+}
+
+// The tools to call in this response. Without a tool choice, Yappie calls the tool at UseToolIndex
+// in the first response. Tool choice any calls it in every response.
+func (c *Yappie) toolsToCall() []chattools.ToolDefinition {
+	switch c.toolChoice.Type {
+	case chattools.ToolChoiceNone:
+		return nil
+	case chattools.ToolChoiceTool:
+		for _, tool := range c.tools {
+			if tool.Name == c.toolChoice.Name {
+				return []chattools.ToolDefinition{tool}
+			}
+		}
+		return nil
+	case chattools.ToolChoiceAny:
+	default:
+		if len(c.messages) != 2 {
+			return nil
+		}
+	}
+
+	if c.UseToolIndex < 0 || c.UseToolIndex >= len(c.tools) {
+		return nil
+	}
+
+	if c.ParallelCalls && !c.toolChoice.DisableParallel {
+		return c.tools
+	}
+	return []chattools.ToolDefinition{c.tools[c.UseToolIndex]}
+}
+
+// Set a schema to answer with JSON that matches it.
+func (c *Yappie) SetResponseSchema(schema *jsonschema.JsonSchema) {
+	c.responseSchema = schema
+}
+
+func (c *Yappie) structuredResponse() string {
+	if c.InvalidResponses > 0 {
+		c.InvalidResponses--
+		return `{"yappie": "Belloo!"}`
+	}
+
+	data, err := json.Marshal(c.responseSchema.Generate())
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
@@ -4,7 +4,10 @@ import (
 	"testing"
 
 	"github.com/c00/botman-v2/chatbot"
+	"github.com/c00/botman-v2/chattools"
 	chattertest "github.com/c00/botman-v2/internal/chattertest"
+	"github.com/c00/botman-v2/jsonschema"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestChatterSuite(t *testing.T) {
@@ -12,3 +15,35 @@ func TestChatterSuite(t *testing.T) {
 		return &Yappie{}
 	})
 }
+
+func TestToolChoice(t *testing.T) {
+	tools := []chattools.ToolDefinition{
+		chattools.ToolDefinition{Name: "first"}.WithSchema(jsonschema.New()),
+		chattools.ToolDefinition{Name: "second"}.WithSchema(jsonschema.New()),
+	}
+	prompt := chatbot.ChatMessage{Role: chatbot.ChatMessageRoleUser, Content: "hi"}
+
+	calls := func(choice chattools.ToolChoice, parallel bool, history int) []string {
+		c := &Yappie{ParallelCalls: parallel}
+		c.SetTools(tools)
+		c.SetToolChoice(choice)
+		c.SetMessages(make([]chatbot.ChatMessage, history))
+
+		msg, err := c.GetResponse(prompt)
+		assert.Nil(t, err)
+
+		names := []string{}
+		for _, call := range msg.ToolCalls {
+			names = append(names, call.Name)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"first"}, calls(chattools.ToolChoice{}, false, 0))
+	assert.Empty(t, calls(chattools.ToolChoice{}, false, 2))
+	assert.Empty(t, calls(chattools.ToolChoice{Type: chattools.ToolChoiceNone}, false, 0))
+	assert.Equal(t, []string{"first"}, calls(chattools.ToolChoice{Type: chattools.ToolChoiceAny}, false, 2))
+	assert.Equal(t, []string{"second"}, calls(chattools.ToolChoice{Type: chattools.ToolChoiceTool, Name: "second"}, false, 2))
+	assert.Equal(t, []string{"first", "second"}, calls(chattools.ToolChoice{}, true, 0))
+	assert.Equal(t, []string{"first"}, calls(chattools.ToolChoice{DisableParallel: true}, true, 0))
+}